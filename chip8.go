@@ -0,0 +1,231 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+const (
+	DisplayWidth  = cpu.DisplayWidth
+	DisplayHeight = cpu.DisplayHeight
+	KeyCount      = 16
+
+	DefaultMemorySize           = 4096
+	DefaultProgramStart         = 0x200
+	DefaultInstructionsPerFrame = 10
+)
+
+type settings struct {
+	memorySize           int
+	programStart         int
+	instructionsPerFrame int
+}
+
+// Option configures a Machine created by New.
+type Option func(*settings)
+
+// WithMemorySize sets the size of addressable memory in bytes. It must
+// hold the built-in font and at least one instruction after the program
+// start. The default is DefaultMemorySize.
+func WithMemorySize(size int) Option {
+	return func(s *settings) { s.memorySize = size }
+}
+
+// WithProgramStart sets the address ROMs are loaded at and execution
+// starts from. The default is DefaultProgramStart.
+func WithProgramStart(addr int) Option {
+	return func(s *settings) { s.programStart = addr }
+}
+
+// WithInstructionsPerFrame sets how many instructions StepFrame executes
+// before ticking the timers. The default is DefaultInstructionsPerFrame.
+func WithInstructionsPerFrame(n int) Option {
+	return func(s *settings) { s.instructionsPerFrame = n }
+}
+
+// State is a copy of the interpreter's registers and timers.
+type State struct {
+	V     [16]uint8  // general registers V0-VF
+	I     uint16     // address register
+	PC    uint16     // program counter
+	SP    uint8      // number of return addresses on Stack
+	Stack [16]uint16 // return addresses, the innermost at SP-1
+	DT    uint8      // delay timer
+	ST    uint8      // sound timer
+}
+
+// Machine is a CHIP-8 interpreter instance. A Machine is not safe for
+// concurrent use.
+type Machine struct {
+	cpu                  *cpu.Cpu
+	instructionsPerFrame int
+}
+
+// New creates a Machine with empty memory apart from the built-in font.
+func New(opts ...Option) (*Machine, error) {
+	s := settings{
+		memorySize:           DefaultMemorySize,
+		programStart:         DefaultProgramStart,
+		instructionsPerFrame: DefaultInstructionsPerFrame,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	if s.memorySize < 16*cpu.FontGlyphSize || s.memorySize > 0xFFFF {
+		return nil, fmt.Errorf("chip8: memory size %d out of range", s.memorySize)
+	}
+	if s.programStart < 0 || s.programStart+2 > s.memorySize {
+		return nil, fmt.Errorf("chip8: program start 0x%X outside %d bytes of memory", s.programStart, s.memorySize)
+	}
+	if s.instructionsPerFrame < 1 {
+		return nil, errors.New("chip8: instructions per frame must be positive")
+	}
+
+	return &Machine{
+		cpu:                  cpu.NewCpu(uint16(s.memorySize), uint16(s.programStart)),
+		instructionsPerFrame: s.instructionsPerFrame,
+	}, nil
+}
+
+// LoadROM resets the machine and copies rom to the program start.
+func (m *Machine) LoadROM(rom []byte) error {
+	if err := m.cpu.LoadGame(rom); err != nil {
+		return fmt.Errorf("chip8: %w", err)
+	}
+	return nil
+}
+
+// Reset clears memory, registers, timers and the display. The loaded ROM
+// is discarded.
+func (m *Machine) Reset() {
+	m.cpu.Reset()
+}
+
+// Step executes a single instruction.
+func (m *Machine) Step() {
+	m.cpu.Execute()
+}
+
+// StepFrame executes one frame's worth of instructions and then ticks
+// the delay and sound timers once.
+func (m *Machine) StepFrame() {
+	for i := 0; i < m.instructionsPerFrame; i++ {
+		m.cpu.Execute()
+	}
+	m.cpu.TickTimers()
+}
+
+// TickTimers decrements the delay and sound timers, as happens at 60 Hz.
+func (m *Machine) TickTimers() {
+	m.cpu.TickTimers()
+}
+
+// State returns a copy of the registers, stack and timers. It can be
+// restored later with SetState.
+func (m *Machine) State() State {
+	c := m.cpu
+	return State{
+		V:     c.Registers,
+		I:     c.I,
+		PC:    c.Pc,
+		SP:    c.Sp,
+		Stack: c.Stack,
+		DT:    c.Dt,
+		ST:    c.St,
+	}
+}
+
+// SetState overwrites the registers and timers. Memory and the display
+// are left unchanged. It fails, changing nothing, if SP is deeper than
+// the stack.
+func (m *Machine) SetState(s State) error {
+	if int(s.SP) > len(s.Stack) {
+		return fmt.Errorf("chip8: sp %d is deeper than the %d-entry stack", s.SP, len(s.Stack))
+	}
+
+	c := m.cpu
+	c.Registers = s.V
+	c.I = s.I
+	c.Pc = s.PC
+	c.Sp = s.SP
+	c.Stack = s.Stack
+	c.Dt = s.DT
+	c.St = s.ST
+	return nil
+}
+
+// MemorySize returns the size of addressable memory in bytes.
+func (m *Machine) MemorySize() int {
+	return len(m.cpu.Memory)
+}
+
+// ReadMemory copies memory starting at addr into buf and returns the
+// number of bytes copied.
+func (m *Machine) ReadMemory(addr int, buf []byte) int {
+	if addr < 0 || addr >= len(m.cpu.Memory) {
+		return 0
+	}
+	return copy(buf, m.cpu.Memory[addr:])
+}
+
+// WriteMemory copies data into memory starting at addr and returns the
+// number of bytes written.
+func (m *Machine) WriteMemory(addr int, data []byte) int {
+	if addr < 0 || addr >= len(m.cpu.Memory) {
+		return 0
+	}
+	return copy(m.cpu.Memory[addr:], data)
+}
+
+// Framebuffer returns a copy of the display, one byte per pixel in
+// row-major order, 1 for lit and 0 for dark.
+func (m *Machine) Framebuffer() []byte {
+	fb := make([]byte, DisplayWidth*DisplayHeight)
+	copy(fb, m.cpu.Display[:])
+	return fb
+}
+
+// Pixel reports whether the pixel at x, y is lit. Coordinates outside
+// the display report false.
+func (m *Machine) Pixel(x, y int) bool {
+	if x < 0 || x >= DisplayWidth || y < 0 || y >= DisplayHeight {
+		return false
+	}
+	return m.cpu.Display[y*DisplayWidth+x] != 0
+}
+
+// SetKey sets the state of keypad key 0x0-0xF. Other values are ignored.
+func (m *Machine) SetKey(key int, pressed bool) {
+	if key < 0 || key >= KeyCount {
+		return
+	}
+	m.cpu.Keys[key] = pressed
+}
+
+// KeyPressed reports whether keypad key 0x0-0xF is held down. Other
+// values report false.
+func (m *Machine) KeyPressed(key int) bool {
+	if key < 0 || key >= KeyCount {
+		return false
+	}
+	return m.cpu.Keys[key]
+}
+
+// DelayTimer returns the delay timer, which counts down to zero at 60 Hz.
+func (m *Machine) DelayTimer() uint8 {
+	return m.cpu.Dt
+}
+
+// SoundTimer returns the sound timer. The buzzer sounds while it is
+// above zero.
+func (m *Machine) SoundTimer() uint8 {
+	return m.cpu.St
+}
+
+// SoundActive reports whether the buzzer should be sounding.
+func (m *Machine) SoundActive() bool {
+	return m.cpu.SoundActive()
+}
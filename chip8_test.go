@@ -0,0 +1,125 @@
+package chip8
+
+import (
+	"testing"
+)
+
+func TestNew_defaults(t *testing.T) {
+	m, err := New()
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if m.MemorySize() != DefaultMemorySize {
+		t.Errorf("Expected memory size %d, got %d", DefaultMemorySize, m.MemorySize())
+	}
+
+	if m.State().PC != DefaultProgramStart {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", DefaultProgramStart, m.State().PC)
+	}
+}
+
+func TestNew_invalidOptions(t *testing.T) {
+	cases := [][]Option{
+		{WithMemorySize(16)},
+		{WithMemorySize(512), WithProgramStart(0x200)},
+		{WithInstructionsPerFrame(0)},
+	}
+
+	for i, opts := range cases {
+		if _, err := New(opts...); err == nil {
+			t.Errorf("Expected case %d to be rejected", i)
+		}
+	}
+}
+
+func TestMachine_StepFrame(t *testing.T) {
+	m, err := New(WithInstructionsPerFrame(4))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// LD V0, 5; LD DT, V0; LD F, V0; DRW V1, V1, 5; JP 0x208
+	rom := []byte{0x60, 0x05, 0xF0, 0x15, 0xF0, 0x29, 0xD1, 0x15, 0x12, 0x08}
+	if err := m.LoadROM(rom); err != nil {
+		t.Fatalf("LoadROM failed: %v", err)
+	}
+
+	m.StepFrame()
+
+	state := m.State()
+	if state.PC != 0x208 {
+		t.Errorf("Expected PC to be 0x208, got 0x%X", state.PC)
+	}
+
+	if state.DT != 4 {
+		t.Errorf("Expected DT to be 4 after one frame, got %d", state.DT)
+	}
+
+	// Glyph 5 starts with 0xF0.
+	for x := 0; x < 4; x++ {
+		if !m.Pixel(x, 0) {
+			t.Errorf("Expected pixel %d,0 to be lit", x)
+		}
+	}
+
+	fb := m.Framebuffer()
+	fb[0] = 0
+	if !m.Pixel(0, 0) {
+		t.Errorf("Expected Framebuffer to return a copy")
+	}
+}
+
+func TestMachine_keys(t *testing.T) {
+	m, _ := New()
+
+	// LD V0, K; then spin.
+	m.LoadROM([]byte{0xF0, 0x0A, 0x12, 0x02})
+
+	m.Step()
+	if m.State().PC != 0x200 {
+		t.Errorf("Expected machine to wait for a key")
+	}
+
+	m.SetKey(0xC, true)
+	m.SetKey(99, true)
+	m.Step()
+
+	if !m.KeyPressed(0xC) {
+		t.Errorf("Expected key C to be pressed")
+	}
+
+	if m.State().V[0] != 0xC {
+		t.Errorf("Expected V0 to be 0xC, got 0x%X", m.State().V[0])
+	}
+}
+
+func TestMachine_memoryAndState(t *testing.T) {
+	m, _ := New(WithMemorySize(1024))
+
+	if n := m.WriteMemory(1020, []byte{1, 2, 3, 4, 5, 6}); n != 4 {
+		t.Errorf("Expected 4 bytes written at the end of memory, got %d", n)
+	}
+
+	buf := make([]byte, 2)
+	m.ReadMemory(1022, buf)
+	if buf[0] != 3 || buf[1] != 4 {
+		t.Errorf("Expected to read back 3 4, got %v", buf)
+	}
+
+	s := m.State()
+	s.V[3] = 9
+	s.ST = 2
+	if err := m.SetState(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.State().V[3] != 9 || !m.SoundActive() {
+		t.Errorf("Expected SetState to apply registers and timers")
+	}
+
+	s.SP = 17
+	if err := m.SetState(s); err == nil || m.State().SP != 0 {
+		t.Errorf("Expected an SP deeper than the stack to be rejected, got %v with SP %d", err, m.State().SP)
+	}
+}
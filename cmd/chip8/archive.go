@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pesos228/chip8/internal/archive"
+)
+
+func runImportArchive(args []string) error {
+	fs := flag.NewFlagSet("importarchive", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 importarchive programs.json romdir out.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return errors.New("expected programs.json, a ROM directory and an output file")
+	}
+
+	programs, invalid, err := archive.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	db, skipped, err := programs.Catalog(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	for _, s := range append(invalid, skipped...) {
+		fmt.Fprintf(os.Stderr, "skipping %s: %v\n", s.ID, s.Err)
+	}
+
+	data, err := db.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fs.Arg(2), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pesos228/chip8/internal/cheat"
+)
+
+// loadCheats reads the cheat file at path or, when path is empty, the one
+// next to the ROM if there is one. It returns nil when there are no
+// cheats.
+func loadCheats(path, romPath string) (*cheat.Set, error) {
+	if path == "" {
+		if romPath == "" {
+			return nil, nil
+		}
+		path = cheat.PathFor(romPath)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+	}
+
+	codes, err := cheat.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d cheats\n", path, len(codes))
+	return cheat.NewSet(codes), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pesos228/chip8/internal/coverage"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+func runCover(args []string) error {
+	fs := flag.NewFlagSet("cover", flag.ExitOnError)
+	steps := fs.Int("steps", 100000, "number of instructions to execute")
+	rom := addROMFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 cover [flags] rom out.cov")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a ROM and an output file")
+	}
+
+	c, game, err := rom.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	r := coverage.NewRecorder(c, len(game.Data))
+	r.Run(*steps)
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return r.Profile.Write(out)
+}
+
+func runCoverReport(args []string) error {
+	fs := flag.NewFlagSet("coverreport", flag.ExitOnError)
+	htmlFile := fs.String("html", "", "write an annotated disassembly to this file")
+	symbolFile := fs.String("symbols", "", "symbol file with \"addr label\" lines")
+	minPercent := fs.Float64("min", 0, "fail unless byte coverage is at least this percentage")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 coverreport [flags] rom run.cov...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected a ROM and at least one coverage file")
+	}
+
+	rom, err := loader.LoadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var merged *coverage.Profile
+	for _, path := range fs.Args()[1:] {
+		p, err := coverage.Load(path)
+		if err != nil {
+			return err
+		}
+		if merged == nil {
+			merged = p
+		} else if err := merged.Merge(p); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if *htmlFile != "" {
+		var syms symbols.Table
+		if *symbolFile != "" {
+			if syms, err = symbols.Load(*symbolFile); err != nil {
+				return err
+			}
+		}
+
+		out, err := os.Create(*htmlFile)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if err := coverage.WriteHTML(out, filepath.Base(fs.Arg(0)), rom.Data, merged, syms); err != nil {
+			return err
+		}
+	}
+
+	s := merged.Summary()
+	fmt.Printf("bytes: %.1f%% (%d/%d)\n", s.BytePercent(), s.CoveredBytes, s.Bytes)
+	fmt.Printf("branches: %.1f%% (%d/%d)\n", s.BranchPercent(), s.CoveredBranches, s.Branches)
+
+	if s.BytePercent() < *minPercent {
+		return fmt.Errorf("byte coverage %.1f%% is below the required %.1f%%", s.BytePercent(), *minPercent)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/render"
+)
+
+type displayOptions struct {
+	palette string
+}
+
+// addDisplayFlags adds the display flags. -decay and -steady reach the
+// settings through romOptions.flags; -palette may name a built-in
+// palette, so it is resolved here.
+func addDisplayFlags(fs *flag.FlagSet) *displayOptions {
+	o := &displayOptions{}
+	fs.StringVar(&o.palette, "palette", "", "palette: "+strings.Join(render.Builtins(), ", ")+" or comma-separated #rrggbb colors (default: from the settings)")
+	fs.Float64("decay", 0, "how much of a dark pixel's glow is left after a frame, from 0 to below 1")
+	fs.Bool("steady", false, "hold back frames that only erase pixels, hiding XOR flicker")
+	return o
+}
+
+// renderer creates the renderer the settings describe, with the -palette
+// flag over the settings' palette.
+func (o *displayOptions) renderer(settings config.Settings) (*render.Renderer, error) {
+	var palette render.Palette
+	var err error
+	if o.palette != "" {
+		palette, err = render.Lookup(o.palette)
+	} else {
+		palette, err = render.ParsePalette(settings.Palette)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return render.New(render.Options{Palette: palette, Decay: settings.Decay, Steady: settings.Steady})
+}
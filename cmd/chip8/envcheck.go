@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+
+	"github.com/pesos228/chip8/internal/env"
+)
+
+// runEnvCheck plays a game with random actions under an environment
+// config, so that reward and done rules can be checked before training.
+func runEnvCheck(args []string) error {
+	fs := flag.NewFlagSet("envcheck", flag.ExitOnError)
+	episodes := fs.Int("episodes", 3, "number of episodes to play")
+	maxSteps := fs.Int("steps", 10000, "stop an episode after this many steps if the config does not end it")
+	seed := fs.Int64("seed", 1, "seed for the machine and the random agent")
+	rom := addROMFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 envcheck [flags] config.json rom")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a config and a ROM")
+	}
+
+	config, err := env.LoadConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if config.MaxSteps == 0 {
+		config.MaxSteps = *maxSteps
+	}
+
+	c, game, err := rom.load(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	e, err := env.New(c, game, config)
+	if err != nil {
+		return err
+	}
+	e.Seed(*seed)
+	agent := rand.New(rand.NewSource(*seed))
+
+	for episode := 1; episode <= *episodes; episode++ {
+		if _, err := e.Reset(); err != nil {
+			return err
+		}
+
+		var total float64
+		steps, rewarded := 0, 0
+		for done := false; !done; {
+			var reward float64
+			_, reward, done, err = e.Step(agent.Intn(e.ActionCount()))
+			if err != nil {
+				return err
+			}
+			steps++
+			total += reward
+			if reward != 0 {
+				rewarded++
+			}
+		}
+
+		fmt.Printf("episode %d: %d steps, return %g, %d rewarded steps\n", episode, steps, total, rewarded)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pesos228/chip8/internal/keymap"
+)
+
+type keymapOptions struct {
+	config  string
+	profile string
+}
+
+func addKeymapFlags(fs *flag.FlagSet) *keymapOptions {
+	o := &keymapOptions{}
+	fs.StringVar(&o.config, "keymaps", "", "keymap profiles file (default: keymaps.json in the user config directory)")
+	fs.StringVar(&o.profile, "keymap", "", "use this keymap profile for every ROM: "+strings.Join(keymap.Builtins(), ", ")+" or one from the profiles file")
+	return o
+}
+
+// resolver returns the function that picks each ROM's keymap, from the
+// profiles file and the ROM database. A keymap named in the settings
+// applies to every ROM, as -keymap does.
+func (o *keymapOptions) resolver(rom *romOptions) (func([]byte) keymap.Keymap, error) {
+	var config *keymap.Config
+	var err error
+	if o.config != "" {
+		config, err = keymap.LoadFile(o.config)
+	} else {
+		config, err = keymap.LoadUser()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile := o.profile
+	if profile == "" {
+		profile = rom.settings.Keymap
+	}
+	if profile != "" {
+		k, ok := config.Profile(profile)
+		if !ok {
+			return nil, fmt.Errorf("unknown keymap profile %q", profile)
+		}
+		return func([]byte) keymap.Keymap { return k }, nil
+	}
+
+	db, err := rom.db()
+	if err != nil {
+		return nil, err
+	}
+	return func(data []byte) keymap.Keymap { return config.ForROM(data, db) }, nil
+}
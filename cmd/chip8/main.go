@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "serve", usage: "play a ROM in the browser", run: runServe},
+	{name: "rpc", usage: "control the interpreter over JSON-RPC", run: runRPC},
+	{name: "trace", usage: "record an execution trace of a ROM", run: runTrace},
+	{name: "tracediff", usage: "report the first divergence between two traces", run: runTraceDiff},
+	{name: "render", usage: "run a ROM headlessly and save its screen as a PNG or GIF", run: runRender},
+	{name: "profile", usage: "write a pprof profile of a ROM's execution", run: runProfile},
+	{name: "cover", usage: "record ROM coverage for one run", run: runCover},
+	{name: "coverreport", usage: "merge coverage runs and report or gate on them", run: runCoverReport},
+	{name: "genvectors", usage: "generate single-step test vectors for every opcode", run: runGenVectors},
+	{name: "envcheck", usage: "play a ROM at random under an RL environment config", run: runEnvCheck},
+	{name: "mkpatch", usage: "create an IPS or BPS patch from two ROMs", run: runMkPatch},
+	{name: "importarchive", usage: "build a ROM database from CHIP-8 Archive metadata", run: runImportArchive},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "chip8 %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "chip8: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: chip8 <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.usage)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pesos228/chip8/internal/patch"
+)
+
+// runMkPatch writes a patch that turns one ROM into another.
+func runMkPatch(args []string) error {
+	fs := flag.NewFlagSet("mkpatch", flag.ExitOnError)
+	format := fs.String("format", "", "ips or bps (default: from the patch file's extension, else bps)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 mkpatch [flags] original.ch8 modified.ch8 out.bps")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return errors.New("expected the original ROM, the modified ROM and the patch file")
+	}
+
+	f := patch.Format(*format)
+	if f == "" {
+		f = patch.BPS
+		if strings.EqualFold(filepath.Ext(fs.Arg(2)), ".ips") {
+			f = patch.IPS
+		}
+	}
+
+	source, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	target, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	data, err := patch.Create(f, source, target)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fs.Arg(2), data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s patch of %d bytes\n", fs.Arg(2), f, len(data))
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pesos228/chip8/internal/profile"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	steps := fs.Int("steps", 1000000, "number of instructions to execute")
+	symbolFile := fs.String("symbols", "", "symbol file with \"addr label\" lines")
+	rom := addROMFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 profile [flags] rom out.pb.gz")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a ROM and an output file")
+	}
+
+	var syms symbols.Table
+	if *symbolFile != "" {
+		var err error
+		if syms, err = symbols.Load(*symbolFile); err != nil {
+			return err
+		}
+	}
+
+	c, _, err := rom.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	p := profile.New(c, syms)
+	p.Run(*steps)
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return p.WritePprof(out)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/render"
+)
+
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	frames := fs.Int("frames", 300, "number of frames to run")
+	every := fs.Int("every", 3, "record every nth frame in a GIF")
+	scale := fs.Int("scale", 8, "image pixels per display pixel")
+	keys := fs.String("keys", "", "keypad keys to hold down for the whole run, as hex digits")
+	fs.Int("ipf", config.Defaults().InstructionsPerFrame, "instructions per frame")
+	rom := addROMFlags(fs)
+	display := addDisplayFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 render [flags] rom out.png|out.gif")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a ROM and an output file")
+	}
+	if *frames < 1 || *every < 1 || *scale < 1 {
+		return errors.New("-frames, -every and -scale must be at least 1")
+	}
+	ext := strings.ToLower(filepath.Ext(fs.Arg(1)))
+	if ext != ".png" && ext != ".gif" {
+		return fmt.Errorf("%s: output must be .png or .gif", fs.Arg(1))
+	}
+
+	c, _, err := rom.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, k := range *keys {
+		key, err := strconv.ParseUint(string(k), 16, 4)
+		if err != nil {
+			return fmt.Errorf("-keys: %q is not a hex digit", k)
+		}
+		c.Keys[key] = true
+	}
+
+	r, err := display.renderer(rom.settings)
+	if err != nil {
+		return err
+	}
+
+	// GIF delays are in hundredths of a second and frames last 1/60.
+	var anim *render.GIF
+	if ext == ".gif" {
+		anim = render.NewGIF(r.Options().Palette, *scale, max(2, (*every*100+30)/60))
+	}
+	for frame := 1; frame <= *frames; frame++ {
+		for i := 0; i < rom.settings.InstructionsPerFrame; i++ {
+			c.Execute()
+		}
+		c.TickTimers()
+		r.Frame(&c.Display)
+		if anim != nil && frame%*every == 0 {
+			anim.Add(r.Image())
+		}
+	}
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if anim != nil {
+		err = anim.Encode(out)
+	} else {
+		err = render.WritePNG(out, r.Image(), *scale)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/patch"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+type romOptions struct {
+	fs           *flag.FlagSet
+	memorySize   uint
+	programStart uint
+	platform     string
+	config       string
+	overrides    string
+	noDB         bool
+	patch        string
+
+	// settings are the resolved settings of the last machine created.
+	settings config.Settings
+}
+
+func addROMFlags(fs *flag.FlagSet) *romOptions {
+	o := &romOptions{fs: fs}
+	defaults := config.Defaults()
+	fs.UintVar(&o.memorySize, "mem", uint(defaults.MemorySize), "memory size in bytes")
+	fs.UintVar(&o.programStart, "start", uint(defaults.ProgramStart), "program start address")
+	fs.StringVar(&o.platform, "platform", "", "platform whose quirks to use: chip8, chip48, schip, xochip or modern")
+	fs.StringVar(&o.config, "config", "", "settings file (default: config.json in the user config directory)")
+	fs.StringVar(&o.overrides, "romdb", "", "ROM database file overriding the built-in entries")
+	fs.BoolVar(&o.noDB, "nodb", false, "do not apply settings from the ROM database")
+	fs.StringVar(&o.patch, "patch", "", "IPS or BPS patch to apply to the ROM")
+	return o
+}
+
+// db returns the ROM database with any overrides, or nil with -nodb.
+func (o *romOptions) db() (*romdb.DB, error) {
+	if o.noDB {
+		return nil, nil
+	}
+
+	db, err := romdb.Default()
+	if err != nil {
+		return nil, err
+	}
+	if o.overrides != "" {
+		if err := db.LoadOverrides(o.overrides); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// flags returns the layer of settings given on the command line. Only
+// flags that were set count, so the defaults of -mem and -start do not
+// hide the config files. Commands with -ipf or the display flags get
+// them here too.
+func (o *romOptions) flags() config.Layer {
+	var l config.Layer
+	o.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mem":
+			n := config.Number(o.memorySize)
+			l.MemorySize = &n
+		case "start":
+			n := config.Number(o.programStart)
+			l.ProgramStart = &n
+		case "platform":
+			l.Platform = &o.platform
+		case "ipf":
+			ipf := f.Value.(flag.Getter).Get().(int)
+			l.InstructionsPerFrame = &ipf
+		case "decay":
+			decay := f.Value.(flag.Getter).Get().(float64)
+			l.Decay = &decay
+		case "steady":
+			steady := f.Value.(flag.Getter).Get().(bool)
+			l.Steady = &steady
+		}
+	})
+	return l
+}
+
+// global reads the settings file given with -config, or the user's.
+func (o *romOptions) global() (config.Layer, error) {
+	if o.config != "" {
+		return config.LoadFile(o.config)
+	}
+	return config.LoadUser()
+}
+
+// resolver returns the resolver that layers the settings for each ROM:
+// the defaults, the settings file, what the ROM brings, then the command
+// line.
+func (o *romOptions) resolver() (*config.Resolver, error) {
+	global, err := o.global()
+	if err != nil {
+		return nil, err
+	}
+	db, err := o.db()
+	if err != nil {
+		return nil, err
+	}
+	return &config.Resolver{Base: global, DB: db, Override: o.flags()}, nil
+}
+
+// newCpu creates a machine with no ROM loaded.
+func (o *romOptions) newCpu() (*cpu.Cpu, error) {
+	global, err := o.global()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := config.Resolve(global, o.flags())
+	if err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	o.settings = settings
+	return cpu.NewCpuWithConfig(settings.Cpu()), nil
+}
+
+// load reads the ROM at path, in any format the loader understands, into
+// a new Cpu, patching it and configuring the Cpu from the settings the
+// resolver layers for it. A patched ROM that is not in the database gets
+// the original's entry.
+func (o *romOptions) load(path string) (*cpu.Cpu, *loader.ROM, error) {
+	rom, err := loader.LoadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var original []byte
+	if o.patch != "" {
+		original = rom.Data
+		rom.Data, err = patch.ApplyFile(rom.Data, o.patch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	r, err := o.resolver()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, entry, err := r.Resolve(rom, path, original)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", path, entry.Title, entry.Platform)
+	}
+	o.settings = settings
+
+	// The resolved quirks replace any the ROM carries, so that reloading
+	// it keeps them.
+	rom.Quirks = &settings.Quirks
+	c := cpu.NewCpuWithConfig(settings.Cpu())
+	if err := rom.Load(c); err != nil {
+		return nil, nil, err
+	}
+
+	return c, rom, nil
+}
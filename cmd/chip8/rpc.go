@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/rpc"
+)
+
+func runRPC(args []string) error {
+	fs := flag.NewFlagSet("rpc", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:7878", "TCP address to listen on")
+	unix := fs.String("unix", "", "listen on this Unix socket instead of TCP")
+	fs.Int("ipf", config.Defaults().InstructionsPerFrame, "instructions per frame")
+	rom := addROMFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 rpc [flags] [rom]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("expected at most one ROM")
+	}
+
+	var c *cpu.Cpu
+	var game *loader.ROM
+	if fs.NArg() == 1 {
+		var err error
+		c, game, err = rom.load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		c, err = rom.newCpu()
+		if err != nil {
+			return err
+		}
+	}
+
+	resolver, err := rom.resolver()
+	if err != nil {
+		return err
+	}
+
+	network, address := "tcp", *addr
+	if *unix != "" {
+		network, address = "unix", *unix
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "JSON-RPC listening on %s %s\n", network, ln.Addr())
+	server := rpc.NewServer(c, game, rom.settings.InstructionsPerFrame)
+	server.SetResolver(resolver)
+	return server.Serve(ln)
+}
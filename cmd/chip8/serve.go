@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/cheat"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/netplay"
+	"github.com/pesos228/chip8/internal/web"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	fs.Int("ipf", config.Defaults().InstructionsPerFrame, "instructions per frame")
+	hostAddr := fs.String("host", "", "wait for a second player on this address and play in lockstep")
+	joinAddr := fs.String("join", "", "join a lockstep game hosted at this address")
+	delay := fs.Int("delay", netplay.DefaultConfig.InputDelay, "netplay input delay in frames")
+	hashInterval := fs.Int("hash", netplay.DefaultConfig.HashInterval, "netplay frames between state checks")
+	cheats := fs.String("cheats", "", "cheat file to apply (default: the ROM's name with "+cheat.Extension+", if present)")
+	rom := addROMFlags(fs)
+	keys := addKeymapFlags(fs)
+	display := addDisplayFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 serve [flags] [rom]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("expected at most one ROM")
+	}
+	if *hostAddr != "" && *joinAddr != "" {
+		return errors.New("-host and -join are mutually exclusive")
+	}
+	if *hostAddr != "" && fs.NArg() == 0 {
+		return errors.New("-host needs a ROM")
+	}
+	if *cheats != "" && (*hostAddr != "" || *joinAddr != "") {
+		return errors.New("-cheats cannot be used with netplay")
+	}
+
+	var c *cpu.Cpu
+	var game *loader.ROM
+	if fs.NArg() == 1 {
+		var err error
+		c, game, err = rom.load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		c, err = rom.newCpu()
+		if err != nil {
+			return err
+		}
+	}
+
+	keymapFor, err := keys.resolver(rom)
+	if err != nil {
+		return err
+	}
+	renderer, err := display.renderer(rom.settings)
+	if err != nil {
+		return err
+	}
+	resolver, err := rom.resolver()
+	if err != nil {
+		return err
+	}
+
+	var set *cheat.Set
+	if *hostAddr == "" && *joinAddr == "" {
+		set, err = loadCheats(*cheats, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := web.NewServer(c, game, rom.settings.InstructionsPerFrame)
+	server.SetKeymapFunc(keymapFor)
+	server.SetResolver(resolver)
+	server.SetRenderer(renderer)
+	server.SetAudio(rom.settings.Audio)
+	if set != nil {
+		server.SetCheats(set)
+	}
+
+	var session *netplay.Session
+	switch {
+	case *hostAddr != "":
+		conn, err := acceptPlayer(*hostAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		session, err = netplay.Host(conn, c, netplay.Config{InputDelay: *delay, HashInterval: *hashInterval, InstructionsPerFrame: rom.settings.InstructionsPerFrame})
+		if err != nil {
+			return err
+		}
+	case *joinAddr != "":
+		conn, err := net.Dial("tcp", *joinAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		session, err = netplay.Join(conn, c)
+		if err != nil {
+			return err
+		}
+	}
+	if session != nil {
+		server.SetFrameFunc(session.Frame)
+	}
+
+	go server.Run(ctx)
+
+	httpServer := &http.Server{Handler: server}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving on http://%s\n", ln.Addr())
+	if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func acceptPlayer(addr string) (net.Conn, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	fmt.Fprintf(os.Stderr, "waiting for the second player on %s\n", ln.Addr())
+	return ln.Accept()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pesos228/chip8/internal/trace"
+)
+
+func runTrace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	steps := fs.Int("steps", 10000, "number of instructions to record")
+	rom := addROMFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 trace [flags] rom out.trace")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a ROM and an output file")
+	}
+
+	c, _, err := rom.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return trace.WriteEntries(out, trace.Record(c, *steps))
+}
+
+// errDiverged is returned by tracediff after reporting where the traces
+// part, so that the command exits with a failure status.
+var errDiverged = errors.New("traces diverge")
+
+func runTraceDiff(args []string) error {
+	fs := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	context := fs.Int("context", 5, "number of entries to show around the divergence")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 tracediff [flags] a.trace b.trace")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two trace files")
+	}
+
+	a, err := readTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	b, err := readTrace(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	d := trace.Diff(a, b)
+	trace.Report(os.Stdout, a, b, d, *context)
+	if d != nil {
+		return errDiverged
+	}
+
+	return nil
+}
+
+func readTrace(path string) ([]trace.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := trace.ReadEntries(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
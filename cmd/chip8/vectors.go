@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pesos228/chip8/internal/vectors"
+)
+
+func runGenVectors(args []string) error {
+	fs := flag.NewFlagSet("genvectors", flag.ExitOnError)
+	n := fs.Int("n", 1000, "vectors per opcode")
+	seed := fs.Int64("seed", 1, "random seed")
+	profile := fs.String("profile", "", "generate only this quirk profile")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: chip8 genvectors [flags] outdir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected an output directory")
+	}
+
+	profiles := vectors.Profiles
+	if *profile != "" {
+		p, ok := vectors.LookupProfile(*profile)
+		if !ok {
+			return fmt.Errorf("unknown profile %q", *profile)
+		}
+		profiles = []vectors.Profile{p}
+	}
+
+	for _, p := range profiles {
+		dir := filepath.Join(fs.Arg(0), p.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+
+		for _, instr := range p.Instructions() {
+			vs := vectors.Generate(instr, p.Quirks, *n, *seed)
+			if err := writeVectors(filepath.Join(dir, vectors.Code(instr)+".json"), vs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeVectors(path string, vs []vectors.Vector) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := vectors.Write(f, vs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,280 @@
+//go:build js && wasm
+
+// Command chip8wasm exposes the interpreter to JavaScript. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o chip8.wasm ./cmd/chip8wasm
+//
+// and load it with the wasm_exec.js that ships with Go. Once the module
+// is running, globalThis.chip8.create(options) returns a machine and
+// globalThis.chip8.keymap(rom, config) the keys to play it with, from an
+// optional keymap config in the format keymap.Parse reads; see index.html
+// for a complete static page.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"github.com/pesos228/chip8"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/keymap"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+func main() {
+	js.Global().Set("chip8", js.ValueOf(map[string]any{
+		"create":        js.FuncOf(create),
+		"keymap":        js.FuncOf(keymapFor),
+		"keymaps":       builtinKeymaps(),
+		"displayWidth":  chip8.DisplayWidth,
+		"displayHeight": chip8.DisplayHeight,
+	}))
+	select {}
+}
+
+// create takes an optional object with memorySize, programStart,
+// instructionsPerFrame, keymap, a keymap config as for chip8.keymap, and
+// audio, the buzzer settings in the config file format, and returns a
+// machine object. Methods that can fail return an error message, or null
+// on success.
+func create(this js.Value, args []js.Value) any {
+	var opts []chip8.Option
+	var keymaps *keymap.Config
+	audio := config.Defaults().Audio
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		o := args[0]
+		if v := o.Get("memorySize"); v.Type() == js.TypeNumber {
+			opts = append(opts, chip8.WithMemorySize(v.Int()))
+		}
+		if v := o.Get("programStart"); v.Type() == js.TypeNumber {
+			opts = append(opts, chip8.WithProgramStart(v.Int()))
+		}
+		if v := o.Get("instructionsPerFrame"); v.Type() == js.TypeNumber {
+			opts = append(opts, chip8.WithInstructionsPerFrame(v.Int()))
+		}
+		var err error
+		if keymaps, err = keymapConfig(o.Get("keymap")); err != nil {
+			return map[string]any{"error": err.Error()}
+		}
+		if audio, err = audioSettings(o.Get("audio")); err != nil {
+			return map[string]any{"error": err.Error()}
+		}
+	}
+
+	m, err := chip8.New(opts...)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+
+	b := &bridge{machine: m, keymaps: keymaps, sound: audio}
+	return map[string]any{
+		"loadROM":     js.FuncOf(b.loadROM),
+		"reset":       js.FuncOf(b.reset),
+		"stepFrame":   js.FuncOf(b.stepFrame),
+		"framebuffer": js.FuncOf(b.framebuffer),
+		"setKey":      js.FuncOf(b.setKey),
+		"soundActive": js.FuncOf(b.soundActive),
+		"keymap":      js.FuncOf(b.keymap),
+		"audio":       js.FuncOf(b.audio),
+	}
+}
+
+type bridge struct {
+	machine *chip8.Machine
+	rom     []byte
+	keymaps *keymap.Config
+	sound   config.Audio
+}
+
+// loadROM(Uint8Array) loads a raw ROM image.
+func (b *bridge) loadROM(this js.Value, args []js.Value) any {
+	if len(args) != 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return "loadROM expects a Uint8Array"
+	}
+
+	rom := make([]byte, args[0].Length())
+	js.CopyBytesToGo(rom, args[0])
+	if err := b.machine.LoadROM(rom); err != nil {
+		return err.Error()
+	}
+	b.rom = rom
+	return nil
+}
+
+// reset() restarts the loaded ROM.
+func (b *bridge) reset(this js.Value, args []js.Value) any {
+	if b.rom == nil {
+		b.machine.Reset()
+		return nil
+	}
+	if err := b.machine.LoadROM(b.rom); err != nil {
+		return err.Error()
+	}
+	return nil
+}
+
+// stepFrame(n = 1) runs n frames.
+func (b *bridge) stepFrame(this js.Value, args []js.Value) any {
+	n := 1
+	if len(args) > 0 && args[0].Type() == js.TypeNumber {
+		n = args[0].Int()
+	}
+	for i := 0; i < n; i++ {
+		b.machine.StepFrame()
+	}
+	return nil
+}
+
+// framebuffer() returns a Uint8Array with one byte per pixel, 1 for lit,
+// row by row.
+func (b *bridge) framebuffer(this js.Value, args []js.Value) any {
+	pixels := b.machine.Framebuffer()
+	out := js.Global().Get("Uint8Array").New(len(pixels))
+	js.CopyBytesToJS(out, pixels)
+	return out
+}
+
+// setKey(key, pressed) sets the state of keypad key 0-F.
+func (b *bridge) setKey(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeNumber {
+		return "setKey expects a key and a pressed flag"
+	}
+	b.machine.SetKey(args[0].Int(), args[1].Truthy())
+	return nil
+}
+
+// soundActive() reports whether the buzzer is sounding.
+func (b *bridge) soundActive(this js.Value, args []js.Value) any {
+	return b.machine.SoundActive()
+}
+
+// audio() returns the buzzer settings to play while soundActive() is
+// true: enabled, frequency in Hz and volume from 0 to 1.
+func (b *bridge) audio(this js.Value, args []js.Value) any {
+	return map[string]any{
+		"enabled":   b.sound.Enabled,
+		"frequency": b.sound.Frequency,
+		"volume":    b.sound.Volume,
+	}
+}
+
+// keymap() returns the keymap for the loaded ROM, chosen as by
+// chip8.keymap with the config given to create.
+func (b *bridge) keymap(this js.Value, args []js.Value) any {
+	if b.rom == nil {
+		return keymapObject(defaultKeymap(b.keymaps))
+	}
+	return keymapObject(b.keymaps.ForROM(b.rom, romdb.Embedded()))
+}
+
+// keymapFor(arg, config) returns an object from KeyboardEvent.code names
+// to keypad keys: the profile or built-in keymap named arg, the keymap
+// for the ROM in a Uint8Array, or the default with no argument. config is
+// an optional keymap config, as JSON text or an object, whose profiles
+// and ROM assignments are used before the ROM database. It returns null
+// for an unknown name and an error message for an invalid config.
+func keymapFor(this js.Value, args []js.Value) any {
+	var config *keymap.Config
+	if len(args) > 1 {
+		var err error
+		if config, err = keymapConfig(args[1]); err != nil {
+			return err.Error()
+		}
+	}
+
+	if len(args) == 0 || args[0].IsUndefined() || args[0].IsNull() {
+		return keymapObject(defaultKeymap(config))
+	}
+
+	if args[0].Type() == js.TypeString {
+		if config == nil {
+			config = &keymap.Config{}
+		}
+		k, ok := config.Profile(args[0].String())
+		if !ok {
+			return nil
+		}
+		return keymapObject(k)
+	}
+
+	if !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil
+	}
+	rom := make([]byte, args[0].Length())
+	js.CopyBytesToGo(rom, args[0])
+	return keymapObject(config.ForROM(rom, romdb.Embedded()))
+}
+
+// jsonText returns v, JSON text or an object, as JSON text. It returns
+// nil for undefined and null.
+func jsonText(v js.Value, what string) ([]byte, error) {
+	switch v.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return nil, nil
+	case js.TypeString:
+		return []byte(v.String()), nil
+	case js.TypeObject:
+		return []byte(js.Global().Get("JSON").Call("stringify", v).String()), nil
+	}
+	return nil, fmt.Errorf("%s must be JSON text or an object", what)
+}
+
+// keymapConfig parses a keymap config. Undefined and null mean no config.
+func keymapConfig(v js.Value) (*keymap.Config, error) {
+	data, err := jsonText(v, "keymap config")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	keymaps, err := keymap.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("keymap config: %w", err)
+	}
+	return keymaps, nil
+}
+
+// audioSettings reads the audio object of a config file, laid over the
+// defaults. Undefined and null mean the defaults.
+func audioSettings(v js.Value) (config.Audio, error) {
+	data, err := jsonText(v, "audio")
+	if err != nil || data == nil {
+		return config.Defaults().Audio, err
+	}
+
+	layer, err := config.Parse([]byte(`{"audio": ` + string(data) + `}`))
+	if err != nil {
+		return config.Audio{}, err
+	}
+	settings, err := config.Resolve(layer)
+	if err != nil {
+		return config.Audio{}, err
+	}
+	return settings.Audio, nil
+}
+
+// defaultKeymap is the keymap config's default, which may be nil, for
+// when there is no ROM to choose by.
+func defaultKeymap(config *keymap.Config) keymap.Keymap {
+	if config != nil {
+		if k, ok := config.Profile(config.Default); ok {
+			return k
+		}
+	}
+	return keymap.Default()
+}
+
+func builtinKeymaps() []any {
+	var names []any
+	for _, name := range keymap.Builtins() {
+		names = append(names, name)
+	}
+	return names
+}
+
+func keymapObject(k keymap.Keymap) map[string]any {
+	out := map[string]any{}
+	for name, index := range k {
+		out[name] = int(index)
+	}
+	return out
+}
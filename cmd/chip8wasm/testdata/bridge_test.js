@@ -0,0 +1,86 @@
+// Runs the wasm build under Node and exercises the bridge. Usage:
+//
+//	node bridge_test.js wasm_exec.js chip8.wasm
+//
+// Prints "ok" on success and exits non-zero on the first failure.
+"use strict";
+
+const [wasmExec, wasmPath] = process.argv.slice(2);
+
+globalThis.require = require;
+globalThis.fs = require("fs");
+globalThis.path = require("path");
+globalThis.TextEncoder = require("util").TextEncoder;
+globalThis.TextDecoder = require("util").TextDecoder;
+globalThis.performance ??= require("perf_hooks").performance;
+globalThis.crypto ??= require("crypto");
+
+require(wasmExec);
+
+function check(cond, msg) {
+  if (!cond) {
+    console.error("FAIL: " + msg);
+    process.exit(1);
+  }
+}
+
+const go = new Go();
+WebAssembly.instantiate(fs.readFileSync(wasmPath), go.importObject).then((result) => {
+  go.run(result.instance);
+
+  check(typeof chip8 === "object", "chip8 global is defined");
+  check(chip8.displayWidth === 64 && chip8.displayHeight === 32, "display size is 64x32");
+
+  check(chip8.keymap().KeyW === 5, "the default keymap is the COSMAC layout");
+  check(chip8.keymap("arrows").ArrowUp === 2, "built-in keymaps are available by name");
+  check(chip8.keymap("nope") === null, "unknown keymaps are null");
+  check(chip8.keymaps.includes("numpad"), "built-in keymaps are listed");
+
+  // The ROM below, assigned to a profile by its SHA-1.
+  const config = {
+    default: "arrows",
+    profiles: { duel: { base: "cosmac", keys: { Space: 5 } } },
+    roms: { "87efb0e083915fe5b30542a9d95c221f84783a26": "duel" },
+  };
+  check(chip8.keymap(undefined, config).ArrowUp === 2, "a config's default is used without a ROM");
+  check(chip8.keymap("duel", JSON.stringify(config)).Space === 5, "profiles are available by name from JSON text");
+  check(typeof chip8.keymap("duel", { profiles: { duel: { base: "nope" } } }) === "string", "an invalid config is reported");
+
+  check(typeof chip8.create({ keymap: "{" }).error === "string", "create rejects an invalid keymap config");
+  check(typeof chip8.create({ audio: { volume: 2 } }).error === "string", "create rejects invalid audio settings");
+  const high = chip8.create({ audio: '{"frequency": 880}' }).audio();
+  check(high.enabled === true && high.frequency === 880 && high.volume === 0.25, "audio settings are laid over the defaults");
+
+  const m = chip8.create({ instructionsPerFrame: 10, keymap: config });
+  check(m.error === undefined, "create succeeds: " + m.error);
+  check(m.keymap().ArrowUp === 2, "the machine keymap is the config default before a ROM is loaded");
+  check(m.loadROM("not bytes") !== null, "loadROM rejects a string");
+
+  // Wait for a key, draw its glyph at 0, 0, then set the sound timer.
+  const rom = new Uint8Array([0xF0, 0x0A, 0xF0, 0x29, 0x61, 0x00, 0xD1, 0x15, 0x62, 0x10, 0xF2, 0x18, 0x12, 0x0C]);
+  check(m.loadROM(rom) === null, "loadROM succeeds");
+  check(m.keymap().Space === 5, "the machine keymap is the profile the config gives the ROM");
+  check(chip8.keymap(rom, config).Space === 5, "chip8.keymap picks the profile the config gives the ROM");
+
+  m.stepFrame();
+  let fb = m.framebuffer();
+  check(fb instanceof Uint8Array && fb.length === 64 * 32, "framebuffer is a 2048-byte Uint8Array");
+  check(fb.every((p) => p === 0), "screen is blank while waiting for a key");
+  check(m.soundActive() === false, "sound is off");
+
+  m.setKey(8, true);
+  m.stepFrame();
+  fb = m.framebuffer();
+  // The glyph for 8 starts with 0xF0: four lit pixels then dark.
+  check(fb[0] === 1 && fb[3] === 1 && fb[4] === 0, "glyph 8 is drawn");
+  check(m.soundActive() === true, "sound is on");
+
+  check(m.reset() === null, "reset succeeds");
+  check(m.framebuffer().every((p) => p === 0), "reset clears the screen");
+
+  console.log("ok");
+  process.exit(0);
+}).catch((err) => {
+  console.error(err);
+  process.exit(1);
+});
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWasmBridge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wasm build in short mode")
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroot := strings.TrimSpace(string(out))
+	wasmExec := filepath.Join(goroot, "lib", "wasm", "wasm_exec.js")
+	if _, err := os.Stat(wasmExec); err != nil {
+		wasmExec = filepath.Join(goroot, "misc", "wasm", "wasm_exec.js")
+	}
+	if _, err := os.Stat(wasmExec); err != nil {
+		t.Skip("wasm_exec.js not found")
+	}
+
+	wasm := filepath.Join(t.TempDir(), "chip8.wasm")
+	build := exec.Command("go", "build", "-o", wasm, ".")
+	build.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("wasm build failed: %v\n%s", err, out)
+	}
+
+	out, err = exec.Command(node, filepath.Join("testdata", "bridge_test.js"), wasmExec, wasm).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, out)
+	}
+	if strings.TrimSpace(string(out)) != "ok" {
+		t.Errorf("Expected ok, got %s", out)
+	}
+}
@@ -0,0 +1,17 @@
+// Package chip8 is the public, importable interface to the CHIP-8
+// interpreter.
+//
+// A Machine is created with New and configured with functional options.
+// Programs are loaded with LoadROM and driven either one instruction at a
+// time with Step or one 60 Hz frame at a time with StepFrame. State,
+// Framebuffer, SetKey and the timer accessors expose everything a
+// frontend needs without reaching into the interpreter itself.
+//
+// # Stability
+//
+// The exported API of this package follows semantic versioning: within a
+// major version, identifiers are not removed and their signatures and
+// documented behaviour do not change incompatibly. New options, methods
+// and State fields may be added in minor versions. Packages under
+// internal/ are implementation details and carry no such guarantee.
+package chip8
@@ -0,0 +1,38 @@
+package chip8_test
+
+import (
+	"fmt"
+
+	"github.com/pesos228/chip8"
+)
+
+func Example() {
+	m, err := chip8.New()
+	if err != nil {
+		panic(err)
+	}
+
+	// LD V0, 0xA; LD F, V0; DRW V1, V1, 5; JP 0x206
+	if err := m.LoadROM([]byte{0x60, 0x0A, 0xF0, 0x29, 0xD1, 0x15, 0x12, 0x06}); err != nil {
+		panic(err)
+	}
+
+	m.StepFrame()
+
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 4; x++ {
+			if m.Pixel(x, y) {
+				fmt.Print("#")
+			} else {
+				fmt.Print(".")
+			}
+		}
+		fmt.Println()
+	}
+	// Output:
+	// ####
+	// #..#
+	// ####
+	// #..#
+	// #..#
+}
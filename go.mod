@@ -1,3 +1,3 @@
-module chip8
+module github.com/pesos228/chip8
 
 go 1.24.4
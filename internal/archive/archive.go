@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/octo"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+// Program is one entry of a CHIP-8 Archive programs.json file. Keys
+// maps button names such as "up" or "a" to keypad indices.
+type Program struct {
+	Title    string           `json:"title"`
+	Authors  []string         `json:"authors,omitempty"`
+	Desc     string           `json:"desc,omitempty"`
+	Event    string           `json:"event,omitempty"`
+	Release  string           `json:"release,omitempty"`
+	Images   []string         `json:"images,omitempty"`
+	Platform string           `json:"platform,omitempty"`
+	Options  octo.Options     `json:"options"`
+	Keys     map[string]uint8 `json:"keys,omitempty"`
+}
+
+// Programs is a programs.json file, keyed by program id. The ROM for
+// program id is roms/<id>.ch8 in the archive.
+type Programs map[string]Program
+
+// Skipped is a program left out of an import and the reason why.
+type Skipped struct {
+	ID  string
+	Err error
+}
+
+// ErrNoROM is the reason given for a program whose ROM file is missing.
+var ErrNoROM = errors.New("no ROM file")
+
+// Parse reads a programs.json file. A program that does not decode is
+// skipped and returned rather than failing the whole file; only a file
+// that is not a JSON object is an error.
+func Parse(data []byte) (Programs, []Skipped, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	programs := Programs{}
+	var skipped []Skipped
+	for _, id := range sortedKeys(raw) {
+		var p Program
+		if err := json.Unmarshal(raw[id], &p); err != nil {
+			skipped = append(skipped, Skipped{id, err})
+			continue
+		}
+		programs[id] = p
+	}
+	return programs, skipped, nil
+}
+
+func Load(path string) (Programs, []Skipped, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	programs, skipped, err := Parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return programs, skipped, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const defaultProgramStart = 0x200
+
+// Config returns the interpreter configuration for the program. Memory
+// covers the program start plus the largest ROM the platform allows,
+// limited to what the interpreter can address.
+func (p Program) Config() cpu.Config {
+	memorySize := 4096
+	if p.Options.MaxSize > 0 {
+		memorySize = min(defaultProgramStart+int(p.Options.MaxSize), 0xFFFF)
+	}
+
+	return cpu.Config{
+		MemorySize:   uint16(memorySize),
+		ProgramStart: defaultProgramStart,
+		Quirks:       p.Options.Quirks(),
+	}
+}
+
+// hostKeys names the host key used for each of the archive's generic
+// button names. Names not listed are taken to be host key names already.
+var hostKeys = map[string]string{
+	"up":    "ArrowUp",
+	"down":  "ArrowDown",
+	"left":  "ArrowLeft",
+	"right": "ArrowRight",
+	"a":     "Space",
+	"b":     "Enter",
+}
+
+// Entry converts the program into a ROM database entry. Octo's tick rate
+// is already a count of instructions per frame.
+func (p Program) Entry() romdb.Entry {
+	e := romdb.Entry{
+		Title:                p.Title,
+		Platform:             p.Platform,
+		InstructionsPerFrame: int(p.Options.TickRate),
+		Quirks:               p.Options.Quirks(),
+		Colors:               p.Options.Colors(),
+	}
+
+	if len(p.Keys) > 0 {
+		e.Keymap = map[string]uint8{}
+		for name, index := range p.Keys {
+			if host, ok := hostKeys[name]; ok {
+				name = host
+			}
+			e.Keymap[name] = index
+		}
+	}
+
+	return e
+}
+
+// Catalog builds a ROM database from programs whose ROMs are found in
+// romDir as <id>.ch8. Programs without a ROM file, or whose entry the
+// database rejects, are skipped and returned; only a ROM that exists but
+// cannot be read is an error.
+func (programs Programs) Catalog(romDir string) (*romdb.DB, []Skipped, error) {
+	db := romdb.New()
+	var skipped []Skipped
+	var errs []error
+
+	for _, id := range sortedKeys(programs) {
+		rom, err := os.ReadFile(filepath.Join(romDir, id+".ch8"))
+		if errors.Is(err, os.ErrNotExist) {
+			skipped = append(skipped, Skipped{id, ErrNoROM})
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := db.Add(romdb.Hash(rom), programs[id].Entry()); err != nil {
+			skipped = append(skipped, Skipped{id, err})
+		}
+	}
+
+	return db, skipped, errors.Join(errs...)
+}
@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+const programsJSON = `{
+	"snake": {
+		"title": "Snake",
+		"authors": ["Someone"],
+		"event": "OctoJam 9",
+		"release": "2022-10-01",
+		"platform": "xochip",
+		"options": {
+			"tickrate": "1000",
+			"fillColor": "#FFFFFF",
+			"backgroundColor": "#000000",
+			"shiftQuirks": false,
+			"loadStoreQuirks": true,
+			"jumpQuirks": false,
+			"clipQuirks": true,
+			"maxSize": 65024
+		},
+		"keys": {"up": 5, "down": 8, "q": 4}
+	},
+	"missing": {
+		"title": "Not Downloaded",
+		"platform": "chip8",
+		"options": {"tickrate": 15}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	programs, skipped, err := Parse([]byte(programsJSON))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("Expected no skipped programs, got %v", skipped)
+	}
+
+	p := programs["snake"]
+	if p.Title != "Snake" || p.Options.TickRate != 1000 || p.Options.MaxSize != 65024 {
+		t.Errorf("Unexpected program %+v", p)
+	}
+}
+
+func TestParse_skipsMalformedPrograms(t *testing.T) {
+	programs, skipped, err := Parse([]byte(`{
+		"good": {"title": "Good", "options": {"tickrate": 15}},
+		"bad": {"title": "Bad", "options": {"tickrate": "fast"}}
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if _, ok := programs["good"]; !ok || len(programs) != 1 {
+		t.Errorf("Expected only the good program, got %v", programs)
+	}
+	if len(skipped) != 1 || skipped[0].ID != "bad" || skipped[0].Err == nil {
+		t.Errorf("Expected the bad program to be skipped with a reason, got %v", skipped)
+	}
+
+	if _, _, err := Parse([]byte(`[]`)); err == nil {
+		t.Errorf("Expected a file that is not an object to fail")
+	}
+}
+
+func TestProgram_Config(t *testing.T) {
+	programs, _, _ := Parse([]byte(programsJSON))
+
+	config := programs["snake"].Config()
+
+	if config.MemorySize != 0xFFFF || config.ProgramStart != 0x200 {
+		t.Errorf("Expected memory limited to 0xFFFF from 0x200, got %+v", config)
+	}
+
+	expected := cpu.Quirks{Shift: true}
+	if config.Quirks != expected {
+		t.Errorf("Expected quirks %+v, got %+v", expected, config.Quirks)
+	}
+
+	if programs["missing"].Config().MemorySize != 4096 {
+		t.Errorf("Expected 4096 bytes of memory without a maxSize")
+	}
+}
+
+func TestProgram_Entry(t *testing.T) {
+	programs, _, _ := Parse([]byte(programsJSON))
+
+	e := programs["snake"].Entry()
+
+	if e.InstructionsPerFrame != 1000 || e.Platform != "xochip" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	if e.Keymap["ArrowUp"] != 5 || e.Keymap["ArrowDown"] != 8 || e.Keymap["q"] != 4 {
+		t.Errorf("Expected button names mapped to host keys, got %v", e.Keymap)
+	}
+
+	if len(e.Colors) != 2 || e.Colors[0] != "#000000" {
+		t.Errorf("Expected background then fill colour, got %v", e.Colors)
+	}
+}
+
+func TestPrograms_Catalog(t *testing.T) {
+	programs, _, _ := Parse([]byte(programsJSON))
+
+	dir := t.TempDir()
+	rom := []byte{0x12, 0x00}
+	if err := os.WriteFile(filepath.Join(dir, "snake.ch8"), rom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	programs["badkeys"] = Program{Title: "Bad Keys", Keys: map[string]uint8{"a": 20}}
+	if err := os.WriteFile(filepath.Join(dir, "badkeys.ch8"), []byte{0x13, 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, skipped, err := programs.Catalog(dir)
+	if err != nil {
+		t.Fatalf("Catalog failed: %v", err)
+	}
+
+	if len(skipped) != 2 {
+		t.Fatalf("Expected two skipped programs, got %v", skipped)
+	}
+	if skipped[0].ID != "badkeys" || skipped[0].Err == nil {
+		t.Errorf("Expected the invalid entry to be skipped with a reason, got %v", skipped[0])
+	}
+	if skipped[1].ID != "missing" || !errors.Is(skipped[1].Err, ErrNoROM) {
+		t.Errorf("Expected the program without a ROM to be reported, got %v", skipped[1])
+	}
+
+	e, ok := db.Lookup(rom)
+	if !ok || e.Title != "Snake" {
+		t.Fatalf("Expected the catalog to contain Snake, got %+v", e)
+	}
+
+	data, err := db.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	reparsed, err := romdb.Parse(data)
+	if err != nil || reparsed.Len() != 1 {
+		t.Errorf("Expected the catalog to round-trip through romdb.Parse, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package batch runs many independent machines in lockstep, for
+// reinforcement-learning training and for compatibility sweeps over many
+// ROMs or settings.
+//
+// The machines live in one contiguous array with their memories in a
+// single slab, and a fixed pool of workers each owns a contiguous range
+// of them. Once a batch is built, Step, SetKeys, Observe and Reset do not
+// allocate.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+// ObservationSize is the number of bytes Observe writes per machine: the
+// display, one byte per pixel.
+const ObservationSize = cpu.DisplayWidth * cpu.DisplayHeight
+
+type Config struct {
+	MemorySize           uint16
+	ProgramStart         uint16
+	InstructionsPerFrame int
+	// FramesPerStep is how many frames each call to Step runs.
+	FramesPerStep int
+	// Workers defaults to GOMAXPROCS and is capped at the number of
+	// machines.
+	Workers int
+	// Seed seeds machine i's random numbers with Seed+i.
+	Seed int64
+}
+
+type Batch struct {
+	cpus   []cpu.Cpu
+	roms   []*loader.ROM
+	config Config
+
+	work []chan struct{}
+	done sync.WaitGroup
+}
+
+// New creates n machines. Load a ROM into them before stepping. Close
+// stops the workers.
+func New(n int, config Config) (*Batch, error) {
+	if config.MemorySize == 0 {
+		config.MemorySize = 4096
+	}
+	if config.ProgramStart == 0 {
+		config.ProgramStart = 0x200
+	}
+	if config.InstructionsPerFrame == 0 {
+		config.InstructionsPerFrame = 10
+	}
+	if config.FramesPerStep == 0 {
+		config.FramesPerStep = 1
+	}
+	if config.Workers == 0 {
+		config.Workers = runtime.GOMAXPROCS(0)
+	}
+	config.Workers = min(config.Workers, n)
+
+	var errs []error
+	if n < 1 {
+		errs = append(errs, fmt.Errorf("batch size %d must be at least 1", n))
+	}
+	if config.InstructionsPerFrame < 1 {
+		errs = append(errs, fmt.Errorf("instructions per frame %d must be at least 1", config.InstructionsPerFrame))
+	}
+	if config.FramesPerStep < 1 {
+		errs = append(errs, fmt.Errorf("frames per step %d must be at least 1", config.FramesPerStep))
+	}
+	if config.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers %d is negative", config.Workers))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	b := &Batch{
+		cpus:   cpu.NewCpus(n, config.MemorySize, config.ProgramStart, config.Seed),
+		roms:   make([]*loader.ROM, n),
+		config: config,
+		work:   make([]chan struct{}, config.Workers),
+	}
+	for w := range b.work {
+		b.work[w] = make(chan struct{})
+		go b.worker(b.work[w], w*n/config.Workers, (w+1)*n/config.Workers)
+	}
+	return b, nil
+}
+
+func (b *Batch) worker(work chan struct{}, start, end int) {
+	for range work {
+		for i := start; i < end; i++ {
+			b.run(&b.cpus[i])
+		}
+		b.done.Done()
+	}
+}
+
+func (b *Batch) run(c *cpu.Cpu) {
+	for f := 0; f < b.config.FramesPerStep; f++ {
+		for i := 0; i < b.config.InstructionsPerFrame; i++ {
+			c.Execute()
+		}
+		c.TickTimers()
+	}
+}
+
+// Close stops the workers. The batch must not be stepped afterwards.
+func (b *Batch) Close() {
+	for _, work := range b.work {
+		close(work)
+	}
+}
+
+func (b *Batch) Len() int {
+	return len(b.cpus)
+}
+
+// Machine returns machine i, for setting it up or inspecting it between
+// steps.
+func (b *Batch) Machine(i int) *cpu.Cpu {
+	return &b.cpus[i]
+}
+
+// LoadAll loads rom into every machine.
+func (b *Batch) LoadAll(rom *loader.ROM) error {
+	for i := range b.cpus {
+		if err := b.Load(i, rom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load loads rom into machine i; Reset restarts it from there. Different
+// machines may run different ROMs.
+func (b *Batch) Load(i int, rom *loader.ROM) error {
+	if err := rom.Load(&b.cpus[i]); err != nil {
+		return err
+	}
+	b.roms[i] = rom
+	return nil
+}
+
+// Reset restarts machine i's ROM and reseeds its random numbers with
+// seed.
+func (b *Batch) Reset(i int, seed int64) error {
+	c := &b.cpus[i]
+	if b.roms[i] == nil {
+		c.Reset()
+	} else if err := b.roms[i].Load(c); err != nil {
+		return err
+	}
+	c.Keys = [16]bool{}
+	c.Rand.Seed(seed)
+	return nil
+}
+
+// SetKeys sets every machine's keypad from a bit mask per machine, bit n
+// for key n.
+func (b *Batch) SetKeys(keys []uint16) {
+	if len(keys) != len(b.cpus) {
+		panic(fmt.Sprintf("batch: %d key masks for %d machines", len(keys), len(b.cpus)))
+	}
+	for i := range b.cpus {
+		for key := range b.cpus[i].Keys {
+			b.cpus[i].Keys[key] = keys[i]&(1<<key) != 0
+		}
+	}
+}
+
+// Step advances every machine by FramesPerStep frames and returns when
+// all of them are done.
+func (b *Batch) Step() {
+	b.done.Add(len(b.work))
+	for _, work := range b.work {
+		work <- struct{}{}
+	}
+	b.done.Wait()
+}
+
+// Observe copies every display into dst, ObservationSize bytes per
+// machine in order.
+func (b *Batch) Observe(dst []uint8) {
+	if len(dst) != len(b.cpus)*ObservationSize {
+		panic(fmt.Sprintf("batch: observation buffer is %d bytes, need %d", len(dst), len(b.cpus)*ObservationSize))
+	}
+	for i := range b.cpus {
+		copy(dst[i*ObservationSize:], b.cpus[i].Display[:])
+	}
+}
+
+// Instructions is the number of instructions one Step executes across
+// the batch.
+func (b *Batch) Instructions() int {
+	return len(b.cpus) * b.config.FramesPerStep * b.config.InstructionsPerFrame
+}
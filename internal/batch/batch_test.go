@@ -0,0 +1,151 @@
+package batch
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+// scribble draws digit glyphs at random positions forever.
+var scribble = []byte{
+	0xC0, 0x3F, // RND V0, 0x3F
+	0xC1, 0x1F, // RND V1, 0x1F
+	0xF2, 0x29, // LD F, V2
+	0xD0, 0x15, // DRW V0, V1, 5
+	0x72, 0x01, // ADD V2, 1
+	0x12, 0x00, // JP 0x200
+}
+
+func newBatch(t testing.TB, n int, config Config) *Batch {
+	t.Helper()
+
+	b, err := New(n, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Close)
+
+	rom, err := loader.Parse("scribble.ch8", scribble)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.LoadAll(rom); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMatchesSingleMachines(t *testing.T) {
+	const n = 37
+	b := newBatch(t, n, Config{Workers: 4, FramesPerStep: 3, Seed: 100})
+
+	keys := make([]uint16, n)
+	for i := range keys {
+		keys[i] = uint16(i)
+	}
+	b.SetKeys(keys)
+	for step := 0; step < 20; step++ {
+		b.Step()
+	}
+	obs := make([]uint8, n*ObservationSize)
+	b.Observe(obs)
+
+	for i := 0; i < n; i++ {
+		c := cpu.NewCpu(4096, 0x200)
+		c.LoadGame(scribble)
+		c.Rand.Seed(100 + int64(i))
+		for f := 0; f < 20*3; f++ {
+			for j := 0; j < 10; j++ {
+				c.Execute()
+			}
+			c.TickTimers()
+		}
+
+		if !bytes.Equal(obs[i*ObservationSize:(i+1)*ObservationSize], c.Display[:]) {
+			t.Errorf("Expected machine %d to match a machine run on its own", i)
+		}
+		if b.Machine(i).Pc != c.Pc || b.Machine(i).Registers != c.Registers {
+			t.Errorf("Expected machine %d to have PC 0x%X and registers %v, got 0x%X and %v", i, c.Pc, c.Registers, b.Machine(i).Pc, b.Machine(i).Registers)
+		}
+		if b.Machine(i).Keys[0] != (i&1 != 0) {
+			t.Errorf("Expected machine %d key 0 to follow its mask", i)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	b := newBatch(t, 2, Config{Workers: 2})
+
+	b.Step()
+	first := b.Machine(0).Display
+	b.Step()
+
+	if err := b.Reset(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if b.Machine(0).Display != ([ObservationSize]uint8{}) || b.Machine(0).Pc != 0x200 {
+		t.Errorf("Expected machine 0 to restart, got PC 0x%X", b.Machine(0).Pc)
+	}
+	if b.Machine(1).Pc == 0x200 && b.Machine(1).Display == ([ObservationSize]uint8{}) {
+		t.Errorf("Expected machine 1 to be left alone")
+	}
+
+	b.Step()
+	if b.Machine(0).Display != first {
+		t.Errorf("Expected a reset with the original seed to replay the first step")
+	}
+}
+
+func TestNoAllocations(t *testing.T) {
+	const n = 64
+	b := newBatch(t, n, Config{Workers: 4})
+	keys := make([]uint16, n)
+	obs := make([]uint8, n*ObservationSize)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b.SetKeys(keys)
+		b.Step()
+		b.Observe(obs)
+		if err := b.Reset(3, 7); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations per step, got %v", allocs)
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	if _, err := New(0, Config{FramesPerStep: -1}); err == nil {
+		t.Errorf("Expected an empty batch with negative frames to be rejected")
+	}
+}
+
+// BenchmarkStep reports the throughput of the whole batch in
+// instructions per second.
+func BenchmarkStep(b *testing.B) {
+	for _, n := range []int{1, 64, 1024, 4096} {
+		b.Run(fmt.Sprintf("machines=%d", n), func(b *testing.B) {
+			batch := newBatch(b, n, Config{FramesPerStep: 4})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch.Step()
+			}
+			b.ReportMetric(float64(b.N)*float64(batch.Instructions())/b.Elapsed().Seconds(), "instr/s")
+		})
+	}
+}
+
+func BenchmarkObserve(b *testing.B) {
+	batch := newBatch(b, 1024, Config{})
+	obs := make([]uint8, batch.Len()*ObservationSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch.Observe(obs)
+	}
+}
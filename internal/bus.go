@@ -0,0 +1,125 @@
+package cpu
+
+type Device interface {
+	Read(addr uint16) uint8
+	Write(addr uint16, value uint8)
+}
+
+// Bus carries every memory access the interpreter makes. Fetch reads the
+// two bytes of the opcode at addr as an execute access.
+type Bus interface {
+	Device
+	Fetch(addr uint16) uint16
+}
+
+type Hook func(addr uint16, value uint8)
+
+// addrRange is the half-open range [start, end).
+type addrRange struct {
+	start, end uint16
+}
+
+func (r addrRange) contains(addr uint16) bool {
+	return addr >= r.start && addr < r.end
+}
+
+type hook struct {
+	addrRange
+	fn Hook
+}
+
+type mapping struct {
+	addrRange
+	device Device
+}
+
+// MemoryBus is a Bus over a Cpu's memory slice. Hooks observe accesses
+// in an address range, read-only ranges drop writes, and mapped devices
+// take over reads and writes for their range entirely.
+type MemoryBus struct {
+	memory       []uint8
+	readHooks    []hook
+	writeHooks   []hook
+	executeHooks []hook
+	readOnly     []addrRange
+	devices      []mapping
+}
+
+func NewMemoryBus(memory []uint8) *MemoryBus {
+	return &MemoryBus{memory: memory}
+}
+
+func (b *MemoryBus) OnRead(start, end uint16, fn Hook) {
+	b.readHooks = append(b.readHooks, hook{addrRange{start, end}, fn})
+}
+
+func (b *MemoryBus) OnWrite(start, end uint16, fn Hook) {
+	b.writeHooks = append(b.writeHooks, hook{addrRange{start, end}, fn})
+}
+
+func (b *MemoryBus) OnExecute(start, end uint16, fn Hook) {
+	b.executeHooks = append(b.executeHooks, hook{addrRange{start, end}, fn})
+}
+
+func (b *MemoryBus) ReadOnly(start, end uint16) {
+	b.readOnly = append(b.readOnly, addrRange{start, end})
+}
+
+func (b *MemoryBus) Map(start, end uint16, device Device) {
+	b.devices = append(b.devices, mapping{addrRange{start, end}, device})
+}
+
+func (b *MemoryBus) Read(addr uint16) uint8 {
+	value := b.load(addr)
+	notify(b.readHooks, addr, value)
+	return value
+}
+
+func (b *MemoryBus) Write(addr uint16, value uint8) {
+	notify(b.writeHooks, addr, value)
+
+	for _, m := range b.devices {
+		if m.contains(addr) {
+			m.device.Write(addr, value)
+			return
+		}
+	}
+
+	for _, r := range b.readOnly {
+		if r.contains(addr) {
+			return
+		}
+	}
+
+	b.memory[addr] = value
+}
+
+func (b *MemoryBus) Fetch(addr uint16) uint16 {
+	next := addr + 1
+	if int(next) >= len(b.memory) {
+		next = 0
+	}
+
+	hi := b.load(addr)
+	lo := b.load(next)
+	notify(b.executeHooks, addr, hi)
+	notify(b.executeHooks, next, lo)
+	return uint16(hi)<<8 | uint16(lo)
+}
+
+func (b *MemoryBus) load(addr uint16) uint8 {
+	for _, m := range b.devices {
+		if m.contains(addr) {
+			return m.device.Read(addr)
+		}
+	}
+	return b.memory[addr]
+}
+
+func notify(hooks []hook, addr uint16, value uint8) {
+	for _, h := range hooks {
+		if h.contains(addr) {
+			h.fn(addr, value)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cpu
+
+import (
+	"testing"
+)
+
+type testDevice struct {
+	values map[uint16]uint8
+}
+
+func (d *testDevice) Read(addr uint16) uint8 {
+	return d.values[addr]
+}
+
+func (d *testDevice) Write(addr uint16, value uint8) {
+	d.values[addr] = value
+}
+
+func TestMemoryBus_hooks(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	bus := NewMemoryBus(cpu.Memory)
+	cpu.Bus = bus
+
+	var executed []uint16
+	bus.OnExecute(0x100, 0x200, func(addr uint16, value uint8) {
+		executed = append(executed, addr)
+	})
+
+	var reads, writes int
+	bus.OnRead(0x180, 0x190, func(addr uint16, value uint8) { reads++ })
+	bus.OnWrite(0x180, 0x190, func(addr uint16, value uint8) { writes++ })
+
+	cpu.Memory[0x100] = 0x61
+	cpu.Memory[0x101] = 0x05
+
+	cpu.Execute()
+
+	if len(executed) != 2 || executed[0] != 0x100 || executed[1] != 0x101 {
+		t.Errorf("Expected execute hooks for 0x100 and 0x101, got %X", executed)
+	}
+
+	if cpu.Registers[1] != 5 {
+		t.Errorf("Expected V1 to be 5, got %d", cpu.Registers[1])
+	}
+
+	cpu.write(0x185, 7)
+	cpu.read(0x185)
+	cpu.read(0x190)
+
+	if reads != 1 || writes != 1 {
+		t.Errorf("Expected 1 read and 1 write hook call, got %d and %d", reads, writes)
+	}
+}
+
+func TestMemoryBus_readOnly(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	bus := NewMemoryBus(cpu.Memory)
+	bus.ReadOnly(0, 0x100)
+	cpu.Bus = bus
+
+	cpu.Memory[0x50] = 0xAA
+
+	cpu.write(0x50, 0x11)
+	cpu.write(0x100, 0x22)
+
+	if cpu.Memory[0x50] != 0xAA {
+		t.Errorf("Expected read-only byte to stay 0xAA, got 0x%X", cpu.Memory[0x50])
+	}
+
+	if cpu.Memory[0x100] != 0x22 {
+		t.Errorf("Expected writable byte to be 0x22, got 0x%X", cpu.Memory[0x100])
+	}
+}
+
+func TestMemoryBus_device(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	bus := NewMemoryBus(cpu.Memory)
+	device := &testDevice{values: map[uint16]uint8{0x1F0: 0x42}}
+	bus.Map(0x1F0, 0x200, device)
+	cpu.Bus = bus
+
+	if v := cpu.read(0x1F0); v != 0x42 {
+		t.Errorf("Expected mapped read to be 0x42, got 0x%X", v)
+	}
+
+	cpu.write(0x1F1, 0x99)
+
+	if device.values[0x1F1] != 0x99 {
+		t.Errorf("Expected device to receive the write, got 0x%X", device.values[0x1F1])
+	}
+
+	if cpu.Memory[0x1F1] != 0 {
+		t.Errorf("Expected backing memory to be untouched, got 0x%X", cpu.Memory[0x1F1])
+	}
+}
+
+func TestMemoryBus_survivesReset(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Bus = NewMemoryBus(cpu.Memory)
+
+	cpu.LoadGame([]uint8{0x63, 0x09})
+	cpu.Execute()
+
+	if cpu.Registers[3] != 9 {
+		t.Errorf("Expected V3 to be 9 after reset and load, got %d", cpu.Registers[3])
+	}
+}
+
+func benchmarkExecute(b *testing.B, cpu *Cpu) {
+	cpu.LoadGame([]uint8{0x71, 0x01, 0x11, 0x00})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cpu.Execute()
+	}
+}
+
+func BenchmarkExecute_direct(b *testing.B) {
+	benchmarkExecute(b, NewCpu(512, 0x100))
+}
+
+func BenchmarkExecute_bus(b *testing.B) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Bus = NewMemoryBus(cpu.Memory)
+	benchmarkExecute(b, cpu)
+}
@@ -0,0 +1,168 @@
+// Package cheat changes a running game through Cpu.Memory without
+// touching the ROM: codes freeze addresses to values every frame, and a
+// Search narrows down which address holds a value such as the number of
+// lives.
+//
+// Cheat files hold one code per line as address:value in hexadecimal,
+// with # starting a comment:
+//
+//	# Space Invaders
+//	0x2F4:03   # infinite lives
+//	2F5:09     # start on level 10
+package cheat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+// Extension is the file extension of a cheat file that sits next to its
+// ROM.
+const Extension = ".cht"
+
+type Code struct {
+	Address uint16
+	Value   uint8
+	Comment string
+}
+
+func (c Code) String() string {
+	s := fmt.Sprintf("0x%03X:%02X", c.Address, c.Value)
+	if c.Comment != "" {
+		s += " # " + c.Comment
+	}
+	return s
+}
+
+// Parse reads codes in the cheat file format, reporting every malformed
+// line.
+func Parse(r io.Reader) ([]Code, error) {
+	var codes []Code
+	var errs []error
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, comment, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		code, err := parseCode(text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		code.Comment = strings.TrimSpace(comment)
+		codes = append(codes, code)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func parseCode(text string) (Code, error) {
+	address, value, ok := strings.Cut(text, ":")
+	if !ok {
+		return Code{}, fmt.Errorf("%q: expected address:value", text)
+	}
+
+	a, err := parseHex(address, 16)
+	if err != nil {
+		return Code{}, fmt.Errorf("%q: address: %w", text, err)
+	}
+	v, err := parseHex(value, 8)
+	if err != nil {
+		return Code{}, fmt.Errorf("%q: value: %w", text, err)
+	}
+	return Code{Address: uint16(a), Value: uint8(v)}, nil
+}
+
+func parseHex(s string, bits int) (uint64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return strconv.ParseUint(s, 16, bits)
+}
+
+func LoadFile(path string) ([]Code, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	codes, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return codes, nil
+}
+
+// PathFor returns where the cheat file for the ROM at romPath lives: the
+// same name with Extension in place of the ROM's extension.
+func PathFor(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + Extension
+}
+
+// Set is a list of frozen addresses. The zero value is empty and ready to
+// use.
+type Set struct {
+	codes []Code
+}
+
+func NewSet(codes []Code) *Set {
+	s := &Set{}
+	for _, code := range codes {
+		s.Freeze(code)
+	}
+	return s
+}
+
+// Freeze holds code.Address at code.Value, replacing any earlier code for
+// the same address.
+func (s *Set) Freeze(code Code) {
+	for i := range s.codes {
+		if s.codes[i].Address == code.Address {
+			s.codes[i] = code
+			return
+		}
+	}
+	s.codes = append(s.codes, code)
+}
+
+// Unfreeze releases address and reports whether it was frozen.
+func (s *Set) Unfreeze(address uint16) bool {
+	i := slices.IndexFunc(s.codes, func(c Code) bool { return c.Address == address })
+	if i < 0 {
+		return false
+	}
+	s.codes = slices.Delete(s.codes, i, i+1)
+	return true
+}
+
+func (s *Set) Codes() []Code {
+	return slices.Clone(s.codes)
+}
+
+// Apply writes every frozen value into memory. Frontends call it once
+// per frame. Addresses outside memory are skipped.
+func (s *Set) Apply(c *cpu.Cpu) {
+	for _, code := range s.codes {
+		if int(code.Address) < len(c.Memory) {
+			c.Memory[code.Address] = code.Value
+		}
+	}
+}
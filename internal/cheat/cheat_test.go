@@ -0,0 +1,110 @@
+package cheat
+
+import (
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+func TestParse(t *testing.T) {
+	codes, err := Parse(strings.NewReader(`# Space Invaders
+0x2F4:03   # infinite lives
+
+2f5 : 9
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Code{{Address: 0x2F4, Value: 3, Comment: "infinite lives"}, {Address: 0x2F5, Value: 9}}
+	if len(codes) != len(want) {
+		t.Fatalf("Expected %d codes, got %v", len(want), codes)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("Expected code %d to be %v, got %v", i, want[i], codes[i])
+		}
+	}
+
+	if got := codes[0].String(); got != "0x2F4:03 # infinite lives" {
+		t.Errorf("Expected the code to print as it is written, got %q", got)
+	}
+}
+
+func TestParseReportsEveryLine(t *testing.T) {
+	_, err := Parse(strings.NewReader("2F4\n2F4:100\n10000:1\n"))
+	if err == nil {
+		t.Fatal("Expected malformed codes to be rejected")
+	}
+	for _, want := range []string{"line 1", "line 2", "line 3"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestPathFor(t *testing.T) {
+	if got := PathFor("roms/invaders.ch8"); got != "roms/invaders.cht" {
+		t.Errorf("Expected roms/invaders.cht, got %s", got)
+	}
+}
+
+func TestSetFreezesEveryApply(t *testing.T) {
+	c := cpu.NewCpu(4096, 0x200)
+	set := NewSet([]Code{{Address: 0x300, Value: 3}, {Address: 0x301, Value: 1}, {Address: 0x300, Value: 5}})
+
+	if len(set.Codes()) != 2 {
+		t.Errorf("Expected a later code to replace one for the same address, got %v", set.Codes())
+	}
+
+	c.Memory[0x300] = 0
+	set.Apply(c)
+	if c.Memory[0x300] != 5 || c.Memory[0x301] != 1 {
+		t.Errorf("Expected 5 and 1 after Apply, got %d and %d", c.Memory[0x300], c.Memory[0x301])
+	}
+
+	if !set.Unfreeze(0x300) || set.Unfreeze(0x300) {
+		t.Errorf("Expected Unfreeze to report whether the address was frozen")
+	}
+	c.Memory[0x300] = 0
+	set.Apply(c)
+	if c.Memory[0x300] != 0 {
+		t.Errorf("Expected an unfrozen address to be left alone, got %d", c.Memory[0x300])
+	}
+
+	set.Freeze(Code{Address: 0xFFFF, Value: 1})
+	set.Apply(c)
+}
+
+func TestSearch(t *testing.T) {
+	c := cpu.NewCpu(4096, 0x200)
+	c.Memory[0x300] = 3 // lives
+	c.Memory[0x301] = 3 // something else that happens to match
+	c.Memory[0x302] = 7
+
+	s := NewSearch(c)
+	if n := s.Equal(3); n != 2 {
+		t.Errorf("Expected 2 addresses holding 3, got %d", n)
+	}
+
+	c.Memory[0x300] = 2
+	c.Memory[0x302] = 6
+	if n := s.Decreased(); n != 1 {
+		t.Errorf("Expected 1 address to have decreased among the candidates, got %d", n)
+	}
+	if got := s.Candidates(); len(got) != 1 || got[0] != 0x300 {
+		t.Errorf("Expected 0x300 to be found, got %v", got)
+	}
+
+	if n := s.Unchanged(); n != 1 {
+		t.Errorf("Expected the lives to be unchanged, got %d candidates", n)
+	}
+	c.Memory[0x300] = 9
+	if n := s.Increased(); n != 1 {
+		t.Errorf("Expected the lives to have increased, got %d candidates", n)
+	}
+	if n := s.Changed(); n != 0 {
+		t.Errorf("Expected nothing to have changed since, got %d candidates", n)
+	}
+}
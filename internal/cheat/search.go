@@ -0,0 +1,81 @@
+package cheat
+
+import (
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+// Search finds the addresses of a value by elimination. It starts with
+// every address in memory as a candidate; each narrowing step compares
+// memory now with the value an address had, either against a known value
+// or against the previous step, and drops the addresses that do not fit.
+//
+// For lives in a game: start a search, lose a life, narrow with
+// Decreased, lose another, narrow again, then check Equal with the count
+// shown on screen.
+type Search struct {
+	cpu        *cpu.Cpu
+	candidates []uint16
+	previous   []uint8
+}
+
+func NewSearch(c *cpu.Cpu) *Search {
+	s := &Search{
+		cpu:        c,
+		candidates: make([]uint16, len(c.Memory)),
+		previous:   make([]uint8, len(c.Memory)),
+	}
+	for i := range s.candidates {
+		s.candidates[i] = uint16(i)
+	}
+	copy(s.previous, c.Memory)
+	return s
+}
+
+// Equal keeps the addresses that hold value.
+func (s *Search) Equal(value uint8) int {
+	return s.narrow(func(old, now uint8) bool { return now == value })
+}
+
+// Changed keeps the addresses whose value differs from the last step.
+func (s *Search) Changed() int {
+	return s.narrow(func(old, now uint8) bool { return now != old })
+}
+
+func (s *Search) Unchanged() int {
+	return s.narrow(func(old, now uint8) bool { return now == old })
+}
+
+func (s *Search) Decreased() int {
+	return s.narrow(func(old, now uint8) bool { return now < old })
+}
+
+func (s *Search) Increased() int {
+	return s.narrow(func(old, now uint8) bool { return now > old })
+}
+
+// narrow keeps the candidates for which keep holds and returns how many
+// are left.
+func (s *Search) narrow(keep func(old, now uint8) bool) int {
+	memory := s.cpu.Memory
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if int(addr) >= len(memory) {
+			continue
+		}
+		if keep(s.previous[addr], memory[addr]) {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+
+	if len(s.previous) != len(memory) {
+		s.previous = make([]uint8, len(memory))
+	}
+	copy(s.previous, memory)
+	return len(s.candidates)
+}
+
+// Candidates returns the addresses still in the running, in order.
+func (s *Search) Candidates() []uint16 {
+	return append([]uint16(nil), s.candidates...)
+}
@@ -0,0 +1,142 @@
+package cpu
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// ADD V0, 1; LD I, 0x180; LD [I], V0; RND V1, 0xFF; JP 0x100
+var counterProgram = []uint8{0x70, 0x01, 0xA1, 0x80, 0xF0, 0x55, 0xC1, 0xFF, 0x11, 0x00}
+
+func runCounter(seed int64, steps int) Snapshot {
+	cpu := NewCpu(512, 0x100)
+	cpu.Rand = rand.New(rand.NewSource(seed))
+	cpu.LoadGame(counterProgram)
+	for i := 0; i < steps; i++ {
+		cpu.Execute()
+	}
+	return cpu.Snapshot()
+}
+
+func TestCpu_parallelInstances(t *testing.T) {
+	const instances = 300
+	const steps = 5000
+
+	var wg sync.WaitGroup
+	results := make([]Snapshot, instances)
+
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runCounter(int64(i%10), steps)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		want := runCounter(int64(i%10), steps)
+		if got.Registers != want.Registers || got.Memory[0x180] != want.Memory[0x180] {
+			t.Fatalf("Expected instance %d to match a sequential run, got V=%X want V=%X", i, got.Registers, want.Registers)
+		}
+	}
+}
+
+func TestCpu_snapshotWhileRunning(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.LoadGame(counterProgram)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20000; i++ {
+			cpu.Execute()
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		s := cpu.Snapshot()
+		if s.I != 0x180 {
+			continue
+		}
+		if diff := s.Registers[0] - s.Memory[0x180]; diff > 1 {
+			t.Fatalf("Expected V0 to be at most one ahead of memory, got V0=%d mem=%d", s.Registers[0], s.Memory[0x180])
+		}
+	}
+}
+
+func TestCpu_Restore(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.LoadGame(counterProgram)
+	for i := 0; i < 7; i++ {
+		cpu.Execute()
+	}
+
+	s := cpu.Snapshot()
+
+	for i := 0; i < 7; i++ {
+		cpu.Execute()
+	}
+
+	if err := cpu.Restore(s); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if cpu.Registers != s.Registers || cpu.Pc != s.Pc || cpu.Memory[0x180] != s.Memory[0x180] {
+		t.Errorf("Expected restored state to match the snapshot")
+	}
+
+	if err := NewCpu(256, 0x100).Restore(s); err == nil {
+		t.Errorf("Expected restoring into a different memory size to fail")
+	}
+
+	bad := s
+	bad.Sp = 17
+	if err := cpu.Restore(bad); err == nil {
+		t.Errorf("Expected restoring an SP deeper than the stack to fail")
+	}
+
+	bad = s
+	bad.Pc = 512
+	if err := cpu.Restore(bad); err == nil {
+		t.Errorf("Expected restoring a PC outside memory to fail")
+	}
+}
+
+func TestCpu_SnapshotWrapsPc(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Pc = 0x202
+
+	if s := cpu.Snapshot(); s.Pc != 0x002 {
+		t.Errorf("Expected snapshot PC 0x2, got 0x%X", s.Pc)
+	}
+}
+
+func TestNewCpus_independentMemory(t *testing.T) {
+	cpus := NewCpus(3, 512, 0x100, 0)
+
+	for i := range cpus {
+		cpus[i].LoadGame(counterProgram)
+		for step := 0; step <= i; step++ {
+			for j := 0; j < 5; j++ {
+				cpus[i].Execute()
+			}
+		}
+	}
+
+	for i := range cpus {
+		if got := cpus[i].Memory[0x180]; got != uint8(i+1) {
+			t.Errorf("Expected machine %d to count to %d, got %d", i, i+1, got)
+		}
+		if cap(cpus[i].Memory) != 512 {
+			t.Errorf("Expected machine %d's memory capacity to stop at its own 512 bytes, got %d", i, cap(cpus[i].Memory))
+		}
+	}
+}
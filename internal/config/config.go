@@ -0,0 +1,517 @@
+// Package config reads emulator settings from layered JSON files. Each
+// layer sets only the fields it names, on top of the ones before it:
+// the defaults, the user's config.json, the ROM database entry, the file
+// next to the ROM, then the command line. The ROM itself can sit between
+// the user's file and the database entry: its extension hints at a
+// platform and Octo cartridges carry quirks.
+//
+//	{
+//	  "platform": "schip",
+//	  "memorySize": 4096,
+//	  "programStart": "0x200",
+//	  "instructionsPerFrame": 30,
+//	  "quirks": {"wrap": true},
+//	  "palette": ["#000000", "#33ff66"],
+//	  "decay": 0.5,
+//	  "steady": true,
+//	  "keymap": "arrows",
+//	  "audio": {"enabled": true, "frequency": 440, "volume": 0.25}
+//	}
+//
+// Choosing a platform sets all quirks to that platform's; quirks named in
+// the same or a later layer then apply on top.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+// Extension is the extension of the config file kept next to a ROM.
+const Extension = ".json"
+
+// Audio is the buzzer sound frontends play while the sound timer runs.
+type Audio struct {
+	Enabled   bool
+	Frequency float64 // Hz
+	Volume    float64 // 0 to 1
+}
+
+// Settings are the resolved values of every layer.
+type Settings struct {
+	Platform             string
+	MemorySize           int
+	ProgramStart         int
+	InstructionsPerFrame int
+	Quirks               cpu.Quirks
+
+	// Palette holds "#rrggbb" colors, the background first then the
+	// color of lit pixels and, for XO-CHIP, the other two planes.
+	Palette []string
+
+	// Decay is how much of a pixel's glow is left one frame after it goes
+	// dark, from 0 for none to below 1. Steady holds back frames that
+	// only erase pixels, hiding the flicker of XOR redraws.
+	Decay  float64
+	Steady bool
+
+	// Keymap names the keymap profile to play with. When empty the keymap
+	// is picked per ROM.
+	Keymap string
+
+	Audio Audio
+}
+
+// Defaults returns the settings used where no layer says otherwise.
+func Defaults() Settings {
+	return Settings{
+		Platform:             "modern",
+		MemorySize:           4096,
+		ProgramStart:         0x200,
+		InstructionsPerFrame: 10,
+		Palette:              []string{"#000000", "#ffffff"},
+		Audio:                Audio{Enabled: true, Frequency: 440, Volume: 0.25},
+	}
+}
+
+// platforms are the quirks of each interpreter. CHIP-48 and SUPER-CHIP
+// also advance I by x rather than x + 1 on Fx55 and Fx65, which no quirk
+// models; modern is what most games written today expect, with none.
+var platforms = map[string]cpu.Quirks{
+	"chip8":  {Shift: true, MemoryIncrement: true, VfReset: true},
+	"chip48": {Jump: true},
+	"schip":  {Jump: true},
+	"xochip": {Shift: true, MemoryIncrement: true, Wrap: true},
+	"modern": {},
+}
+
+// PlatformQuirks returns the quirks of a platform: chip8, chip48, schip,
+// xochip or modern.
+func PlatformQuirks(platform string) (cpu.Quirks, bool) {
+	q, ok := platforms[platform]
+	return q, ok
+}
+
+// Cpu returns the Cpu configuration of s.
+func (s Settings) Cpu() cpu.Config {
+	return cpu.Config{
+		MemorySize:   uint16(s.MemorySize),
+		ProgramStart: uint16(s.ProgramStart),
+		Quirks:       s.Quirks,
+	}
+}
+
+// Number is an integer written in JSON as a number or as a string such
+// as "0x200".
+type Number int
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return fmt.Errorf("number %q: %w", s, err)
+		}
+		*n = Number(v)
+		return nil
+	}
+
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*n = Number(v)
+	return nil
+}
+
+// Layer is one source of settings. Nil fields leave the value of the
+// layers below.
+type Layer struct {
+	Platform             *string     `json:"platform"`
+	MemorySize           *Number     `json:"memorySize"`
+	ProgramStart         *Number     `json:"programStart"`
+	InstructionsPerFrame *int        `json:"instructionsPerFrame"`
+	Quirks               QuirksLayer `json:"quirks"`
+	Palette              []string    `json:"palette"`
+	Decay                *float64    `json:"decay"`
+	Steady               *bool       `json:"steady"`
+	Keymap               *string     `json:"keymap"`
+	Audio                AudioLayer  `json:"audio"`
+}
+
+type QuirksLayer struct {
+	Shift           *bool `json:"shift"`
+	MemoryIncrement *bool `json:"memoryIncrement"`
+	Jump            *bool `json:"jump"`
+	VfReset         *bool `json:"vfReset"`
+	Wrap            *bool `json:"wrap"`
+}
+
+type AudioLayer struct {
+	Enabled   *bool    `json:"enabled"`
+	Frequency *float64 `json:"frequency"`
+	Volume    *float64 `json:"volume"`
+}
+
+// fields are the JSON names of a layer's fields and where to decode them.
+func (l *Layer) fields() map[string]any {
+	return map[string]any{
+		"platform":             &l.Platform,
+		"memorySize":           &l.MemorySize,
+		"programStart":         &l.ProgramStart,
+		"instructionsPerFrame": &l.InstructionsPerFrame,
+		"quirks":               l.Quirks.fields(),
+		"palette":              &l.Palette,
+		"decay":                &l.Decay,
+		"steady":               &l.Steady,
+		"keymap":               &l.Keymap,
+		"audio":                l.Audio.fields(),
+	}
+}
+
+func (q *QuirksLayer) fields() map[string]any {
+	return map[string]any{
+		"shift":           &q.Shift,
+		"memoryIncrement": &q.MemoryIncrement,
+		"jump":            &q.Jump,
+		"vfReset":         &q.VfReset,
+		"wrap":            &q.Wrap,
+	}
+}
+
+func (a *AudioLayer) fields() map[string]any {
+	return map[string]any{
+		"enabled":   &a.Enabled,
+		"frequency": &a.Frequency,
+		"volume":    &a.Volume,
+	}
+}
+
+// Parse reads a layer, reporting every unknown, mistyped or invalid field
+// rather than only the first.
+func Parse(data []byte) (Layer, error) {
+	var l Layer
+	if err := errors.Join(decode(data, l.fields(), ""), l.Validate()); err != nil {
+		return Layer{}, err
+	}
+	return l, nil
+}
+
+// decode decodes each field of a JSON object on its own, so that one bad
+// field does not hide the rest. A map in fields is a nested object.
+func decode(data []byte, fields map[string]any, prefix string) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		if prefix != "" {
+			return fmt.Errorf("%s: %w", strings.TrimSuffix(prefix, "."), err)
+		}
+		return err
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(raw)) {
+		target, ok := fields[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s%s: unknown field", prefix, name))
+			continue
+		}
+		if nested, ok := target.(map[string]any); ok {
+			errs = append(errs, decode(raw[name], nested, prefix+name+"."))
+			continue
+		}
+		if err := json.Unmarshal(raw[name], target); err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", prefix, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Validate reports every field the layer sets to a value out of range.
+func (l Layer) Validate() error {
+	var errs []error
+	if l.Platform != nil {
+		if _, ok := platforms[*l.Platform]; !ok {
+			errs = append(errs, fmt.Errorf("platform: unknown platform %q", *l.Platform))
+		}
+	}
+	if l.MemorySize != nil && (*l.MemorySize < 1 || *l.MemorySize > 0xFFFF) {
+		errs = append(errs, fmt.Errorf("memorySize: %d is not between 1 and 65535", *l.MemorySize))
+	}
+	if l.ProgramStart != nil && (*l.ProgramStart < 0 || *l.ProgramStart > 0xFFFF) {
+		errs = append(errs, fmt.Errorf("programStart: %d is not between 0 and 65535", *l.ProgramStart))
+	}
+	if l.InstructionsPerFrame != nil && *l.InstructionsPerFrame < 1 {
+		errs = append(errs, fmt.Errorf("instructionsPerFrame: %d is less than 1", *l.InstructionsPerFrame))
+	}
+	if l.Palette != nil && (len(l.Palette) < 2 || len(l.Palette) > 4) {
+		errs = append(errs, fmt.Errorf("palette: %d colors, want 2 to 4", len(l.Palette)))
+	}
+	for i, color := range l.Palette {
+		if !colorPattern.MatchString(color) {
+			errs = append(errs, fmt.Errorf("palette[%d]: invalid color %q", i, color))
+		}
+	}
+	if l.Decay != nil && (*l.Decay < 0 || *l.Decay >= 1) {
+		errs = append(errs, fmt.Errorf("decay: %g is not at least 0 and below 1", *l.Decay))
+	}
+	if l.Audio.Frequency != nil && (*l.Audio.Frequency < 20 || *l.Audio.Frequency > 20000) {
+		errs = append(errs, fmt.Errorf("audio.frequency: %g Hz is not between 20 and 20000", *l.Audio.Frequency))
+	}
+	if l.Audio.Volume != nil && (*l.Audio.Volume < 0 || *l.Audio.Volume > 1) {
+		errs = append(errs, fmt.Errorf("audio.volume: %g is not between 0 and 1", *l.Audio.Volume))
+	}
+	return errors.Join(errs...)
+}
+
+// Apply returns s with the fields l sets replaced.
+func (s Settings) Apply(l Layer) Settings {
+	if l.Platform != nil {
+		s.Platform = *l.Platform
+		s.Quirks = platforms[*l.Platform]
+	}
+	if l.MemorySize != nil {
+		s.MemorySize = int(*l.MemorySize)
+	}
+	if l.ProgramStart != nil {
+		s.ProgramStart = int(*l.ProgramStart)
+	}
+	if l.InstructionsPerFrame != nil {
+		s.InstructionsPerFrame = *l.InstructionsPerFrame
+	}
+
+	set := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set(&s.Quirks.Shift, l.Quirks.Shift)
+	set(&s.Quirks.MemoryIncrement, l.Quirks.MemoryIncrement)
+	set(&s.Quirks.Jump, l.Quirks.Jump)
+	set(&s.Quirks.VfReset, l.Quirks.VfReset)
+	set(&s.Quirks.Wrap, l.Quirks.Wrap)
+
+	if l.Palette != nil {
+		s.Palette = slices.Clone(l.Palette)
+	}
+	if l.Decay != nil {
+		s.Decay = *l.Decay
+	}
+	set(&s.Steady, l.Steady)
+	if l.Keymap != nil {
+		s.Keymap = *l.Keymap
+	}
+	set(&s.Audio.Enabled, l.Audio.Enabled)
+	if l.Audio.Frequency != nil {
+		s.Audio.Frequency = *l.Audio.Frequency
+	}
+	if l.Audio.Volume != nil {
+		s.Audio.Volume = *l.Audio.Volume
+	}
+	return s
+}
+
+// Validate reports every invalid setting, including a program start that
+// leaves no room for a program.
+func (s Settings) Validate() error {
+	memorySize, programStart := Number(s.MemorySize), Number(s.ProgramStart)
+	l := Layer{
+		Platform:             &s.Platform,
+		MemorySize:           &memorySize,
+		ProgramStart:         &programStart,
+		InstructionsPerFrame: &s.InstructionsPerFrame,
+		Palette:              s.Palette,
+		Decay:                &s.Decay,
+		Audio:                AudioLayer{Frequency: &s.Audio.Frequency, Volume: &s.Audio.Volume},
+	}
+	err := l.Validate()
+	if s.ProgramStart >= s.MemorySize {
+		err = errors.Join(err, fmt.Errorf("programStart: 0x%X is outside memory (%d bytes)", s.ProgramStart, s.MemorySize))
+	}
+	return err
+}
+
+// Resolve applies layers in order over the defaults and validates the
+// result.
+func Resolve(layers ...Layer) (Settings, error) {
+	s := Defaults()
+	for _, l := range layers {
+		s = s.Apply(l)
+	}
+	if err := s.Validate(); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// FromROM returns the layer a ROM gives: the platform its extension
+// hints at and any quirks, speed and colors it carries.
+func FromROM(rom *loader.ROM) Layer {
+	var l Layer
+	if _, ok := platforms[rom.Platform]; ok {
+		l.Platform = &rom.Platform
+	}
+	if q := rom.Quirks; q != nil {
+		l.Quirks = QuirksLayer{&q.Shift, &q.MemoryIncrement, &q.Jump, &q.VfReset, &q.Wrap}
+	}
+	if rom.TickRate > 0 {
+		l.InstructionsPerFrame = &rom.TickRate
+	}
+	if len(rom.Colors) >= 2 && len(rom.Colors) <= 4 {
+		l.Palette = rom.Colors
+	}
+	return l
+}
+
+// FromEntry returns the layer a ROM database entry gives: its platform,
+// speed, quirks and colors. Entries always carry every quirk.
+func FromEntry(e romdb.Entry) Layer {
+	q := e.Quirks
+	l := Layer{Quirks: QuirksLayer{&q.Shift, &q.MemoryIncrement, &q.Jump, &q.VfReset, &q.Wrap}}
+	if e.Platform != "" {
+		l.Platform = &e.Platform
+	}
+	if e.InstructionsPerFrame > 0 {
+		l.InstructionsPerFrame = &e.InstructionsPerFrame
+	}
+	if len(e.Colors) >= 2 && len(e.Colors) <= 4 {
+		l.Palette = e.Colors
+	}
+	return l
+}
+
+func LoadFile(path string) (Layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Layer{}, err
+	}
+
+	l, err := Parse(data)
+	if err != nil {
+		return Layer{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+// load reads the layer at path, returning an empty layer if there is no
+// file.
+func load(path string) (Layer, error) {
+	l, err := LoadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Layer{}, nil
+	}
+	return l, err
+}
+
+// UserPath is the global config, config.json in the chip8 directory under
+// os.UserConfigDir.
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "config.json"), nil
+}
+
+// LoadUser reads the global config, returning an empty layer if there is
+// none.
+func LoadUser() (Layer, error) {
+	path, err := UserPath()
+	if err != nil {
+		return Layer{}, nil
+	}
+	return load(path)
+}
+
+// PathFor returns where the config for the ROM at romPath lives: the same
+// name with Extension in place of the ROM's extension.
+func PathFor(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + Extension
+}
+
+// LoadFor reads the config next to the ROM at romPath, returning an empty
+// layer if there is none.
+func LoadFor(romPath string) (Layer, error) {
+	return load(PathFor(romPath))
+}
+
+// Resolver resolves the settings of each ROM a machine loads: Base, then
+// the ROM's own hints, any entry DB has for it and the config next to
+// the ROM, then Override. DB may be nil, so the zero Resolver applies the
+// ROM's hints over the defaults.
+type Resolver struct {
+	Base     Layer
+	DB       *romdb.DB
+	Override Layer
+}
+
+// Resolve returns the settings for rom, read from path, and the database
+// entry that contributed to them, if any. path is empty for a ROM that
+// was not read from a file, which has no config of its own. original is
+// the ROM before patching, looked up when the patched ROM has no entry,
+// or nil.
+func (r *Resolver) Resolve(rom *loader.ROM, path string, original []byte) (Settings, *romdb.Entry, error) {
+	layers := []Layer{r.Base, FromROM(rom)}
+
+	var found *romdb.Entry
+	if r.DB != nil {
+		entry, ok := r.DB.Lookup(rom.Data)
+		if !ok && original != nil {
+			entry, ok = r.DB.Lookup(original)
+		}
+		if ok {
+			layers = append(layers, FromEntry(entry))
+			found = &entry
+		}
+	}
+
+	if path != "" {
+		own, err := LoadFor(path)
+		if err != nil {
+			return Settings{}, nil, err
+		}
+		layers = append(layers, own)
+	}
+
+	s, err := Resolve(append(layers, r.Override)...)
+	if err != nil {
+		return Settings{}, nil, fmt.Errorf("settings: %w", err)
+	}
+	return s, found, nil
+}
+
+// Load resolves the settings for rom and loads it into c with them. c
+// keeps its memory, so the resolved memory size is replaced by c's; on
+// failure c's configuration is left as it was.
+func (r *Resolver) Load(c *cpu.Cpu, rom *loader.ROM, path string) (Settings, error) {
+	s, _, err := r.Resolve(rom, path, nil)
+	if err != nil {
+		return Settings{}, err
+	}
+	s.MemorySize = len(c.Memory)
+
+	// The resolved quirks replace any the ROM carries, so that reloading
+	// it keeps them.
+	saved, quirks := c.Config, rom.Quirks
+	c.Config.ProgramStart = uint16(s.ProgramStart)
+	rom.Quirks = &s.Quirks
+	if err := rom.Load(c); err != nil {
+		c.Config, rom.Quirks = saved, quirks
+		return Settings{}, err
+	}
+	return s, nil
+}
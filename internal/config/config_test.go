@@ -0,0 +1,241 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/octo"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+func mustParse(t *testing.T, data string) Layer {
+	t.Helper()
+	l, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestResolve_layers(t *testing.T) {
+	global := mustParse(t, `{"instructionsPerFrame": 20, "palette": ["#000000", "#33ff66"], "audio": {"volume": 0.5}}`)
+	rom := mustParse(t, `{"platform": "chip8", "quirks": {"vfReset": false}, "programStart": "0x300"}`)
+	ipf := 40
+	flags := Layer{InstructionsPerFrame: &ipf}
+
+	s, err := Resolve(global, rom, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.InstructionsPerFrame != 40 {
+		t.Errorf("Expected the command line to win, got %d instructions per frame", s.InstructionsPerFrame)
+	}
+	if s.ProgramStart != 0x300 || s.MemorySize != 4096 {
+		t.Errorf("Expected programStart 0x300 in 4096 bytes, got 0x%X in %d", s.ProgramStart, s.MemorySize)
+	}
+	want := cpu.Quirks{Shift: true, MemoryIncrement: true}
+	if s.Quirks != want {
+		t.Errorf("Expected the chip8 quirks without vfReset, got %+v", s.Quirks)
+	}
+	if s.Palette[1] != "#33ff66" {
+		t.Errorf("Expected the global palette, got %v", s.Palette)
+	}
+	if s.Audio.Volume != 0.5 || s.Audio.Frequency != 440 || !s.Audio.Enabled {
+		t.Errorf("Expected volume 0.5 over the default audio, got %+v", s.Audio)
+	}
+
+	c := cpu.NewCpuWithConfig(s.Cpu())
+	if c.Config.ProgramStart != 0x300 || c.Pc != 0x300 || c.Config.Quirks != want {
+		t.Errorf("Expected the Cpu to be configured from the settings, got %+v", c.Config)
+	}
+}
+
+func TestResolve_platformResetsQuirks(t *testing.T) {
+	global := mustParse(t, `{"quirks": {"shift": true, "wrap": true}}`)
+	rom := mustParse(t, `{"platform": "schip"}`)
+
+	s, err := Resolve(global, rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Quirks != (cpu.Quirks{Jump: true}) {
+		t.Errorf("Expected a later platform to replace earlier quirks, got %+v", s.Quirks)
+	}
+}
+
+func TestResolve_defaultPlatform(t *testing.T) {
+	s, err := Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Platform != "modern" || s.Quirks != (cpu.Quirks{}) {
+		t.Errorf("Expected the modern platform with no quirks by default, got %s %+v", s.Platform, s.Quirks)
+	}
+
+	if q, _ := PlatformQuirks("chip48"); q != (cpu.Quirks{Jump: true}) {
+		t.Errorf("Expected CHIP-48 to jump with Bxnn and shift Vx in place, got %+v", q)
+	}
+}
+
+func TestPlatformQuirks_matchOcto(t *testing.T) {
+	for name, preset := range octo.Presets {
+		q, ok := PlatformQuirks(name)
+		if !ok {
+			t.Errorf("Expected a %s platform for the Octo preset", name)
+			continue
+		}
+		if q != preset.Quirks() {
+			t.Errorf("Expected %s quirks %+v from Octo, got %+v", name, preset.Quirks(), q)
+		}
+	}
+}
+
+func TestParse_reportsEveryField(t *testing.T) {
+	_, err := Parse([]byte(`{
+		"platform": "vip",
+		"memorySize": 70000,
+		"instructionsPerFrame": "fast",
+		"palette": ["#000000", "green"],
+		"decay": 1,
+		"keymap": "arrows",
+		"quirks": {"shift": 1, "clip": true},
+		"audio": {"frequency": 5, "volume": 2},
+		"speed": 3
+	}`))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	for _, field := range []string{"platform", "memorySize", "instructionsPerFrame", "palette[1]", "decay", "quirks.shift", "quirks.clip", "audio.frequency", "audio.volume", "speed"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Errorf("Expected the error to report %s, got %v", field, err)
+		}
+	}
+	if strings.Contains(err.Error(), "keymap") {
+		t.Errorf("Expected the valid keymap not to be reported, got %v", err)
+	}
+}
+
+func TestResolve_programStartOutsideMemory(t *testing.T) {
+	_, err := Resolve(mustParse(t, `{"memorySize": 512, "programStart": 512}`))
+	if err == nil || !strings.Contains(err.Error(), "programStart") {
+		t.Errorf("Expected programStart outside memory to be reported, got %v", err)
+	}
+}
+
+func TestFromROMAndEntry(t *testing.T) {
+	rom, err := loader.Parse("game.xo8", []byte{0x00, 0xE0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := romdb.Entry{Title: "Game", InstructionsPerFrame: 100, Quirks: cpu.Quirks{Wrap: true}, Colors: []string{"#111111", "#eeeeee"}}
+
+	s, err := Resolve(FromROM(rom), FromEntry(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Platform != "xochip" {
+		t.Errorf("Expected the extension to pick xochip, got %q", s.Platform)
+	}
+	if s.Quirks != entry.Quirks {
+		t.Errorf("Expected the entry's quirks, got %+v", s.Quirks)
+	}
+	if s.InstructionsPerFrame != 100 || s.Palette[0] != "#111111" {
+		t.Errorf("Expected the entry's speed and colors, got %d and %v", s.InstructionsPerFrame, s.Palette)
+	}
+}
+
+func TestFromROM_cartridge(t *testing.T) {
+	rom := &loader.ROM{Name: "jam.gif", TickRate: 500, Colors: []string{"#996600", "#FFCC00", "#FF6600", "#662200"}}
+
+	s, err := Resolve(FromROM(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.InstructionsPerFrame != 500 || len(s.Palette) != 4 || s.Palette[3] != "#662200" {
+		t.Errorf("Expected the cartridge's speed and colors, got %d and %v", s.InstructionsPerFrame, s.Palette)
+	}
+}
+
+func TestLoadFor(t *testing.T) {
+	dir := t.TempDir()
+	romPath := filepath.Join(dir, "pong.ch8")
+
+	l, err := LoadFor(romPath)
+	if err != nil || l.Platform != nil {
+		t.Errorf("Expected no file to give an empty layer, got %+v (%v)", l, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "pong.json"), []byte(`{"keymap": "arrows"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = LoadFor(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Keymap == nil || *l.Keymap != "arrows" {
+		t.Errorf("Expected the keymap from pong.json, got %v", l.Keymap)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "pong.json"), []byte(`{"keymap": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFor(romPath); err == nil || !strings.Contains(err.Error(), "pong.json") {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir := t.TempDir()
+	romPath := filepath.Join(dir, "pong.ch8")
+	if err := os.WriteFile(filepath.Join(dir, "pong.json"), []byte(`{"instructionsPerFrame": 30, "programStart": 4095}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte{0x12, 0x00}
+	db := romdb.New()
+	if err := db.Add(romdb.Hash(data), romdb.Entry{Title: "Pong", Platform: "chip8", InstructionsPerFrame: 20, Quirks: cpu.Quirks{Jump: true}}); err != nil {
+		t.Fatal(err)
+	}
+	ipf := 40
+	r := &Resolver{DB: db}
+
+	rom := &loader.ROM{Name: "pong.ch8", Data: data}
+	s, entry, err := r.Resolve(rom, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || entry.Title != "Pong" || s.InstructionsPerFrame != 20 || s.Quirks != (cpu.Quirks{Jump: true}) {
+		t.Errorf("Expected the database entry to apply, got %+v from %v", s, entry)
+	}
+
+	if s, _, _ := r.Resolve(rom, romPath, nil); s.InstructionsPerFrame != 30 {
+		t.Errorf("Expected the ROM's own config to beat the database, got %d", s.InstructionsPerFrame)
+	}
+
+	r.Override = Layer{InstructionsPerFrame: &ipf}
+	if s, _, _ := r.Resolve(rom, romPath, nil); s.InstructionsPerFrame != 40 {
+		t.Errorf("Expected the override to beat the ROM's config, got %d", s.InstructionsPerFrame)
+	}
+
+	c := cpu.NewCpu(4096, 0x200)
+	if _, err := r.Load(c, rom, romPath); err == nil {
+		t.Fatal("Expected a program start with no room for the ROM to fail")
+	}
+	if c.Config.ProgramStart != 0x200 || c.Config.Quirks != (cpu.Quirks{}) || rom.Quirks != nil {
+		t.Errorf("Expected a failed load to leave the machine as it was, got %+v", c.Config)
+	}
+
+	s, err = r.Load(c, rom, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Config.Quirks != (cpu.Quirks{Jump: true}) || *rom.Quirks != c.Config.Quirks || s.MemorySize != 4096 {
+		t.Errorf("Expected the resolved quirks on the machine and the ROM, got %+v", c.Config)
+	}
+}
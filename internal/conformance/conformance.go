@@ -0,0 +1,192 @@
+package conformance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+const defaultInstructionsPerFrame = 10
+
+// Case runs ROM, a file in testdata/roms, headlessly for Frames frames
+// and compares the final screen with testdata/golden/<Name>.png. Keys
+// are held down for the whole run.
+type Case struct {
+	Name                 string
+	ROM                  string
+	Frames               int
+	InstructionsPerFrame int
+	Quirks               cpu.Quirks
+	Keys                 []int
+}
+
+// Options controls what happens to golden screens. Update rewrites them
+// from the current output instead of comparing; OutDir receives the
+// actual, expected and diff images of failing cases.
+type Options struct {
+	Update bool
+	OutDir string
+}
+
+func RunAll(t *testing.T, cases []Case, opts Options) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			Run(t, c, opts)
+		})
+	}
+}
+
+func Run(t *testing.T, c Case, opts Options) {
+	t.Helper()
+
+	rom, err := loader.LoadFile(filepath.Join("testdata", "roms", c.ROM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := cpu.NewCpu(4096, 0x200)
+	machine.Config.Quirks = c.Quirks
+	if err := rom.Load(machine); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range c.Keys {
+		machine.Keys[key] = true
+	}
+
+	ipf := c.InstructionsPerFrame
+	if ipf == 0 {
+		ipf = defaultInstructionsPerFrame
+	}
+	for frame := 0; frame < c.Frames; frame++ {
+		for i := 0; i < ipf; i++ {
+			machine.Execute()
+		}
+		machine.TickTimers()
+	}
+
+	actual := Screenshot(machine.Display[:])
+	goldenPath := filepath.Join("testdata", "golden", c.Name+".png")
+
+	if opts.Update {
+		if err := writePNG(goldenPath, actual); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := readPNG(goldenPath)
+	if err != nil {
+		t.Fatalf("%v (run with -update-golden to create it)", err)
+	}
+
+	if Hash(actual) == Hash(expected) {
+		return
+	}
+
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(opts.OutDir, c.Name)
+	for suffix, img := range map[string]image.Image{
+		"-actual.png":   actual,
+		"-expected.png": expected,
+		"-diff.png":     Diff(actual, expected),
+	} {
+		if err := writePNG(base+suffix, img); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Errorf("Expected screen to match %s, got hash %s; images written to %s-*.png", goldenPath, Hash(actual), base)
+}
+
+var palette = color.Palette{color.Black, color.White}
+
+// Screenshot renders a display buffer as a one-pixel-per-cell image.
+func Screenshot(display []uint8) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, cpu.DisplayWidth, cpu.DisplayHeight), palette)
+	for i, pixel := range display {
+		if pixel != 0 {
+			img.Pix[i] = 1
+		}
+	}
+	return img
+}
+
+// Hash identifies a screen by which of its pixels are lit, so images
+// that differ only in encoding or palette hash the same.
+func Hash(img image.Image) string {
+	b := img.Bounds()
+	h := sha256.New()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if lit(img.At(x, y)) {
+				h.Write([]byte{1})
+			} else {
+				h.Write([]byte{0})
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Diff marks pixels lit only in actual green, lit only in expected red,
+// and pixels that agree in grey.
+func Diff(actual, expected image.Image) image.Image {
+	b := actual.Bounds().Union(expected.Bounds())
+	img := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a, e := lit(actual.At(x, y)), lit(expected.At(x, y))
+			switch {
+			case a && !e:
+				img.Set(x, y, color.RGBA{0, 255, 0, 255})
+			case e && !a:
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			case a:
+				img.Set(x, y, color.RGBA{128, 128, 128, 255})
+			default:
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func lit(c color.Color) bool {
+	if c == nil {
+		return false
+	}
+	r, g, b, _ := c.RGBA()
+	return r+g+b > 3*0x7FFF
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package cpu_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/conformance"
+	"github.com/pesos228/chip8/internal/octo"
+)
+
+var (
+	updateGolden = flag.Bool("update-golden", false, "rewrite golden screens from the current output")
+	goldenOut    = flag.String("golden-out", filepath.Join(os.TempDir(), "chip8-golden"), "directory for actual, expected and diff images of failing cases")
+)
+
+func platformQuirks(t *testing.T, platform string) cpu.Quirks {
+	t.Helper()
+	s, err := config.Resolve(config.Layer{Platform: &platform})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Quirks
+}
+
+func TestConformance(t *testing.T) {
+	cases := []conformance.Case{
+		{Name: "font", ROM: "font.ch8", Frames: 30},
+		{Name: "flags", ROM: "flags.ch8", Frames: 60},
+		{Name: "flags-shift-quirk", ROM: "flags.ch8", Frames: 60, Quirks: cpu.Quirks{Shift: true}},
+		{Name: "keypad", ROM: "keypad.ch8", Frames: 5, Keys: []int{0xB}},
+	}
+	for _, platform := range []string{"chip8", "chip48", "schip", "xochip", "modern"} {
+		cases = append(cases,
+			conformance.Case{Name: "opcodes-" + platform, ROM: "opcodes.ch8", Frames: 60, Quirks: platformQuirks(t, platform)},
+			conformance.Case{Name: "quirks-" + platform, ROM: "quirks.ch8", Frames: 30, Quirks: platformQuirks(t, platform)},
+		)
+	}
+
+	conformance.RunAll(t, cases, conformance.Options{Update: *updateGolden, OutDir: *goldenOut})
+}
+
+// TestConformanceSources checks that the ROMs written in Octo match
+// their source.
+func TestConformanceSources(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "roms", "*.8o"))
+	if err != nil || len(sources) == 0 {
+		t.Fatalf("Expected Octo sources in testdata/roms, got %v (%v)", sources, err)
+	}
+
+	for _, path := range sources {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := octo.Assemble(string(source))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+
+		rom, err := os.ReadFile(strings.TrimSuffix(path, ".8o") + ".ch8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(program, rom) {
+			t.Errorf("Expected %s to assemble to the checked-in ROM", path)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+const (
+	Opcode   uint8 = 1 << iota // first byte of a fetched instruction
+	Operand                    // second byte of a fetched instruction
+	Data                       // read through I
+	Taken                      // skip instruction that skipped
+	NotTaken                   // skip instruction that fell through
+)
+
+// Profile holds per-byte coverage flags for a ROM loaded at Start.
+type Profile struct {
+	Start uint16
+	Flags []uint8
+}
+
+func NewProfile(start uint16, romSize int) *Profile {
+	return &Profile{Start: start, Flags: make([]uint8, romSize)}
+}
+
+func (p *Profile) mark(addr uint16, flag uint8) {
+	if addr < p.Start || int(addr-p.Start) >= len(p.Flags) {
+		return
+	}
+	p.Flags[addr-p.Start] |= flag
+}
+
+func (p *Profile) Has(addr uint16, flag uint8) bool {
+	if addr < p.Start || int(addr-p.Start) >= len(p.Flags) {
+		return false
+	}
+	return p.Flags[addr-p.Start]&flag != 0
+}
+
+func (p *Profile) Merge(other *Profile) error {
+	if other.Start != p.Start {
+		return fmt.Errorf("cannot merge coverage for start 0x%03X into start 0x%03X", other.Start, p.Start)
+	}
+	if len(other.Flags) > len(p.Flags) {
+		p.Flags = append(p.Flags, make([]uint8, len(other.Flags)-len(p.Flags))...)
+	}
+	for i, f := range other.Flags {
+		p.Flags[i] |= f
+	}
+	return nil
+}
+
+type Summary struct {
+	Bytes           int
+	CoveredBytes    int
+	Branches        int
+	CoveredBranches int
+}
+
+func (s Summary) BytePercent() float64 {
+	return percent(s.CoveredBytes, s.Bytes)
+}
+
+func (s Summary) BranchPercent() float64 {
+	return percent(s.CoveredBranches, s.Branches)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// Summary counts a byte as covered when it was fetched or read as data,
+// and every executed skip instruction as two branches.
+func (p *Profile) Summary() Summary {
+	s := Summary{Bytes: len(p.Flags)}
+	for _, f := range p.Flags {
+		if f&(Opcode|Operand|Data) != 0 {
+			s.CoveredBytes++
+		}
+		if f&(Taken|NotTaken) != 0 {
+			s.Branches += 2
+			if f&Taken != 0 {
+				s.CoveredBranches++
+			}
+			if f&NotTaken != 0 {
+				s.CoveredBranches++
+			}
+		}
+	}
+	return s
+}
+
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "chip8 coverage start=%03X size=%d\n", p.Start, len(p.Flags))
+	for i, f := range p.Flags {
+		if f != 0 {
+			fmt.Fprintf(bw, "%03X %02X\n", int(p.Start)+i, f)
+		}
+	}
+	return bw.Flush()
+}
+
+func Read(r io.Reader) (*Profile, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty coverage file")
+	}
+
+	var start uint16
+	var size int
+	if _, err := fmt.Sscanf(scanner.Text(), "chip8 coverage start=%X size=%d", &start, &size); err != nil {
+		return nil, fmt.Errorf("line 1: invalid coverage header %q", scanner.Text())
+	}
+
+	p := NewProfile(start, size)
+	line := 1
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"addr flags\", got %q", line, scanner.Text())
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, fields[0])
+		}
+		flags, err := strconv.ParseUint(fields[1], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid flags %q", line, fields[1])
+		}
+		p.mark(uint16(addr), uint8(flags))
+	}
+
+	return p, scanner.Err()
+}
+
+func Load(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Recorder executes instructions on a Cpu and records coverage into
+// Profile.
+type Recorder struct {
+	cpu     *cpu.Cpu
+	Profile *Profile
+}
+
+func NewRecorder(c *cpu.Cpu, romSize int) *Recorder {
+	return &Recorder{cpu: c, Profile: NewProfile(c.Config.ProgramStart, romSize)}
+}
+
+func (r *Recorder) Step() {
+	c := r.cpu
+	pc := c.Pc
+	opcode := c.Opcode()
+
+	r.Profile.mark(pc, Opcode)
+	r.Profile.mark(pc+1, Operand)
+
+	if addr, n := dataReads(c, opcode); n > 0 {
+		for i := uint16(0); i < n; i++ {
+			r.Profile.mark(addr+i, Data)
+		}
+	}
+
+	c.Execute()
+
+	if isSkip(opcode) {
+		if c.Pc == pc+4 {
+			r.Profile.mark(pc, Taken)
+		} else {
+			r.Profile.mark(pc, NotTaken)
+		}
+	}
+}
+
+func (r *Recorder) Run(steps int) {
+	for i := 0; i < steps; i++ {
+		r.Step()
+	}
+}
+
+func isSkip(opcode uint16) bool {
+	switch opcode & 0xF000 {
+	case 0x3000, 0x4000, 0x5000, 0x9000:
+		return true
+	case 0xE000:
+		return opcode&0x00FF == 0x9E || opcode&0x00FF == 0xA1
+	}
+	return false
+}
+
+// dataReads returns the memory range opcode reads through I: the sprite
+// rows of DRW and the register block of LD Vx, [I].
+func dataReads(c *cpu.Cpu, opcode uint16) (uint16, uint16) {
+	switch {
+	case opcode&0xF000 == 0xD000:
+		return c.I, opcode & 0x000F
+	case opcode&0xF0FF == 0xF065:
+		return c.I, (opcode&0x0F00)>>8 + 1
+	}
+	return 0, 0
+}
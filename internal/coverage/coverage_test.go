@@ -0,0 +1,111 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+// LD V1, 5; SE V1, 5; JP 0x108; LD V2, 1; JP 0x108; then one data byte.
+var branchProgram = []uint8{0x61, 0x05, 0x31, 0x05, 0x11, 0x08, 0x62, 0x01, 0x11, 0x08, 0xAA}
+
+func record(program []uint8, steps int) *Profile {
+	c := cpu.NewCpu(512, 0x100)
+	c.LoadGame(program)
+	r := NewRecorder(c, len(program))
+	r.Run(steps)
+	return r.Profile
+}
+
+func TestRecorder(t *testing.T) {
+	p := record(branchProgram, 4)
+
+	if !p.Has(0x102, Taken) || p.Has(0x102, NotTaken) {
+		t.Errorf("Expected skip at 0x102 to be taken only, got flags 0x%02X", p.Flags[2])
+	}
+
+	if p.Has(0x104, Opcode) {
+		t.Errorf("Expected 0x104 not to be fetched")
+	}
+
+	if !p.Has(0x109, Operand) {
+		t.Errorf("Expected 0x109 to be fetched as an operand")
+	}
+
+	s := p.Summary()
+	if s.CoveredBytes != 8 || s.Bytes != 11 {
+		t.Errorf("Expected 8/11 bytes covered, got %d/%d", s.CoveredBytes, s.Bytes)
+	}
+
+	if s.CoveredBranches != 1 || s.Branches != 2 {
+		t.Errorf("Expected 1/2 branches covered, got %d/%d", s.CoveredBranches, s.Branches)
+	}
+}
+
+func TestProfile_Merge(t *testing.T) {
+	a := record(branchProgram, 4)
+
+	other := append([]uint8{}, branchProgram...)
+	other[1] = 0x04
+	b := record(other, 4)
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if !a.Has(0x102, Taken) || !a.Has(0x102, NotTaken) {
+		t.Errorf("Expected both branches of 0x102 after merge, got flags 0x%02X", a.Flags[2])
+	}
+
+	if a.Summary().BranchPercent() != 100 {
+		t.Errorf("Expected full branch coverage, got %.1f%%", a.Summary().BranchPercent())
+	}
+
+	if err := a.Merge(NewProfile(0x200, 4)); err == nil {
+		t.Errorf("Expected merging profiles with different starts to fail")
+	}
+}
+
+func TestProfile_WriteRead(t *testing.T) {
+	p := record(branchProgram, 4)
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if got.Start != p.Start || !bytes.Equal(got.Flags, p.Flags) {
+		t.Errorf("Expected round-tripped profile to match, got %+v want %+v", got, p)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	p := record(branchProgram, 4)
+
+	var buf bytes.Buffer
+	err := WriteHTML(&buf, "branch.ch8", branchProgram, p, symbols.Table{0x108: "loop"})
+	if err != nil {
+		t.Fatalf("WriteHTML failed: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"SE V1, #05",
+		"always skipped",
+		"loop:",
+		"DB #AA",
+		"72.7%",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected report to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+type row struct {
+	Addr   string
+	Label  string
+	Bytes  string
+	Text   string
+	Class  string
+	Branch string
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} coverage</title>
+<style>
+body { font-family: monospace; background: #fff; color: #222; }
+table { border-collapse: collapse; }
+td { padding: 0 1em 0 0; white-space: pre; }
+.label { color: #555; font-weight: bold; }
+.code { background: #c8f0c8; }
+.data { background: #c8d8f8; }
+.partial { background: #f8e8a0; }
+.none { background: #f8c8c8; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>bytes: {{printf "%.1f" .Summary.BytePercent}}% ({{.Summary.CoveredBytes}}/{{.Summary.Bytes}}),
+branches: {{printf "%.1f" .Summary.BranchPercent}}% ({{.Summary.CoveredBranches}}/{{.Summary.Branches}})</p>
+<table>
+{{range .Rows}}{{if .Label}}<tr><td class="label" colspan="4">{{.Label}}:</td></tr>
+{{end}}<tr class="{{.Class}}"><td>{{.Addr}}</td><td>{{.Bytes}}</td><td>{{.Text}}</td><td>{{.Branch}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders rom as an annotated disassembly. Bytes fetched as
+// instructions are disassembled; everything else is shown as data.
+func WriteHTML(w io.Writer, title string, rom []uint8, p *Profile, syms symbols.Table) error {
+	var rows []row
+
+	for i := 0; i < len(rom); {
+		addr := p.Start + uint16(i)
+		r := row{Addr: fmt.Sprintf("%03X", addr), Label: syms[addr]}
+
+		if p.Has(addr, Opcode) && i+1 < len(rom) {
+			opcode := uint16(rom[i])<<8 | uint16(rom[i+1])
+			r.Bytes = fmt.Sprintf("%04X", opcode)
+			r.Text = cpu.Disassemble(opcode)
+			r.Class = "code"
+			taken, notTaken := p.Has(addr, Taken), p.Has(addr, NotTaken)
+			switch {
+			case taken && notTaken:
+				r.Branch = "both branches"
+			case taken:
+				r.Branch = "always skipped"
+				r.Class = "partial"
+			case notTaken:
+				r.Branch = "never skipped"
+				r.Class = "partial"
+			}
+			i += 2
+		} else {
+			r.Bytes = fmt.Sprintf("%02X", rom[i])
+			r.Text = fmt.Sprintf("DB #%02X", rom[i])
+			r.Class = "none"
+			if p.Has(addr, Data|Operand) {
+				r.Class = "data"
+			}
+			i++
+		}
+
+		rows = append(rows, r)
+	}
+
+	return reportTemplate.Execute(w, struct {
+		Title   string
+		Summary Summary
+		Rows    []row
+	}{title, p.Summary(), rows})
+}
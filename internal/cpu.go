@@ -3,8 +3,41 @@ package cpu
 import (
 	"fmt"
 	"math/rand"
+	"sync"
+	"time"
 )
 
+const (
+	DisplayWidth  = 64
+	DisplayHeight = 32
+
+	FontStart     = 0x000
+	FontGlyphSize = 5
+)
+
+var font = [16 * FontGlyphSize]uint8{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+	0x20, 0x60, 0x20, 0x20, 0x70, // 1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
+// Cpu holds all interpreter state, so separate values can run on separate
+// goroutines. Execute, TickTimers, Reset and LoadGame serialise on an
+// internal lock, which lets Snapshot observe a running machine from
+// another goroutine; direct field access is not synchronised.
 type Cpu struct {
 	Memory    []uint8
 	Registers [16]uint8
@@ -14,30 +47,86 @@ type Cpu struct {
 	I         uint16
 	Dt        uint8
 	St        uint8
+	Display   [DisplayWidth * DisplayHeight]uint8
+	Keys      [16]bool
 	Config    Config
-}
+	Bus       Bus
+	Rand      *rand.Rand
 
-var randIntn = rand.Intn
+	instructions []Instruction
+	mu           sync.Mutex
+}
 
 type Config struct {
 	MemorySize   uint16
 	ProgramStart uint16
+	Quirks       Quirks
 }
 
+// Quirks select between the behaviours that differ across CHIP-8
+// implementations. The zero value is the behaviour this interpreter has
+// always had: SUPER-CHIP's shifts, Fx55/Fx65, VF and clipping, but the
+// COSMAC VIP's Bnnn, where CHIP-48 and SUPER-CHIP use Bxnn.
+type Quirks struct {
+	Shift           bool `json:"shift"`           // 8xy6/8xyE shift Vy into Vx instead of shifting Vx
+	MemoryIncrement bool `json:"memoryIncrement"` // Fx55/Fx65 leave I pointing past the last register
+	Jump            bool `json:"jump"`            // Bxnn jumps to xnn + Vx instead of nnn + V0
+	VfReset         bool `json:"vfReset"`         // 8xy1/8xy2/8xy3 clear VF
+	Wrap            bool `json:"wrap"`            // sprites wrap around the display edges instead of clipping
+}
+
+// instructionSet is the decode table every Cpu shares; it is never
+// modified.
+var instructionSet = newInstructionSet()
+
 func NewCpu(memorySize, programStart uint16) *Cpu {
-	cpu := &Cpu{
-		Pc:     programStart,
-		Memory: make([]uint8, memorySize),
-		Config: Config{
-			MemorySize:   memorySize,
-			ProgramStart: programStart,
-		},
-	}
+	cpu := &Cpu{}
+	cpu.init(make([]uint8, memorySize), programStart, time.Now().UnixNano())
+	return cpu
+}
+
+// NewCpuWithConfig creates a Cpu with the memory size, program start and
+// quirks in config.
+func NewCpuWithConfig(config Config) *Cpu {
+	cpu := NewCpu(config.MemorySize, config.ProgramStart)
+	cpu.Config.Quirks = config.Quirks
 	return cpu
 }
 
+// NewCpus creates n machines in one contiguous array, with their memories
+// laid out back to back in a single allocation, for running many machines
+// at once. Machine i's random numbers are seeded with seed+i.
+func NewCpus(n int, memorySize, programStart uint16, seed int64) []Cpu {
+	cpus := make([]Cpu, n)
+	memory := make([]uint8, n*int(memorySize))
+	for i := range cpus {
+		start := i * int(memorySize)
+		cpus[i].init(memory[start:start+int(memorySize):start+int(memorySize)], programStart, seed+int64(i))
+	}
+	return cpus
+}
+
+func (c *Cpu) init(memory []uint8, programStart uint16, seed int64) {
+	c.Pc = programStart
+	c.Memory = memory
+	c.Config = Config{
+		MemorySize:   uint16(len(memory)),
+		ProgramStart: programStart,
+	}
+	c.Rand = rand.New(rand.NewSource(seed))
+	c.instructions = instructionSet
+	c.loadFont()
+}
+
 func (c *Cpu) LoadGame(game []uint8) error {
-	c.Reset()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reset()
+
+	if c.Config.ProgramStart > c.Config.MemorySize {
+		return fmt.Errorf("program start (0x%X) is outside memory (%d bytes)", c.Config.ProgramStart, c.Config.MemorySize)
+	}
 
 	availableMemory := c.Config.MemorySize - c.Config.ProgramStart
 	if len(game) > int(availableMemory) {
@@ -53,8 +142,21 @@ func (c *Cpu) LoadGame(game []uint8) error {
 	return nil
 }
 
+// Reset clears memory in place, so a MemoryBus built over c.Memory stays
+// attached across resets.
 func (c *Cpu) Reset() {
-	c.Memory = make([]uint8, c.Config.MemorySize)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reset()
+}
+
+func (c *Cpu) reset() {
+	if len(c.Memory) == int(c.Config.MemorySize) {
+		clear(c.Memory)
+	} else {
+		c.Memory = make([]uint8, c.Config.MemorySize)
+	}
 	c.Registers = [16]uint8{}
 	c.Stack = [16]uint16{}
 	c.Sp = 0
@@ -62,12 +164,49 @@ func (c *Cpu) Reset() {
 	c.I = 0
 	c.Dt = 0
 	c.St = 0
+	c.Display = [DisplayWidth * DisplayHeight]uint8{}
+	c.loadFont()
+}
+
+func (c *Cpu) loadFont() {
+	if len(c.Memory) >= FontStart+len(font) {
+		copy(c.Memory[FontStart:], font[:])
+	}
+}
+
+func (c *Cpu) TickTimers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Dt > 0 {
+		c.Dt--
+	}
+	if c.St > 0 {
+		c.St--
+	}
 }
 
+func (c *Cpu) SoundActive() bool {
+	return c.St > 0
+}
+
+// Execute runs one instruction. Memory accesses wrap around the end of
+// memory, whatever the program does to I. A jump past the end leaves PC
+// as set, and it wraps when the next instruction is fetched.
 func (c *Cpu) Execute() {
-	opcode := uint16(c.Memory[c.Pc])<<8 | uint16(c.Memory[c.Pc+1])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.Memory) == 0 {
+		return
+	}
 
-	for _, instr := range instructions {
+	c.Pc = c.wrap(c.Pc)
+	c.dispatch(c.fetch())
+}
+
+func (c *Cpu) dispatch(opcode uint16) {
+	for _, instr := range c.instructions {
 		if opcode&instr.Mask == instr.Pattern {
 			instr.Handler(c, opcode)
 			return
@@ -77,3 +216,45 @@ func (c *Cpu) Execute() {
 	fmt.Printf("Unknown opcode: 0x%X\n", opcode)
 	c.Pc += 2
 }
+
+// Opcode returns the instruction at the PC without executing it and
+// without notifying the bus.
+func (c *Cpu) Opcode() uint16 {
+	if len(c.Memory) == 0 {
+		return 0
+	}
+	pc := c.wrap(c.Pc)
+	return uint16(c.Memory[pc])<<8 | uint16(c.Memory[c.wrap(pc+1)])
+}
+
+func (c *Cpu) wrap(addr uint16) uint16 {
+	if int(addr) < len(c.Memory) {
+		return addr
+	}
+	return uint16(int(addr) % len(c.Memory))
+}
+
+func (c *Cpu) fetch() uint16 {
+	pc := c.wrap(c.Pc)
+	if c.Bus != nil {
+		return c.Bus.Fetch(pc)
+	}
+	return uint16(c.Memory[pc])<<8 | uint16(c.Memory[c.wrap(pc+1)])
+}
+
+func (c *Cpu) read(addr uint16) uint8 {
+	addr = c.wrap(addr)
+	if c.Bus != nil {
+		return c.Bus.Read(addr)
+	}
+	return c.Memory[addr]
+}
+
+func (c *Cpu) write(addr uint16, value uint8) {
+	addr = c.wrap(addr)
+	if c.Bus != nil {
+		c.Bus.Write(addr, value)
+		return
+	}
+	c.Memory[addr] = value
+}
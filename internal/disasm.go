@@ -0,0 +1,27 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble renders opcode using the mnemonic from the instruction
+// table, with the operand placeholders replaced by their values.
+func Disassemble(opcode uint16) string {
+	for _, instr := range instructionSet {
+		if opcode&instr.Mask != instr.Pattern {
+			continue
+		}
+
+		mnemonic, _, _ := strings.Cut(instr.Name, " (")
+		return strings.NewReplacer(
+			"Vx", fmt.Sprintf("V%X", (opcode&0x0F00)>>8),
+			"Vy", fmt.Sprintf("V%X", (opcode&0x00F0)>>4),
+			"byte", fmt.Sprintf("#%02X", opcode&0x00FF),
+			"addr", fmt.Sprintf("#%03X", opcode&0x0FFF),
+			"nibble", fmt.Sprintf("%d", opcode&0x000F),
+		).Replace(mnemonic)
+	}
+
+	return fmt.Sprintf("DW #%04X", opcode)
+}
@@ -0,0 +1,26 @@
+package cpu
+
+import (
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	cases := []struct {
+		opcode   uint16
+		expected string
+	}{
+		{0x00EE, "RET"},
+		{0x1234, "JP #234"},
+		{0x6A1F, "LD VA, #1F"},
+		{0x8125, "SUB V1, V2"},
+		{0x8306, "SHR V3 {, V0}"},
+		{0xB300, "JP V0, #300"},
+		{0xFFFF, "DW #FFFF"},
+	}
+
+	for _, tc := range cases {
+		if got := Disassemble(tc.opcode); got != tc.expected {
+			t.Errorf("Expected 0x%04X to disassemble to %q, got %q", tc.opcode, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Address is a memory address, written in JSON as a number or as a
+// string such as "0x2F0".
+type Address uint16
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return fmt.Errorf("address %q: %w", s, err)
+		}
+		*a = Address(v)
+		return nil
+	}
+
+	var v uint16
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = Address(v)
+	return nil
+}
+
+// Value reads a number from memory. Encoding is "binary" for a big-endian
+// integer, "digits" for one decimal digit per byte as Fx33 stores them,
+// or "bcd" for two decimal digits per byte.
+type Value struct {
+	Address  Address `json:"address"`
+	Size     int     `json:"size"`
+	Encoding string  `json:"encoding"`
+}
+
+// RewardRule pays Scale times the change in Value since the last step.
+type RewardRule struct {
+	Value
+	Scale float64 `json:"scale"`
+}
+
+// DoneRule ends the episode when Value compared with Op to Compare is
+// true. Op is one of ==, !=, <, <=, > and >=.
+type DoneRule struct {
+	Value
+	Op      string `json:"op"`
+	Compare int    `json:"value"`
+}
+
+// Config describes one game. Actions lists the keys held for each action
+// index; when it is empty there are 17 actions, no keys and then each key
+// alone. MaxSteps, if set, ends an episode after that many steps.
+type Config struct {
+	Title                string       `json:"title"`
+	FrameSkip            int          `json:"frameSkip"`
+	InstructionsPerFrame int          `json:"instructionsPerFrame"`
+	MaxSteps             int          `json:"maxSteps"`
+	Actions              [][]int      `json:"actions"`
+	Reward               []RewardRule `json:"reward"`
+	Done                 []DoneRule   `json:"done"`
+}
+
+const (
+	defaultFrameSkip            = 4
+	defaultInstructionsPerFrame = 10
+)
+
+func ParseConfig(data []byte) (Config, error) {
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+
+	c = c.withDefaults()
+	if err := c.validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// withDefaults fills in the fields left at zero.
+func (c Config) withDefaults() Config {
+	if c.FrameSkip == 0 {
+		c.FrameSkip = defaultFrameSkip
+	}
+	if c.InstructionsPerFrame == 0 {
+		c.InstructionsPerFrame = defaultInstructionsPerFrame
+	}
+	if len(c.Actions) == 0 {
+		c.Actions = [][]int{{}}
+		for key := 0; key < 16; key++ {
+			c.Actions = append(c.Actions, []int{key})
+		}
+	}
+	c.Reward = slices.Clone(c.Reward)
+	for i := range c.Reward {
+		if c.Reward[i].Scale == 0 {
+			c.Reward[i].Scale = 1
+		}
+	}
+	return c
+}
+
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+var ops = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+func (v Value) validate(name string) error {
+	var errs []error
+	if v.Size < 1 || v.Size > 4 {
+		errs = append(errs, fmt.Errorf("%s: size %d must be 1-4 bytes", name, v.Size))
+	}
+	switch v.Encoding {
+	case "binary", "digits", "bcd":
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown encoding %q", name, v.Encoding))
+	}
+	return errors.Join(errs...)
+}
+
+// validate reports every problem in the config at once.
+func (c Config) validate() error {
+	var errs []error
+	if c.FrameSkip < 1 {
+		errs = append(errs, fmt.Errorf("frameSkip %d must be at least 1", c.FrameSkip))
+	}
+	if c.InstructionsPerFrame < 1 {
+		errs = append(errs, fmt.Errorf("instructionsPerFrame %d must be at least 1", c.InstructionsPerFrame))
+	}
+	if c.MaxSteps < 0 {
+		errs = append(errs, fmt.Errorf("maxSteps %d is negative", c.MaxSteps))
+	}
+	for i, keys := range c.Actions {
+		for _, key := range keys {
+			if key < 0 || key > 15 {
+				errs = append(errs, fmt.Errorf("actions[%d]: key %d must be 0-15", i, key))
+			}
+		}
+	}
+	for i, r := range c.Reward {
+		errs = append(errs, r.validate(fmt.Sprintf("reward[%d]", i)))
+	}
+	for i, d := range c.Done {
+		errs = append(errs, d.validate(fmt.Sprintf("done[%d]", i)))
+		if _, ok := ops[d.Op]; !ok {
+			errs = append(errs, fmt.Errorf("done[%d]: unknown op %q", i, d.Op))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// read decodes the value from memory. Addresses past the end of memory
+// wrap, as they do for the interpreter.
+func (v Value) read(memory []uint8) int {
+	n := 0
+	for i := 0; i < v.Size; i++ {
+		b := int(memory[(int(v.Address)+i)%len(memory)])
+		switch v.Encoding {
+		case "binary":
+			n = n<<8 | b
+		case "digits":
+			n = n*10 + b%10
+		case "bcd":
+			n = n*100 + (b>>4%10)*10 + b&0x0F%10
+		}
+	}
+	return n
+}
@@ -0,0 +1,137 @@
+// Package env wraps the interpreter as a reinforcement-learning
+// environment in the style of Gym: Reset starts an episode and returns
+// the first observation, and Step applies an action for a number of
+// frames and returns the next observation, a reward and whether the
+// episode is over.
+//
+// What counts as reward and as the end of an episode is game specific and
+// comes from a JSON config, for example
+//
+//	{
+//	  "title": "Pong",
+//	  "frameSkip": 4,
+//	  "actions": [[], [1], [4]],
+//	  "reward": [{"address": "0x2F0", "size": 3, "encoding": "digits"}],
+//	  "done": [{"address": "0x2F3", "size": 1, "encoding": "binary", "op": ">=", "value": 9}]
+//	}
+package env
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+var ErrEpisodeOver = errors.New("env: episode is over, call Reset")
+
+// Observation is the display, one byte per pixel in row-major order, 1
+// for lit and 0 for dark.
+type Observation [cpu.DisplayWidth * cpu.DisplayHeight]uint8
+
+type Env struct {
+	cpu    *cpu.Cpu
+	rom    *loader.ROM
+	config Config
+	seed   int64
+
+	previous []int
+	steps    int
+	done     bool
+}
+
+// New creates an environment that plays rom on c. Call Reset before the
+// first Step. Fields of config left at zero get the same defaults as in
+// a config file.
+func New(c *cpu.Cpu, rom *loader.ROM, config Config) (*Env, error) {
+	config = config.withDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Env{
+		cpu:      c,
+		rom:      rom,
+		config:   config,
+		previous: make([]int, len(config.Reward)),
+		done:     true,
+	}, nil
+}
+
+// Seed makes the following episodes reproducible.
+func (e *Env) Seed(seed int64) {
+	e.seed = seed
+}
+
+func (e *Env) ActionCount() int {
+	return len(e.config.Actions)
+}
+
+// Cpu gives access to the machine, for inspection between steps.
+func (e *Env) Cpu() *cpu.Cpu {
+	return e.cpu
+}
+
+// Reset reloads the ROM and starts a new episode. Successive episodes
+// draw different random numbers unless Seed is called in between.
+func (e *Env) Reset() (Observation, error) {
+	if err := e.rom.Load(e.cpu); err != nil {
+		return Observation{}, err
+	}
+	e.cpu.Keys = [16]bool{}
+	e.cpu.Rand = rand.New(rand.NewSource(e.seed))
+	e.seed++
+
+	for i, r := range e.config.Reward {
+		e.previous[i] = r.read(e.cpu.Memory)
+	}
+	e.steps = 0
+	e.done = false
+
+	return e.cpu.Display, nil
+}
+
+// Step holds the keys of action for FrameSkip frames and returns the
+// resulting observation, the reward earned over those frames and whether
+// the episode has ended, either by a done rule or by reaching MaxSteps.
+func (e *Env) Step(action int) (Observation, float64, bool, error) {
+	if e.done {
+		return Observation{}, 0, true, ErrEpisodeOver
+	}
+	if action < 0 || action >= len(e.config.Actions) {
+		return Observation{}, 0, false, fmt.Errorf("env: action %d out of range 0-%d", action, len(e.config.Actions)-1)
+	}
+
+	e.cpu.Keys = [16]bool{}
+	for _, key := range e.config.Actions[action] {
+		e.cpu.Keys[key] = true
+	}
+
+	for f := 0; f < e.config.FrameSkip; f++ {
+		for i := 0; i < e.config.InstructionsPerFrame; i++ {
+			e.cpu.Execute()
+		}
+		e.cpu.TickTimers()
+	}
+	e.steps++
+
+	var reward float64
+	for i, r := range e.config.Reward {
+		value := r.read(e.cpu.Memory)
+		reward += r.Scale * float64(value-e.previous[i])
+		e.previous[i] = value
+	}
+
+	for _, d := range e.config.Done {
+		if ops[d.Op](d.read(e.cpu.Memory), d.Compare) {
+			e.done = true
+		}
+	}
+	if e.config.MaxSteps > 0 && e.steps >= e.config.MaxSteps {
+		e.done = true
+	}
+
+	return e.cpu.Display, reward, e.done, nil
+}
@@ -0,0 +1,177 @@
+package env
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+// counter adds one to V1 each time round its loop while key 5 is held,
+// keeps the count at 0x300 with Fx33 and sets 0x310 when it reaches 100.
+var counter = []byte{
+	0x65, 0x05, // LD V5, 5
+	0xA3, 0x00, // LD I, 0x300
+	0xE5, 0xA1, // SKNP V5
+	0x71, 0x01, // ADD V1, 1
+	0xF1, 0x33, // LD B, V1
+	0x31, 0x64, // SE V1, 100
+	0x12, 0x04, // JP 0x204
+	0x60, 0x01, // LD V0, 1
+	0xA3, 0x10, // LD I, 0x310
+	0xF0, 0x55, // LD [I], V0
+	0x12, 0x14, // JP 0x214
+}
+
+func newCounter(t *testing.T) *Env {
+	t.Helper()
+
+	config, err := LoadConfig("testdata/counter.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom, err := loader.Parse("counter.ch8", counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(cpu.NewCpu(4096, 0x200), rom, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEpisode(t *testing.T) {
+	e := newCounter(t)
+
+	if e.ActionCount() != 2 {
+		t.Errorf("Expected 2 actions, got %d", e.ActionCount())
+	}
+	if _, _, _, err := e.Step(0); !errors.Is(err, ErrEpisodeOver) {
+		t.Errorf("Expected Step before Reset to fail with ErrEpisodeOver, got %v", err)
+	}
+
+	obs, err := e.Reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obs != (Observation{}) {
+		t.Errorf("Expected a blank screen after Reset")
+	}
+
+	_, reward, done, err := e.Step(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reward != 0 || done {
+		t.Errorf("Expected no reward without the key, got %v (done %v)", reward, done)
+	}
+
+	var total float64
+	steps := 0
+	for !done {
+		if steps++; steps > 100 {
+			t.Fatal("Expected the episode to end")
+		}
+		_, reward, done, err = e.Step(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reward <= 0 {
+			t.Errorf("Expected a positive reward while holding the key, got %v at step %d", reward, steps)
+		}
+		total += reward
+	}
+	if total != 100 {
+		t.Errorf("Expected the rewards to add up to the score of 100, got %v", total)
+	}
+
+	if _, _, _, err := e.Step(0); !errors.Is(err, ErrEpisodeOver) {
+		t.Errorf("Expected Step after the end to fail with ErrEpisodeOver, got %v", err)
+	}
+
+	if _, err := e.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, reward, done, _ = e.Step(1); reward <= 0 || done {
+		t.Errorf("Expected Reset to start a new episode, got reward %v (done %v)", reward, done)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	rom, _ := loader.Parse("counter.ch8", counter)
+	e, err := New(cpu.NewCpu(4096, 0x200), rom, Config{MaxSteps: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.ActionCount() != 17 {
+		t.Errorf("Expected the default 17 actions, got %d", e.ActionCount())
+	}
+	e.Reset()
+	for i := 1; i <= 3; i++ {
+		_, _, done, err := e.Step(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done != (i == 3) {
+			t.Errorf("Expected done to be %v after step %d, got %v", i == 3, i, done)
+		}
+	}
+}
+
+func TestStepRejectsUnknownAction(t *testing.T) {
+	e := newCounter(t)
+	e.Reset()
+
+	for _, action := range []int{-1, 2} {
+		if _, _, _, err := e.Step(action); err == nil {
+			t.Errorf("Expected action %d to be rejected", action)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	memory := make([]uint8, 16)
+	copy(memory, []uint8{0x01, 0x02, 0x03, 0x12, 0x34})
+	memory[15] = 0x07
+
+	tests := []struct {
+		value Value
+		want  int
+	}{
+		{Value{Address: 0, Size: 2, Encoding: "binary"}, 0x0102},
+		{Value{Address: 0, Size: 3, Encoding: "digits"}, 123},
+		{Value{Address: 3, Size: 2, Encoding: "bcd"}, 1234},
+		{Value{Address: 15, Size: 2, Encoding: "binary"}, 0x0701},
+	}
+	for _, test := range tests {
+		if got := test.value.read(memory); got != test.want {
+			t.Errorf("Expected %+v to read %d, got %d", test.value, test.want, got)
+		}
+	}
+}
+
+func TestParseConfigReportsEveryError(t *testing.T) {
+	_, err := ParseConfig([]byte(`{
+		"frameSkip": -1,
+		"actions": [[16]],
+		"reward": [{"address": "0x300", "size": 9, "encoding": "digits"}],
+		"done": [{"address": 784, "size": 1, "encoding": "ascii", "op": "=~"}]
+	}`))
+	if err == nil {
+		t.Fatal("Expected the config to be rejected")
+	}
+
+	for _, want := range []string{"frameSkip", "actions[0]", "reward[0]: size", "done[0]: unknown encoding", "done[0]: unknown op"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, got %v", want, err)
+		}
+	}
+
+	if _, err := ParseConfig([]byte(`{"address": "0x300"}`)); err == nil {
+		t.Errorf("Expected unknown fields to be rejected")
+	}
+}
@@ -0,0 +1,145 @@
+package cpu
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+const maxFuzzSteps = 1000
+
+func quirksFromByte(b uint8) Quirks {
+	return Quirks{
+		Shift:           b&0x01 != 0,
+		MemoryIncrement: b&0x02 != 0,
+		Jump:            b&0x04 != 0,
+		VfReset:         b&0x08 != 0,
+		Wrap:            b&0x10 != 0,
+	}
+}
+
+// fuzzCpu builds a machine from fuzzer input: the memory layout and
+// quirks, then the registers, I, keys, timers and SP taken from state.
+// SP covers the whole byte, not just the depth of the stack.
+func fuzzCpu(memorySize, programStart uint16, quirks uint8, state, rom []byte) (*Cpu, bool) {
+	c := NewCpu(memorySize, programStart)
+	c.Config.Quirks = quirksFromByte(quirks)
+	c.Rand = rand.New(rand.NewSource(1))
+	if err := c.LoadGame(rom); err != nil {
+		return nil, false
+	}
+
+	for i := 0; i < len(state) && i < len(c.Registers); i++ {
+		c.Registers[i] = state[i]
+	}
+	if len(state) >= 18 {
+		c.I = uint16(state[16])<<8 | uint16(state[17])
+	}
+	if len(state) >= 20 {
+		for i := range c.Keys {
+			c.Keys[i] = (uint16(state[18])<<8|uint16(state[19]))&(1<<i) != 0
+		}
+	}
+	if len(state) >= 22 {
+		c.Dt = state[20]
+		c.St = state[21]
+	}
+	if len(state) >= 23 {
+		c.Sp = state[22]
+	}
+
+	return c, true
+}
+
+func addFuzzSeeds(f *testing.F) {
+	f.Add(uint16(4096), uint16(0x200), uint8(0), []byte{}, []byte{0x22, 0x00}, uint16(100))
+	f.Add(uint16(4096), uint16(0x200), uint8(0), []byte{}, []byte{0x1F, 0xFF}, uint16(10))
+	f.Add(uint16(4096), uint16(0x200), uint8(0), []byte{}, []byte{0x00, 0xEE}, uint16(10))
+	f.Add(uint16(4096), uint16(0x200), uint8(0), []byte{22: 0xFF}, []byte{0x00, 0xEE, 0x22, 0x00}, uint16(10))
+	f.Add(uint16(4096), uint16(0x200), uint8(0), []byte{22: 16}, []byte{0x22, 0x00}, uint16(10))
+	f.Add(uint16(4096), uint16(0x200), uint8(0x1F),
+		[]byte{0: 0x3F, 1: 0x1F, 16: 0xFF, 17: 0xFE}, []byte{0xD0, 0x1F, 0xF2, 0x33, 0xFF, 0x55, 0xFF, 0x65}, uint16(10))
+	f.Add(uint16(4096), uint16(0x200), uint8(0x04), []byte{0xFF}, []byte{0xBF, 0xFF}, uint16(10))
+	f.Add(uint16(512), uint16(0x100), uint8(0), []byte{}, []byte{0xF0, 0x0A}, uint16(10))
+	f.Add(uint16(0x300), uint16(0x2FF), uint8(0), []byte{}, []byte{0x12}, uint16(10))
+}
+
+func FuzzExecute(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, memorySize, programStart uint16, quirks uint8, state, rom []byte, steps uint16) {
+		c, ok := fuzzCpu(memorySize, programStart, quirks, state, rom)
+		if !ok {
+			return
+		}
+
+		// A jump may leave PC past the end until the next fetch wraps it,
+		// so the invariant is checked where PC is used.
+		bus := NewMemoryBus(c.Memory)
+		step := 0
+		bus.OnExecute(0, 0xFFFF, func(addr uint16, _ uint8) {
+			if int(addr) >= len(c.Memory) {
+				t.Fatalf("Expected instructions to be fetched within memory, got 0x%X in step %d", addr, step+1)
+			}
+		})
+		c.Bus = bus
+
+		// An SP that starts past the stack must never be pushed further.
+		maxSp := max(int(c.Sp), len(c.Stack))
+		for step = 0; step < int(steps%maxFuzzSteps); step++ {
+			i := step
+			c.Execute()
+			c.TickTimers()
+
+			if int(c.Sp) > maxSp {
+				t.Fatalf("Expected SP to stay within %d, got %d after %d steps", maxSp, c.Sp, i+1)
+			}
+			if len(c.Memory) != int(memorySize) {
+				t.Fatalf("Expected memory to stay %d bytes, got %d", memorySize, len(c.Memory))
+			}
+		}
+	})
+}
+
+func FuzzSnapshotRestore(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, memorySize, programStart uint16, quirks uint8, state, rom []byte, steps uint16) {
+		c, ok := fuzzCpu(memorySize, programStart, quirks, state, rom)
+		if !ok {
+			return
+		}
+
+		n := int(steps % maxFuzzSteps)
+		for i := 0; i < n/2; i++ {
+			c.Execute()
+		}
+
+		snapshot := c.Snapshot()
+		restored := NewCpu(memorySize, programStart)
+		restored.Config = c.Config
+		if int(snapshot.Sp) > len(snapshot.Stack) {
+			if err := restored.Restore(snapshot); err == nil {
+				t.Fatalf("Expected restoring SP %d to fail", snapshot.Sp)
+			}
+			return
+		}
+		if err := restored.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if got := restored.Snapshot(); !reflect.DeepEqual(got, snapshot) {
+			t.Fatal("Expected restored snapshot to match the original")
+		}
+
+		c.Rand = rand.New(rand.NewSource(2))
+		restored.Rand = rand.New(rand.NewSource(2))
+		for i := n / 2; i < n; i++ {
+			c.Execute()
+			restored.Execute()
+		}
+
+		if !reflect.DeepEqual(c.Snapshot(), restored.Snapshot()) {
+			t.Fatal("Expected original and restored machines to stay in step")
+		}
+	})
+}
@@ -7,10 +7,15 @@ type Instruction struct {
 	Handler func(c *Cpu, opcode uint16)
 }
 
-var instructions []Instruction
+// Instructions returns the instruction table in decode order: an opcode
+// is handled by the first entry it matches.
+func Instructions() []Instruction {
+	return newInstructionSet()
+}
 
-func init() {
-	instructions = []Instruction{
+func newInstructionSet() []Instruction {
+	return []Instruction{
+		{Name: "CLS (00E0)", Mask: 0xFFFF, Pattern: 0x00E0, Handler: handleCls},
 		{Name: "RET (00EE)", Mask: 0xFFFF, Pattern: 0x00EE, Handler: handleRet},
 		{Name: "LD Vx, Vy (8xy0)", Mask: 0xF00F, Pattern: 0x8000, Handler: handleStoreValFromReg},
 		{Name: "OR Vx, Vy (8xy1)", Mask: 0xF00F, Pattern: 0x8001, Handler: handleBitwiseOr},
@@ -21,7 +26,7 @@ func init() {
 		{Name: "SHR Vx {, Vy} (8xy6)", Mask: 0xF00F, Pattern: 0x8006, Handler: handleShrVx},
 		{Name: "SUBN Vx, Vy (8xy7)", Mask: 0xF00F, Pattern: 0x8007, Handler: handleSubnVxVy},
 		{Name: "SHL Vx {, Vy} (8xyE)", Mask: 0xF00F, Pattern: 0x800E, Handler: handleShlVx},
-		{Name: "SNE Vx, Vy (9xy0)", Mask: 0xF000, Pattern: 0x9000, Handler: handleSneVxVy},
+		{Name: "SNE Vx, Vy (9xy0)", Mask: 0xF00F, Pattern: 0x9000, Handler: handleSneVxVy},
 		{Name: "LD I, addr (Annn)", Mask: 0xF000, Pattern: 0xA000, Handler: handleLdIAddr},
 		{Name: "JP V0, addr (Bnnn)", Mask: 0xF000, Pattern: 0xB000, Handler: handleJumpAddrV0},
 		{Name: "RND Vx, byte (Cxkk)", Mask: 0xF000, Pattern: 0xC000, Handler: handleRndVxByte},
@@ -30,9 +35,21 @@ func init() {
 		{Name: "CALL addr (2nnn)", Mask: 0xF000, Pattern: 0x2000, Handler: handleCallAddr},
 		{Name: "SE Vx, byte (3xkk)", Mask: 0xF000, Pattern: 0x3000, Handler: handleSkipIfEqual},
 		{Name: "SNE Vx, byte (4xkk)", Mask: 0xF000, Pattern: 0x4000, Handler: handleSkipIfNotEqual},
-		{Name: "SE Vx, Vy (5xy0)", Mask: 0xF000, Pattern: 0x5000, Handler: handleSkipIfRegEqual},
+		{Name: "SE Vx, Vy (5xy0)", Mask: 0xF00F, Pattern: 0x5000, Handler: handleSkipIfRegEqual},
 		{Name: "LD Vx, byte (6xkk)", Mask: 0xF000, Pattern: 0x6000, Handler: handlePutValueInReg},
 		{Name: "ADD Vx, byte (7xkk)", Mask: 0xF000, Pattern: 0x7000, Handler: handleAddVxByte},
+		{Name: "DRW Vx, Vy, nibble (Dxyn)", Mask: 0xF000, Pattern: 0xD000, Handler: handleDrw},
+		{Name: "SKP Vx (Ex9E)", Mask: 0xF0FF, Pattern: 0xE09E, Handler: handleSkp},
+		{Name: "SKNP Vx (ExA1)", Mask: 0xF0FF, Pattern: 0xE0A1, Handler: handleSknp},
+		{Name: "LD Vx, DT (Fx07)", Mask: 0xF0FF, Pattern: 0xF007, Handler: handleLdVxDt},
+		{Name: "LD Vx, K (Fx0A)", Mask: 0xF0FF, Pattern: 0xF00A, Handler: handleLdVxK},
+		{Name: "LD DT, Vx (Fx15)", Mask: 0xF0FF, Pattern: 0xF015, Handler: handleLdDtVx},
+		{Name: "LD ST, Vx (Fx18)", Mask: 0xF0FF, Pattern: 0xF018, Handler: handleLdStVx},
+		{Name: "ADD I, Vx (Fx1E)", Mask: 0xF0FF, Pattern: 0xF01E, Handler: handleAddIVx},
+		{Name: "LD F, Vx (Fx29)", Mask: 0xF0FF, Pattern: 0xF029, Handler: handleLdFVx},
+		{Name: "LD B, Vx (Fx33)", Mask: 0xF0FF, Pattern: 0xF033, Handler: handleLdBVx},
+		{Name: "LD [I], Vx (Fx55)", Mask: 0xF0FF, Pattern: 0xF055, Handler: handleStoreRegs},
+		{Name: "LD Vx, [I] (Fx65)", Mask: 0xF0FF, Pattern: 0xF065, Handler: handleLoadRegs},
 	}
 }
 
@@ -52,8 +69,13 @@ func handleSysAddr(c *Cpu, opcode uint16) {
 	c.Pc += 2
 }
 
+func handleCls(c *Cpu, opcode uint16) {
+	c.Display = [DisplayWidth * DisplayHeight]uint8{}
+	c.Pc += 2
+}
+
 func handleRet(c *Cpu, opcode uint16) {
-	if c.Sp == 0 {
+	if c.Sp == 0 || int(c.Sp) > len(c.Stack) {
 		return
 	}
 	c.Sp--
@@ -61,6 +83,10 @@ func handleRet(c *Cpu, opcode uint16) {
 }
 
 func handleCallAddr(c *Cpu, opcode uint16) {
+	if int(c.Sp) >= len(c.Stack) {
+		c.Pc += 2
+		return
+	}
 	addr := opcode & 0x0FFF
 	c.Stack[c.Sp] = c.Pc + 2
 	c.Sp++
@@ -120,6 +146,9 @@ func handleBitwiseOr(c *Cpu, opcode uint16) {
 	y := (opcode & 0x00F0) >> 4
 
 	c.Registers[x] = c.Registers[x] | c.Registers[y]
+	if c.Config.Quirks.VfReset {
+		c.Registers[15] = 0
+	}
 
 	c.Pc += 2
 }
@@ -129,6 +158,9 @@ func handleBitwiseAnd(c *Cpu, opcode uint16) {
 	y := (opcode & 0x00F0) >> 4
 
 	c.Registers[x] = c.Registers[x] & c.Registers[y]
+	if c.Config.Quirks.VfReset {
+		c.Registers[15] = 0
+	}
 	c.Pc += 2
 }
 
@@ -137,22 +169,29 @@ func handleBitwiseXor(c *Cpu, opcode uint16) {
 	y := (opcode & 0x00F0) >> 4
 
 	c.Registers[x] = c.Registers[x] ^ c.Registers[y]
+	if c.Config.Quirks.VfReset {
+		c.Registers[15] = 0
+	}
 	c.Pc += 2
 }
 
-func handleAddVxVy(c *Cpu, opcode uint16) {
-	x := (opcode & 0x0F00) >> 8
-	y := (opcode & 0x00F0) >> 4
-
-	sum := uint16(c.Registers[x]) + uint16(c.Registers[y])
-
-	if sum > 255 {
+// setFlag writes VF after an instruction has stored its result, so the
+// flag wins when Vx is VF.
+func (c *Cpu) setFlag(set bool) {
+	if set {
 		c.Registers[15] = 1
 	} else {
 		c.Registers[15] = 0
 	}
+}
+
+func handleAddVxVy(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
 
+	sum := uint16(c.Registers[x]) + uint16(c.Registers[y])
 	c.Registers[x] = uint8(sum)
+	c.setFlag(sum > 255)
 	c.Pc += 2
 }
 
@@ -160,26 +199,23 @@ func handleSubVxVy(c *Cpu, opcode uint16) {
 	x := (opcode & 0x0F00) >> 8
 	y := (opcode & 0x00F0) >> 4
 
-	if c.Registers[x] > c.Registers[y] {
-		c.Registers[15] = 1
-	} else {
-		c.Registers[15] = 0
-	}
-
-	c.Registers[x] = c.Registers[x] - c.Registers[y]
+	vx, vy := c.Registers[x], c.Registers[y]
+	c.Registers[x] = vx - vy
+	c.setFlag(vx >= vy)
 	c.Pc += 2
 }
 
 func handleShrVx(c *Cpu, opcode uint16) {
 	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
 
-	if (c.Registers[x] & 0x01) == 1 {
-		c.Registers[15] = 1
-	} else {
-		c.Registers[15] = 0
+	value := c.Registers[x]
+	if c.Config.Quirks.Shift {
+		value = c.Registers[y]
 	}
 
-	c.Registers[x] = c.Registers[x] / 2
+	c.Registers[x] = value / 2
+	c.setFlag(value&0x01 == 1)
 	c.Pc += 2
 }
 
@@ -187,26 +223,23 @@ func handleSubnVxVy(c *Cpu, opcode uint16) {
 	x := (opcode & 0x0F00) >> 8
 	y := (opcode & 0x00F0) >> 4
 
-	if c.Registers[y] > c.Registers[x] {
-		c.Registers[15] = 1
-	} else {
-		c.Registers[15] = 0
-	}
-
-	c.Registers[x] = c.Registers[y] - c.Registers[x]
+	vx, vy := c.Registers[x], c.Registers[y]
+	c.Registers[x] = vy - vx
+	c.setFlag(vy >= vx)
 	c.Pc += 2
 }
 
 func handleShlVx(c *Cpu, opcode uint16) {
 	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
 
-	if (c.Registers[x] & 0x80) != 0 {
-		c.Registers[15] = 1
-	} else {
-		c.Registers[15] = 0
+	value := c.Registers[x]
+	if c.Config.Quirks.Shift {
+		value = c.Registers[y]
 	}
 
-	c.Registers[x] = c.Registers[x] * 2
+	c.Registers[x] = value * 2
+	c.setFlag(value&0x80 != 0)
 	c.Pc += 2
 }
 
@@ -229,6 +262,13 @@ func handleLdIAddr(c *Cpu, opcode uint16) {
 
 func handleJumpAddrV0(c *Cpu, opcode uint16) {
 	addr := opcode & 0x0FFF
+
+	if c.Config.Quirks.Jump {
+		x := (opcode & 0x0F00) >> 8
+		c.Pc = uint16(c.Registers[x]) + addr
+		return
+	}
+
 	c.Pc = uint16(c.Registers[0]) + addr
 }
 
@@ -236,8 +276,150 @@ func handleRndVxByte(c *Cpu, opcode uint16) {
 	x := (opcode & 0x0F00) >> 8
 	kk := uint8(opcode & 0x00FF)
 
-	randomByte := uint8(randIntn(256))
+	randomByte := uint8(c.Rand.Intn(256))
 
 	c.Registers[x] = randomByte & kk
 	c.Pc += 2
 }
+
+func handleDrw(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
+	n := opcode & 0x000F
+
+	startX := int(c.Registers[x]) % DisplayWidth
+	startY := int(c.Registers[y]) % DisplayHeight
+	wrap := c.Config.Quirks.Wrap
+
+	c.Registers[15] = 0
+
+	for row := 0; row < int(n); row++ {
+		py := startY + row
+		if py >= DisplayHeight {
+			if !wrap {
+				break
+			}
+			py %= DisplayHeight
+		}
+
+		spriteByte := c.read(c.I + uint16(row))
+
+		for bit := 0; bit < 8; bit++ {
+			px := startX + bit
+			if px >= DisplayWidth {
+				if !wrap {
+					break
+				}
+				px %= DisplayWidth
+			}
+
+			if spriteByte&(0x80>>bit) == 0 {
+				continue
+			}
+
+			pixel := &c.Display[py*DisplayWidth+px]
+			if *pixel == 1 {
+				c.Registers[15] = 1
+			}
+			*pixel ^= 1
+		}
+	}
+
+	c.Pc += 2
+}
+
+func handleSkp(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+
+	if c.Keys[c.Registers[x]&0x0F] {
+		c.Pc += 4
+	} else {
+		c.Pc += 2
+	}
+}
+
+func handleSknp(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+
+	if !c.Keys[c.Registers[x]&0x0F] {
+		c.Pc += 4
+	} else {
+		c.Pc += 2
+	}
+}
+
+func handleLdVxDt(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	c.Registers[x] = c.Dt
+	c.Pc += 2
+}
+
+func handleLdVxK(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+
+	for key, pressed := range c.Keys {
+		if pressed {
+			c.Registers[x] = uint8(key)
+			c.Pc += 2
+			return
+		}
+	}
+}
+
+func handleLdDtVx(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	c.Dt = c.Registers[x]
+	c.Pc += 2
+}
+
+func handleLdStVx(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	c.St = c.Registers[x]
+	c.Pc += 2
+}
+
+func handleAddIVx(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	c.I += uint16(c.Registers[x])
+	c.Pc += 2
+}
+
+func handleLdFVx(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	c.I = FontStart + uint16(c.Registers[x]&0x0F)*FontGlyphSize
+	c.Pc += 2
+}
+
+func handleLdBVx(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+	value := c.Registers[x]
+
+	c.write(c.I, value/100)
+	c.write(c.I+1, (value/10)%10)
+	c.write(c.I+2, value%10)
+	c.Pc += 2
+}
+
+func handleStoreRegs(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+
+	for i := uint16(0); i <= x; i++ {
+		c.write(c.I+i, c.Registers[i])
+	}
+	if c.Config.Quirks.MemoryIncrement {
+		c.I += x + 1
+	}
+	c.Pc += 2
+}
+
+func handleLoadRegs(c *Cpu, opcode uint16) {
+	x := (opcode & 0x0F00) >> 8
+
+	for i := uint16(0); i <= x; i++ {
+		c.Registers[i] = c.read(c.I + i)
+	}
+	if c.Config.Quirks.MemoryIncrement {
+		c.I += x + 1
+	}
+	c.Pc += 2
+}
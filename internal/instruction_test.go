@@ -1,6 +1,7 @@
 package cpu
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -67,6 +68,29 @@ func TestInstruction_00EE(t *testing.T) {
 	}
 }
 
+func TestInstruction_00EE_sp_past_stack(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	cpu.Sp = 17
+
+	opcode := uint16(0x00EE)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Execute()
+
+	expectedPc := uint16(0x100)
+	if cpu.Pc != expectedPc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+
+	expectedSp := uint8(17)
+	if cpu.Sp != expectedSp {
+		t.Errorf("Expected SP to be %d, got %d", expectedSp, cpu.Sp)
+	}
+}
+
 func TestInstruction_0NNN(t *testing.T) {
 	cpu := NewCpu(512, 0x100)
 
@@ -573,20 +597,621 @@ func TestInstruction_CXKK(t *testing.T) {
 	cpu.Memory[0x100] = uint8(opcode >> 8)
 	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
 
-	originalRandIntn := randIntn
+	cpu.Rand = rand.New(rand.NewSource(1))
+
+	cpu.Execute()
+
+	expectedRegisterValue := uint8(rand.New(rand.NewSource(1)).Intn(256)) & 0xAA
+	if expectedRegisterValue != cpu.Registers[3] {
+		t.Errorf("Expected Register[3] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[3])
+	}
+}
+
+func TestInstruction_00E0(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0x00E0)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Display[10] = 1
+
+	cpu.Execute()
+
+	if cpu.Display[10] != 0 {
+		t.Errorf("Expected display to be cleared, got pixel %d", cpu.Display[10])
+	}
+
+	expectedPc := uint16(0x102)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+}
+
+func TestInstruction_DXYN(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xD122)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Memory[0x180] = 0xC0
+	cpu.Memory[0x181] = 0x01
+	cpu.I = 0x180
+	cpu.Registers[1] = 2
+	cpu.Registers[2] = 3
+
+	cpu.Execute()
+
+	for _, pixel := range []int{3*DisplayWidth + 2, 3*DisplayWidth + 3, 4*DisplayWidth + 9} {
+		if cpu.Display[pixel] != 1 {
+			t.Errorf("Expected pixel %d to be set", pixel)
+		}
+	}
+
+	expectedVFValue := uint8(0x0)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_DXYN_collision(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xD121)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Memory[0x180] = 0x80
+	cpu.I = 0x180
+	cpu.Display[0] = 1
+
+	cpu.Execute()
+
+	if cpu.Display[0] != 0 {
+		t.Errorf("Expected pixel 0 to be erased, got %d", cpu.Display[0])
+	}
+
+	expectedVFValue := uint8(0x1)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_DXYN_clipping(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xD121)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Memory[0x180] = 0xFF
+	cpu.I = 0x180
+	cpu.Registers[1] = 60
+
+	cpu.Execute()
+
+	if cpu.Display[63] != 1 {
+		t.Errorf("Expected pixel 63 to be set")
+	}
+
+	if cpu.Display[DisplayWidth] != 0 {
+		t.Errorf("Expected sprite to be clipped at the right edge")
+	}
+}
+
+func TestInstruction_EX9E(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xE39E)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[3] = 0xA
+	cpu.Keys[0xA] = true
+
+	cpu.Execute()
+
+	expectedPc := uint16(0x104)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+}
+
+func TestInstruction_EXA1(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xE3A1)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[3] = 0xA
+	cpu.Keys[0xA] = true
+
+	cpu.Execute()
+
+	expectedPc := uint16(0x102)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+}
+
+func TestInstruction_FX07(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF507)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Dt = 0x33
+
+	cpu.Execute()
+
+	expectedRegisterValue := uint8(0x33)
+	if expectedRegisterValue != cpu.Registers[5] {
+		t.Errorf("Expected Register[5] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[5])
+	}
+}
+
+func TestInstruction_FX0A(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF50A)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Execute()
+
+	expectedPc := uint16(0x100)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to wait at 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+
+	cpu.Keys[0x7] = true
+
+	cpu.Execute()
+
+	expectedPc = uint16(0x102)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+
+	expectedRegisterValue := uint8(0x7)
+	if expectedRegisterValue != cpu.Registers[5] {
+		t.Errorf("Expected Register[5] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[5])
+	}
+}
+
+func TestInstruction_FX15(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF515)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[5] = 0x20
+
+	cpu.Execute()
+
+	expectedDt := uint8(0x20)
+	if expectedDt != cpu.Dt {
+		t.Errorf("Expected DT to be 0x%X, got 0x%X", expectedDt, cpu.Dt)
+	}
+}
+
+func TestInstruction_FX18(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF518)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[5] = 0x20
+
+	cpu.Execute()
+
+	expectedSt := uint8(0x20)
+	if expectedSt != cpu.St {
+		t.Errorf("Expected ST to be 0x%X, got 0x%X", expectedSt, cpu.St)
+	}
+
+	if !cpu.SoundActive() {
+		t.Errorf("Expected sound to be active")
+	}
+}
+
+func TestInstruction_FX1E(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF51E)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.I = 0x100
+	cpu.Registers[5] = 0x20
+
+	cpu.Execute()
+
+	expectedI := uint16(0x120)
+	if expectedI != cpu.I {
+		t.Errorf("Expected I to be 0x%X, got 0x%X", expectedI, cpu.I)
+	}
+}
+
+func TestInstruction_FX29(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF529)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[5] = 0xA
 
-	defer func() {
-		randIntn = originalRandIntn
-	}()
+	cpu.Execute()
 
-	randIntn = func(n int) int {
-		return 40
+	expectedI := uint16(FontStart + 0xA*FontGlyphSize)
+	if expectedI != cpu.I {
+		t.Errorf("Expected I to be 0x%X, got 0x%X", expectedI, cpu.I)
+	}
+
+	if cpu.Memory[cpu.I] != 0xF0 {
+		t.Errorf("Expected glyph A to start with 0xF0, got 0x%X", cpu.Memory[cpu.I])
 	}
+}
+
+func TestInstruction_FX33(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF533)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.I = 0x180
+	cpu.Registers[5] = 254
 
 	cpu.Execute()
 
-	expectedRegisterValue := uint8(40 & 0xAA)
+	expected := []uint8{2, 5, 4}
+	for i, digit := range expected {
+		if cpu.Memory[0x180+i] != digit {
+			t.Errorf("Expected Memory[0x%X] to be %d, got %d", 0x180+i, digit, cpu.Memory[0x180+i])
+		}
+	}
+}
+
+func TestInstruction_FX55(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF255)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.I = 0x180
+	cpu.Registers[0] = 1
+	cpu.Registers[1] = 2
+	cpu.Registers[2] = 3
+	cpu.Registers[3] = 4
+
+	cpu.Execute()
+
+	expected := []uint8{1, 2, 3, 0}
+	for i, value := range expected {
+		if cpu.Memory[0x180+i] != value {
+			t.Errorf("Expected Memory[0x%X] to be %d, got %d", 0x180+i, value, cpu.Memory[0x180+i])
+		}
+	}
+}
+
+func TestInstruction_FX65(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0xF265)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.I = 0x180
+	cpu.Memory[0x180] = 7
+	cpu.Memory[0x181] = 8
+	cpu.Memory[0x182] = 9
+	cpu.Memory[0x183] = 10
+
+	cpu.Execute()
+
+	expected := []uint8{7, 8, 9, 0}
+	for i, value := range expected {
+		if cpu.Registers[i] != value {
+			t.Errorf("Expected Register[%d] to be %d, got %d", i, value, cpu.Registers[i])
+		}
+	}
+}
+
+func TestTickTimers(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	cpu.Dt = 2
+	cpu.St = 1
+
+	cpu.TickTimers()
+
+	if cpu.Dt != 1 {
+		t.Errorf("Expected DT to be 1, got %d", cpu.Dt)
+	}
+
+	if cpu.St != 0 || cpu.SoundActive() {
+		t.Errorf("Expected ST to reach 0 and sound to stop, got %d", cpu.St)
+	}
+
+	cpu.TickTimers()
+	cpu.TickTimers()
+
+	if cpu.Dt != 0 {
+		t.Errorf("Expected DT to stop at 0, got %d", cpu.Dt)
+	}
+}
+
+func TestInstruction_8XY6_shift_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.Shift = true
+
+	opcode := uint16(0x8346)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[3] = 0x10
+	cpu.Registers[4] = 0x05
+
+	cpu.Execute()
+
+	expectedRegisterValue := uint8(0x02)
+	if expectedRegisterValue != cpu.Registers[3] {
+		t.Errorf("Expected Register[3] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[3])
+	}
+
+	expectedVFValue := uint8(0x1)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_8XYE_shift_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.Shift = true
+
+	opcode := uint16(0x834E)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[3] = 0x01
+	cpu.Registers[4] = 0x81
+
+	cpu.Execute()
+
+	expectedRegisterValue := uint8(0x02)
 	if expectedRegisterValue != cpu.Registers[3] {
 		t.Errorf("Expected Register[3] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[3])
 	}
+
+	expectedVFValue := uint8(0x1)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_8XY1_vf_reset_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.VfReset = true
+
+	opcode := uint16(0x8341)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[15] = 1
+
+	cpu.Execute()
+
+	expectedVFValue := uint8(0x0)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_BNNN_jump_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.Jump = true
+
+	opcode := uint16(0xB234)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[0] = 0x10
+	cpu.Registers[2] = 0x20
+
+	cpu.Execute()
+
+	expectedPc := uint16(0x254)
+	if expectedPc != cpu.Pc {
+		t.Errorf("Expected PC to be 0x%X, got 0x%X", expectedPc, cpu.Pc)
+	}
+}
+
+func TestInstruction_FX55_memory_increment_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.MemoryIncrement = true
+
+	opcode := uint16(0xF255)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.I = 0x180
+
+	cpu.Execute()
+
+	expectedI := uint16(0x183)
+	if expectedI != cpu.I {
+		t.Errorf("Expected I to be 0x%X, got 0x%X", expectedI, cpu.I)
+	}
+}
+
+func TestInstruction_DXYN_wrap_quirk(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+	cpu.Config.Quirks.Wrap = true
+
+	opcode := uint16(0xD121)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Memory[0x180] = 0xFF
+	cpu.I = 0x180
+	cpu.Registers[1] = 60
+
+	cpu.Execute()
+
+	if cpu.Display[63] != 1 || cpu.Display[0] != 1 || cpu.Display[3] != 1 {
+		t.Errorf("Expected sprite to wrap to the left edge")
+	}
+}
+
+func TestInstruction_8XY4_flag_wins_over_VF_result(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0x8F34)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[15] = 0xFF
+	cpu.Registers[3] = 0x02
+
+	cpu.Execute()
+
+	expectedVFValue := uint8(0x1)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_8XY6_flag_wins_over_VF_result(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0x8F06)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[15] = 0x04
+
+	cpu.Execute()
+
+	expectedVFValue := uint8(0x0)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_8XY5_equal_is_no_borrow(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	opcode := uint16(0x8345)
+
+	cpu.Memory[0x100] = uint8(opcode >> 8)
+	cpu.Memory[0x101] = uint8(opcode & 0x00FF)
+
+	cpu.Registers[3] = 0x0A
+	cpu.Registers[4] = 0x0A
+
+	cpu.Execute()
+
+	expectedRegisterValue := uint8(0x00)
+	if expectedRegisterValue != cpu.Registers[3] {
+		t.Errorf("Expected Register[3] to be 0x%X, got 0x%X", expectedRegisterValue, cpu.Registers[3])
+	}
+
+	expectedVFValue := uint8(0x1)
+	if expectedVFValue != cpu.Registers[15] {
+		t.Errorf("Expected Register[15] to be 0x%X, got 0x%X", expectedVFValue, cpu.Registers[15])
+	}
+}
+
+func TestInstruction_2NNN_stack_overflow(t *testing.T) {
+	cpu := NewCpu(4096, 0x200)
+	cpu.Sp = uint8(len(cpu.Stack))
+	cpu.Memory[0x200] = 0x23
+	cpu.Memory[0x201] = 0x45
+
+	cpu.Execute()
+
+	if cpu.Pc != 0x202 {
+		t.Errorf("Expected a CALL with a full stack to be skipped, got PC 0x%X", cpu.Pc)
+	}
+	if int(cpu.Sp) != len(cpu.Stack) {
+		t.Errorf("Expected SP to stay %d, got %d", len(cpu.Stack), cpu.Sp)
+	}
+}
+
+func TestExecute_jump_past_end_wraps(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	// JP 0x234 lands past the end of 512 bytes, so the next instruction
+	// comes from 0x234 - 0x200.
+	cpu.Memory[0x100] = 0x12
+	cpu.Memory[0x101] = 0x34
+	cpu.Memory[0x034] = 0x60
+	cpu.Memory[0x035] = 0x42
+
+	cpu.Execute()
+	cpu.Execute()
+
+	if cpu.Registers[0] != 0x42 {
+		t.Errorf("Expected the instruction at 0x034 to run, got V0=0x%X", cpu.Registers[0])
+	}
+	if cpu.Pc != 0x036 {
+		t.Errorf("Expected PC to be 0x036, got 0x%X", cpu.Pc)
+	}
+}
+
+func TestExecute_opcode_across_end_wraps(t *testing.T) {
+	cpu := NewCpu(512, 0x100)
+
+	// LD V0, 0x42 split across the last byte of memory and the first.
+	cpu.Pc = 0x1FF
+	cpu.Memory[0x1FF] = 0x60
+	cpu.Memory[0x000] = 0x42
+
+	cpu.Execute()
+
+	if cpu.Registers[0] != 0x42 {
+		t.Errorf("Expected the opcode to wrap to address 0, got V0=0x%X", cpu.Registers[0])
+	}
+	if cpu.Pc != 0x201 {
+		t.Errorf("Expected PC to advance past the end, got 0x%X", cpu.Pc)
+	}
+
+	// LD V1, 0x33 at 0x001.
+	cpu.Memory[0x001] = 0x61
+	cpu.Memory[0x002] = 0x33
+	cpu.Execute()
+	if cpu.Registers[1] != 0x33 || cpu.Pc != 0x003 {
+		t.Errorf("Expected the next fetch to wrap to 0x001, got V1=0x%X and PC 0x%X", cpu.Registers[1], cpu.Pc)
+	}
 }
@@ -0,0 +1,294 @@
+// Package keymap maps host keyboard keys to the sixteen keys of the hex
+// keypad. Host keys are named as in the KeyboardEvent.code property of
+// browsers: "KeyW", "Digit1", "ArrowUp", "Space". Frontends translate
+// their own key events to those names.
+//
+// Profiles are read from a JSON config, selected per ROM by SHA-1:
+//
+//	{
+//	  "default": "cosmac",
+//	  "profiles": {
+//	    "invaders": {"base": "cosmac", "keys": {"ArrowLeft": 4, "ArrowRight": 6, "Space": 5}}
+//	  },
+//	  "roms": {"9a0d1c3e5f7b2d4a6c8e0f1a3b5c7d9e2f4a6b8c": "invaders"}
+//	}
+package keymap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+// Keymap maps host key names to keypad indices 0x0-0xF. Several host keys
+// may press the same keypad key.
+type Keymap map[string]uint8
+
+// The COSMAC VIP keypad laid over the left of a QWERTY keyboard:
+//
+//	1 2 3 C      1 2 3 4
+//	4 5 6 D  ->  Q W E R
+//	7 8 9 E      A S D F
+//	A 0 B F      Z X C V
+var cosmac = Keymap{
+	"Digit1": 0x1, "Digit2": 0x2, "Digit3": 0x3, "Digit4": 0xC,
+	"KeyQ": 0x4, "KeyW": 0x5, "KeyE": 0x6, "KeyR": 0xD,
+	"KeyA": 0x7, "KeyS": 0x8, "KeyD": 0x9, "KeyF": 0xE,
+	"KeyZ": 0xA, "KeyX": 0x0, "KeyC": 0xB, "KeyV": 0xF,
+}
+
+var builtins = map[string]Keymap{
+	"cosmac": cosmac,
+
+	// The arrows on 2, 4, 6 and 8 with fire on 5, the directions most
+	// games use, on top of the COSMAC layout.
+	"arrows": cosmac.With(Keymap{
+		"ArrowUp": 0x2, "ArrowLeft": 0x4, "ArrowRight": 0x6, "ArrowDown": 0x8,
+		"Space": 0x5, "Enter": 0x5,
+	}),
+
+	// Every key on the key with the same label, the hex digits past 9 on
+	// the operators.
+	"numpad": {
+		"Numpad0": 0x0, "Numpad1": 0x1, "Numpad2": 0x2, "Numpad3": 0x3,
+		"Numpad4": 0x4, "Numpad5": 0x5, "Numpad6": 0x6, "Numpad7": 0x7,
+		"Numpad8": 0x8, "Numpad9": 0x9, "NumpadDivide": 0xA, "NumpadMultiply": 0xB,
+		"NumpadSubtract": 0xC, "NumpadAdd": 0xD, "NumpadEnter": 0xE, "NumpadDecimal": 0xF,
+	},
+}
+
+// Default returns the COSMAC layout.
+func Default() Keymap {
+	return maps.Clone(cosmac)
+}
+
+// Builtin returns a copy of the built-in keymap called name.
+func Builtin(name string) (Keymap, bool) {
+	k, ok := builtins[name]
+	return maps.Clone(k), ok
+}
+
+// Builtins lists the names of the built-in keymaps.
+func Builtins() []string {
+	return slices.Sorted(maps.Keys(builtins))
+}
+
+var (
+	letter = regexp.MustCompile(`^[a-zA-Z]$`)
+	digit  = regexp.MustCompile(`^[0-9]$`)
+)
+
+// codes are the code names other than letters and digits that Normalize
+// knows, by their lowercase spelling.
+var codes = map[string]string{}
+
+func init() {
+	for _, k := range builtins {
+		for name := range k {
+			codes[strings.ToLower(name)] = name
+		}
+	}
+	for _, name := range []string{"Backspace", "Tab", "Escape", "ShiftLeft", "ShiftRight", "ControlLeft", "ControlRight", "AltLeft", "AltRight"} {
+		codes[strings.ToLower(name)] = name
+	}
+}
+
+// Normalize turns the looser names found in ROM metadata, such as "w",
+// "1", " " or "space", into code names. Other names are returned
+// unchanged.
+func Normalize(name string) string {
+	switch {
+	case letter.MatchString(name):
+		return "Key" + strings.ToUpper(name)
+	case digit.MatchString(name):
+		return "Digit" + name
+	case name == " ":
+		return "Space"
+	}
+	if code, ok := codes[strings.ToLower(name)]; ok {
+		return code
+	}
+	return name
+}
+
+// With returns a copy of k with the keys of over added, replacing any
+// mapping k has for the same host key.
+func (k Keymap) With(over Keymap) Keymap {
+	out := maps.Clone(k)
+	if out == nil {
+		out = Keymap{}
+	}
+	for name, index := range over {
+		out[Normalize(name)] = index
+	}
+	return out
+}
+
+// Key returns the keypad key a host key presses.
+func (k Keymap) Key(name string) (uint8, bool) {
+	index, ok := k[Normalize(name)]
+	return index, ok
+}
+
+func (k Keymap) validate() error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(k)) {
+		if k[name] > 0xF {
+			errs = append(errs, fmt.Errorf("key %q maps to keypad index %d", name, k[name]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Profile is a keymap in a config: the keys of Base, a built-in keymap,
+// with Keys laid over them. Without a base only Keys are mapped.
+type Profile struct {
+	Base string `json:"base"`
+	Keys Keymap `json:"keys"`
+}
+
+// Config holds named profiles and which ROMs use them. Default names the
+// profile or built-in used for other ROMs, cosmac if empty.
+type Config struct {
+	Default  string             `json:"default"`
+	Profiles map[string]Profile `json:"profiles"`
+	ROMs     map[string]string  `json:"roms"`
+}
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Parse reads a config, reporting every invalid profile and ROM entry.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+
+	roms := map[string]string{}
+	for hash, profile := range c.ROMs {
+		roms[strings.ToLower(hash)] = profile
+	}
+	c.ROMs = roms
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		p := c.Profiles[name]
+		if _, ok := builtins[name]; ok {
+			errs = append(errs, fmt.Errorf("profile %q: name of a built-in keymap", name))
+		}
+		if _, ok := builtins[p.Base]; p.Base != "" && !ok {
+			errs = append(errs, fmt.Errorf("profile %q: unknown base %q", name, p.Base))
+		}
+		if err := p.Keys.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", name, err))
+		}
+	}
+	if c.Default != "" && !c.has(c.Default) {
+		errs = append(errs, fmt.Errorf("default: unknown profile %q", c.Default))
+	}
+	for _, hash := range slices.Sorted(maps.Keys(c.ROMs)) {
+		if !hashPattern.MatchString(hash) {
+			errs = append(errs, fmt.Errorf("roms: %q is not a SHA-1 hash", hash))
+		}
+		if !c.has(c.ROMs[hash]) {
+			errs = append(errs, fmt.Errorf("roms: %s: unknown profile %q", hash, c.ROMs[hash]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) has(name string) bool {
+	_, builtin := builtins[name]
+	_, profile := c.Profiles[name]
+	return builtin || profile
+}
+
+// Profile returns the keymap of a profile or built-in keymap.
+func (c *Config) Profile(name string) (Keymap, bool) {
+	if p, ok := c.Profiles[name]; ok {
+		return builtins[p.Base].With(p.Keys), true
+	}
+	return Builtin(name)
+}
+
+// ForROM picks the keymap for rom: the profile the config assigns to its
+// hash, else the keymap its ROM database entry gives laid over the
+// default, else the default. c and db may be nil.
+func (c *Config) ForROM(rom []byte, db *romdb.DB) Keymap {
+	if c == nil {
+		c = &Config{}
+	}
+
+	if name, ok := c.ROMs[romdb.Hash(rom)]; ok {
+		k, _ := c.Profile(name)
+		return k
+	}
+
+	k, ok := c.Profile(c.Default)
+	if !ok {
+		k = Default()
+	}
+	if db != nil {
+		if entry, ok := db.Lookup(rom); ok && len(entry.Keymap) > 0 {
+			k = k.With(entry.Keymap)
+		}
+	}
+	return k
+}
+
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// UserPath is the per-user config, keymaps.json in the chip8 directory
+// under os.UserConfigDir, next to the ROM database overrides.
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "keymaps.json"), nil
+}
+
+// LoadUser reads the per-user config, returning an empty config if there
+// is none.
+func LoadUser() (*Config, error) {
+	path, err := UserPath()
+	if err != nil {
+		return &Config{}, nil
+	}
+
+	c, err := LoadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return c, err
+}
@@ -0,0 +1,112 @@
+package keymap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+func TestBuiltins(t *testing.T) {
+	k := Default()
+	if len(k) != 16 {
+		t.Errorf("Expected the COSMAC layout to cover all 16 keys, got %d", len(k))
+	}
+	covered := map[uint8]bool{}
+	for _, index := range k {
+		covered[index] = true
+	}
+	if len(covered) != 16 {
+		t.Errorf("Expected every keypad key to have a host key, got %v", covered)
+	}
+
+	arrows, ok := Builtin("arrows")
+	if !ok || arrows["ArrowLeft"] != 4 || arrows["KeyW"] != 5 {
+		t.Errorf("Expected arrows on top of the COSMAC layout, got %v", arrows)
+	}
+
+	k["KeyW"] = 0
+	if Default()["KeyW"] != 5 {
+		t.Errorf("Expected Default to return a copy")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{"w": "KeyW", "Q": "KeyQ", "7": "Digit7", " ": "Space", "space": "Space", "arrowup": "ArrowUp", "Pause": "Pause"}
+	for name, want := range tests {
+		if got := Normalize(name); got != want {
+			t.Errorf("Expected %q to normalize to %q, got %q", name, want, got)
+		}
+	}
+
+	if index, ok := Default().Key("e"); !ok || index != 6 {
+		t.Errorf("Expected e to press 6, got %d (%v)", index, ok)
+	}
+}
+
+const config = `{
+	"default": "arrows",
+	"profiles": {
+		"invaders": {"base": "cosmac", "keys": {"ArrowLeft": 4, "ArrowRight": 6, "space": 5}},
+		"bare": {"keys": {"j": 1}}
+	},
+	"roms": {"` + "B6589FC6AB0DC82CF12099D1C2D40AB994E8410C" + `": "invaders"}
+}`
+
+func TestForROM(t *testing.T) {
+	c, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash in the config is of "0".
+	k := c.ForROM([]byte("0"), nil)
+	if k["ArrowLeft"] != 4 || k["KeyQ"] != 4 || k["Space"] != 5 {
+		t.Errorf("Expected the invaders profile for the ROM, got %v", k)
+	}
+	if _, ok := k["ArrowUp"]; ok {
+		t.Errorf("Expected the profile's cosmac base without arrows, got %v", k)
+	}
+
+	db := romdb.New()
+	if err := db.Add(romdb.Hash([]byte("1")), romdb.Entry{Title: "One", Keymap: map[string]uint8{"w": 2}}); err != nil {
+		t.Fatal(err)
+	}
+	k = c.ForROM([]byte("1"), db)
+	if k["KeyW"] != 2 || k["ArrowUp"] != 2 {
+		t.Errorf("Expected the database keymap over the default profile, got %v", k)
+	}
+
+	if k := c.ForROM([]byte("2"), db); k["KeyW"] != 5 || k["ArrowDown"] != 8 {
+		t.Errorf("Expected the default profile, got %v", k)
+	}
+
+	if k, _ := c.Profile("bare"); len(k) != 1 || k["KeyJ"] != 1 {
+		t.Errorf("Expected a profile without a base to map only its keys, got %v", k)
+	}
+
+	var none *Config
+	if k := none.ForROM([]byte("0"), nil); k["KeyW"] != 5 {
+		t.Errorf("Expected the COSMAC layout without a config, got %v", k)
+	}
+}
+
+func TestParseReportsEveryError(t *testing.T) {
+	_, err := Parse([]byte(`{
+		"default": "missing",
+		"profiles": {
+			"cosmac": {},
+			"bad": {"base": "dvorak", "keys": {"KeyW": 16}}
+		},
+		"roms": {"abc": "bad", "b6589fc6ab0dc82cf12099d1c2d40ab994e8410c": "other"}
+	}`))
+	if err == nil {
+		t.Fatal("Expected the config to be rejected")
+	}
+
+	for _, want := range []string{`default: unknown profile "missing"`, `profile "cosmac"`, `unknown base "dvorak"`, "keypad index 16", `"abc" is not a SHA-1`, `unknown profile "other"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// isIntelHex reports whether data opens with a complete Intel HEX
+// record. Files with a raw ROM extension are never Intel HEX, since a
+// binary may start with 0x3A, the byte for ':'.
+func isIntelHex(name string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ch8", ".c8", ".sc8", ".xo8":
+		return false
+	}
+
+	data = bytes.TrimLeft(data, " \t\r\n")
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	_, err := decodeRecord(strings.TrimSpace(string(line)))
+	return err == nil
+}
+
+// decodeRecord checks the framing, length and checksum of one record and
+// returns its bytes.
+func decodeRecord(text string) ([]byte, error) {
+	if !strings.HasPrefix(text, ":") {
+		return nil, errors.New("record does not start with ':'")
+	}
+
+	raw, err := hex.DecodeString(text[1:])
+	if err != nil || len(raw) < 5 {
+		return nil, fmt.Errorf("malformed record %q", text)
+	}
+
+	length := int(raw[0])
+	if len(raw) != length+5 {
+		return nil, fmt.Errorf("record length %d does not match %d data bytes", length, len(raw)-5)
+	}
+
+	var sum byte
+	for _, b := range raw {
+		sum += b
+	}
+	if sum != 0 {
+		return nil, errors.New("checksum mismatch")
+	}
+	return raw, nil
+}
+
+// parseIntelHex decodes an Intel HEX file into a contiguous image
+// starting at the lowest address any data record names. Gaps between
+// records are zero-filled.
+func parseIntelHex(data []byte) ([]byte, uint16, error) {
+	type record struct {
+		addr int
+		data []byte
+	}
+
+	var records []record
+	base := 0
+	offset := 0
+	sawEOF := false
+
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		lineOffset := offset
+		offset += len(line)
+
+		text := strings.TrimSpace(string(line))
+		if text == "" {
+			continue
+		}
+		if sawEOF {
+			return nil, 0, &LoadError{Offset: lineOffset, Err: errors.New("data after end-of-file record")}
+		}
+		raw, err := decodeRecord(text)
+		if err != nil {
+			return nil, 0, &LoadError{Offset: lineOffset, Err: err}
+		}
+
+		length := int(raw[0])
+		addr := int(raw[1])<<8 | int(raw[2])
+		payload := raw[4 : 4+length]
+
+		switch raw[3] {
+		case 0x00:
+			if base+addr+length > 0x10000 {
+				return nil, 0, &LoadError{Offset: lineOffset, Err: fmt.Errorf("address 0x%X outside the 64K address space", base+addr)}
+			}
+			records = append(records, record{addr: base + addr, data: payload})
+		case 0x01:
+			sawEOF = true
+		case 0x02, 0x04:
+			if length != 2 {
+				return nil, 0, &LoadError{Offset: lineOffset, Err: fmt.Errorf("address record with %d data bytes", length)}
+			}
+			base = int(payload[0])<<8 | int(payload[1])
+			if raw[3] == 0x02 {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case 0x03, 0x05:
+		default:
+			return nil, 0, &LoadError{Offset: lineOffset, Err: fmt.Errorf("unknown record type 0x%02X", raw[3])}
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, 0, &LoadError{Offset: 0, Err: errors.New("no data records")}
+	}
+
+	low, high := records[0].addr, 0
+	for _, r := range records {
+		low = min(low, r.addr)
+		high = max(high, r.addr+len(r.data))
+	}
+
+	image := make([]byte, high-low)
+	for _, r := range records {
+		copy(image[r.addr-low:], r.data)
+	}
+
+	return image, uint16(low), nil
+}
+
+func isHexText(name string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".hex", ".txt":
+		return true
+	case ".ch8", ".c8", ".sc8", ".xo8":
+		return false
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if !isHexDigit(b) && !isSpace(b) && b != 'x' && b != 'X' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHexText decodes whitespace-separated hex tokens. A token may hold
+// any even number of digits, so "00E0" and "00 E0" decode the same, and
+// may carry a 0x prefix.
+func parseHexText(data []byte) ([]byte, error) {
+	var image []byte
+
+	for i := 0; i < len(data); {
+		if isSpace(data[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(data) && !isSpace(data[i]) {
+			i++
+		}
+
+		token := string(data[start:i])
+		digits := strings.TrimPrefix(strings.TrimPrefix(token, "0x"), "0X")
+		decoded, err := hex.DecodeString(digits)
+		if err != nil || digits == "" {
+			return nil, &LoadError{Offset: start, Err: fmt.Errorf("invalid hex token %q", token)}
+		}
+		image = append(image, decoded...)
+	}
+
+	return image, nil
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
@@ -0,0 +1,168 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/octo"
+)
+
+// ROM is a program image ready to be placed in memory. Origin is set
+// only by formats that carry their own load address; Quirks, TickRate
+// and Colors only by formats that carry their own settings. TickRate is
+// in instructions per frame and Colors are "#rrggbb" strings, background
+// first.
+type ROM struct {
+	Name      string
+	Data      []byte
+	Platform  string
+	Origin    uint16
+	HasOrigin bool
+	Quirks    *cpu.Quirks
+	TickRate  int
+	Colors    []string
+}
+
+// LoadError reports a problem at a byte offset within a file.
+type LoadError struct {
+	File   string
+	Offset int
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("%s: offset %d: %v", e.File, e.Offset, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+var platformHints = map[string]string{
+	".ch8": "chip8",
+	".c8":  "chip8",
+	".sc8": "schip",
+	".xo8": "xochip",
+}
+
+func LoadFile(path string) (*ROM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse detects the format of data and decodes it. Zip archives must
+// contain exactly one ROM and Octo cartridge GIFs bring their own quirk,
+// speed and color settings. Intel HEX and hex text dumps are recognised by their
+// content; anything else is taken as a raw binary.
+func Parse(name string, data []byte) (*ROM, error) {
+	rom := &ROM{Name: name, Platform: platformHints[strings.ToLower(filepath.Ext(name))]}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return parseZip(name, data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		cart, err := octo.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		program, err := octo.Assemble(cart.Program)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		quirks := cart.Options.Quirks()
+		rom.Data, rom.Quirks = program, &quirks
+		rom.TickRate, rom.Colors = int(cart.Options.TickRate), cart.Options.Colors()
+	case isIntelHex(name, data):
+		image, origin, err := parseIntelHex(data)
+		if err != nil {
+			return nil, withFile(name, err)
+		}
+		rom.Data, rom.Origin, rom.HasOrigin = image, origin, true
+	case isHexText(name, data):
+		image, err := parseHexText(data)
+		if err != nil {
+			return nil, withFile(name, err)
+		}
+		rom.Data = image
+	default:
+		rom.Data = data
+	}
+
+	return rom, nil
+}
+
+func withFile(name string, err error) error {
+	if le, ok := err.(*LoadError); ok {
+		le.File = name
+		return le
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+func parseZip(name string, data []byte) (*ROM, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &LoadError{File: name, Offset: 0, Err: err}
+	}
+
+	var candidates []*zip.File
+	for _, f := range zr.File {
+		base := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		candidates = append(candidates, f)
+	}
+
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf("%s: expected exactly one ROM in archive, found %d", name, len(candidates))
+	}
+
+	f := candidates[0]
+	offset, _ := f.DataOffset()
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &LoadError{File: name, Offset: int(offset), Err: err}
+	}
+	defer rc.Close()
+
+	inner, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, &LoadError{File: name, Offset: int(offset), Err: err}
+	}
+
+	return Parse(name+"!"+f.Name, inner)
+}
+
+// Load resets c and copies the ROM into memory, at its own origin when
+// it has one and at the program start otherwise.
+func (r *ROM) Load(c *cpu.Cpu) error {
+	if r.Quirks != nil {
+		c.Config.Quirks = *r.Quirks
+	}
+
+	if !r.HasOrigin || r.Origin == c.Config.ProgramStart {
+		if err := c.LoadGame(r.Data); err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		return nil
+	}
+
+	if int(r.Origin)+len(r.Data) > len(c.Memory) {
+		return fmt.Errorf("%s: %d bytes at 0x%03X exceed memory size (%d bytes)", r.Name, len(r.Data), r.Origin, len(c.Memory))
+	}
+
+	c.Reset()
+	copy(c.Memory[r.Origin:], r.Data)
+	return nil
+}
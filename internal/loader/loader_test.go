@@ -0,0 +1,197 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/octo"
+)
+
+func TestParse_raw(t *testing.T) {
+	rom, err := Parse("game.sc8", []byte{0x00, 0xE0, 0x12, 0x00})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if !bytes.Equal(rom.Data, []byte{0x00, 0xE0, 0x12, 0x00}) {
+		t.Errorf("Expected raw data to be unchanged, got %X", rom.Data)
+	}
+
+	if rom.Platform != "schip" {
+		t.Errorf("Expected platform hint schip, got %q", rom.Platform)
+	}
+
+	if rom.HasOrigin {
+		t.Errorf("Expected a raw binary to have no origin")
+	}
+}
+
+func TestParse_hexText(t *testing.T) {
+	rom, err := Parse("game.txt", []byte("00E0 a2 2a\n0x60 0C\t"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []byte{0x00, 0xE0, 0xA2, 0x2A, 0x60, 0x0C}
+	if !bytes.Equal(rom.Data, expected) {
+		t.Errorf("Expected %X, got %X", expected, rom.Data)
+	}
+}
+
+func TestParse_hexTextError(t *testing.T) {
+	_, err := Parse("game.hex", []byte("00E0 A2Z 60"))
+
+	var le *LoadError
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected a LoadError, got %v", err)
+	}
+
+	if le.File != "game.hex" || le.Offset != 5 {
+		t.Errorf("Expected game.hex at offset 5, got %s at %d", le.File, le.Offset)
+	}
+}
+
+func TestParse_intelHex(t *testing.T) {
+	input := ":0402000000E0A22A4E\n:02020400600C8C\n:00000001FF\n"
+
+	rom, err := Parse("game.ihx", []byte(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if !rom.HasOrigin || rom.Origin != 0x200 {
+		t.Errorf("Expected origin 0x200, got 0x%X", rom.Origin)
+	}
+
+	expected := []byte{0x00, 0xE0, 0xA2, 0x2A, 0x60, 0x0C}
+	if !bytes.Equal(rom.Data, expected) {
+		t.Errorf("Expected %X, got %X", expected, rom.Data)
+	}
+}
+
+func TestParse_intelHexChecksum(t *testing.T) {
+	input := ":0402000000E0A22A4E\n:02020400600C8D\n"
+
+	_, err := Parse("game.ihx", []byte(input))
+	if err == nil || !strings.Contains(err.Error(), "game.ihx: offset 20: checksum mismatch") {
+		t.Errorf("Expected a checksum error naming the file and offset, got %v", err)
+	}
+}
+
+func TestParse_colonBinary(t *testing.T) {
+	// 3A12 is SE VA, 0x12, whose first byte is ':'.
+	for _, data := range [][]byte{{0x3A, 0x12, 0x12, 0x00}, {0x0A, 0x3A, 0x12, 0x00}} {
+		for _, name := range []string{"game.ch8", "game.bin"} {
+			rom, err := Parse(name, data)
+			if err != nil {
+				t.Errorf("Expected %s starting %X to load as a raw binary, got %v", name, data[:2], err)
+				continue
+			}
+			if !bytes.Equal(rom.Data, data) || rom.HasOrigin {
+				t.Errorf("Expected %s to be unchanged, got %X", name, rom.Data)
+			}
+		}
+	}
+}
+
+func TestParse_zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("readme/")
+	w, _ := zw.Create("games/pong.xo8")
+	w.Write([]byte{0x12, 0x00})
+	zw.Close()
+
+	rom, err := Parse("pong.zip", buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if !bytes.Equal(rom.Data, []byte{0x12, 0x00}) || rom.Platform != "xochip" {
+		t.Errorf("Expected xochip ROM from the archive, got %X (%q)", rom.Data, rom.Platform)
+	}
+
+	if rom.Name != "pong.zip!games/pong.xo8" {
+		t.Errorf("Expected name to include the archive member, got %q", rom.Name)
+	}
+}
+
+func TestParse_zipMultiple(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("a.ch8")
+	zw.Create("b.ch8")
+	zw.Close()
+
+	if _, err := Parse("two.zip", buf.Bytes()); err == nil {
+		t.Errorf("Expected an archive with two ROMs to be rejected")
+	}
+}
+
+func TestROM_Load(t *testing.T) {
+	c := cpu.NewCpu(4096, 0x200)
+
+	rom := &ROM{Name: "patch.ihx", Data: []byte{0xAB}, Origin: 0x300, HasOrigin: true}
+	if err := rom.Load(c); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if c.Memory[0x300] != 0xAB || c.Pc != 0x200 {
+		t.Errorf("Expected data at 0x300 and PC at 0x200, got 0x%X and 0x%X", c.Memory[0x300], c.Pc)
+	}
+
+	rom.Origin = 0xFFF
+	rom.Data = []byte{1, 2}
+	if err := rom.Load(c); err == nil {
+		t.Errorf("Expected a ROM past the end of memory to be rejected")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.ch8")
+	os.WriteFile(path, []byte("00E0"), 0o644)
+
+	rom, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	if !bytes.Equal(rom.Data, []byte("00E0")) {
+		t.Errorf("Expected a .ch8 file to load as raw bytes, got %X", rom.Data)
+	}
+}
+
+func TestParse_octoCartridge(t *testing.T) {
+	var buf bytes.Buffer
+	cart := &octo.Cartridge{Program: "0x12 0x00", Options: octo.Options{
+		TickRate: 200, BackgroundColor: "#000000", FillColor: "#FFCC00",
+		JumpQuirks: true, ClipQuirks: true, ShiftQuirks: true, LoadStoreQuirks: true,
+	}}
+	if err := octo.Encode(&buf, cart); err != nil {
+		t.Fatal(err)
+	}
+
+	rom, err := Parse("jam.gif", buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	c := cpu.NewCpu(4096, 0x200)
+	if err := rom.Load(c); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !c.Config.Quirks.Jump || c.Memory[0x200] != 0x12 {
+		t.Errorf("Expected the cartridge program and quirks to be applied, got %+v", c.Config.Quirks)
+	}
+
+	if rom.TickRate != 200 || len(rom.Colors) != 2 || rom.Colors[1] != "#FFCC00" {
+		t.Errorf("Expected the cartridge speed and colors, got %d and %v", rom.TickRate, rom.Colors)
+	}
+}
@@ -0,0 +1,363 @@
+// Package netplay runs one machine on two hosts in deterministic
+// lockstep over a stream connection.
+//
+// Both sides send their keypad state for each frame ahead of time, delayed
+// by a fixed number of frames, and a frame only runs once both inputs for
+// it are known; the machine sees the union of the two keypads. Every
+// HashInterval frames each side sends a hash of its state. When the hashes
+// for a frame differ, the host sends its state along with a new random
+// seed and the guest adopts it, replaying any frames it has already run
+// past that point.
+package netplay
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math/rand"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+const protocolVersion = 1
+
+// historyFrames is how many frames of inputs and hashes are kept for
+// replays after a resync.
+const historyFrames = 600
+
+type Config struct {
+	InputDelay           int
+	HashInterval         int
+	InstructionsPerFrame int
+}
+
+var DefaultConfig = Config{
+	InputDelay:           2,
+	HashInterval:         30,
+	InstructionsPerFrame: 10,
+}
+
+func (c Config) validate() error {
+	var errs []error
+	if c.InputDelay < 0 {
+		errs = append(errs, fmt.Errorf("input delay %d is negative", c.InputDelay))
+	}
+	if c.HashInterval < 1 {
+		errs = append(errs, fmt.Errorf("hash interval %d is less than 1", c.HashInterval))
+	}
+	if c.InstructionsPerFrame < 1 {
+		errs = append(errs, fmt.Errorf("instructions per frame %d is less than 1", c.InstructionsPerFrame))
+	}
+	return errors.Join(errs...)
+}
+
+const (
+	msgHello = iota + 1
+	msgInput
+	msgHash
+	msgResync
+)
+
+type hello struct {
+	Version int
+	Config  Config
+	Quirks  cpu.Quirks
+}
+
+// message is the single wire type; which fields are set depends on Kind.
+// Epoch counts resyncs, so hashes computed before one can be told apart.
+type message struct {
+	Kind     uint8
+	Frame    uint32
+	Keys     uint16
+	Sum      uint64
+	Epoch    uint32
+	Seed     int64
+	Hello    *hello
+	Snapshot *cpu.Snapshot
+}
+
+type Session struct {
+	cpu    *cpu.Cpu
+	host   bool
+	config Config
+
+	enc *gob.Encoder
+	dec *gob.Decoder
+
+	frame     uint32
+	nextInput uint32
+	epoch     uint32
+
+	local, remote         map[uint32]uint16
+	localHash, remoteHash map[uint32]uint64
+
+	Resyncs int
+	Desyncs int
+}
+
+func newSession(conn io.ReadWriter, c *cpu.Cpu, host bool) *Session {
+	return &Session{
+		cpu:        c,
+		host:       host,
+		enc:        gob.NewEncoder(conn),
+		dec:        gob.NewDecoder(conn),
+		local:      map[uint32]uint16{},
+		remote:     map[uint32]uint16{},
+		localHash:  map[uint32]uint64{},
+		remoteHash: map[uint32]uint64{},
+	}
+}
+
+// Host starts a session on conn with c as the authoritative machine. The
+// guest starts from c's current state.
+func Host(conn io.ReadWriter, c *cpu.Cpu, config Config) (*Session, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	s := newSession(conn, c, true)
+	s.config = config
+
+	seed := rand.Int63()
+	c.Rand = rand.New(rand.NewSource(seed))
+	snapshot := c.Snapshot()
+
+	err := s.send(message{
+		Kind:     msgHello,
+		Seed:     seed,
+		Hello:    &hello{Version: protocolVersion, Config: config, Quirks: c.Config.Quirks},
+		Snapshot: &snapshot,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Join starts the guest side of a session on conn. c takes on the host's
+// state and quirks, so it only needs memory of the same size.
+func Join(conn io.ReadWriter, c *cpu.Cpu) (*Session, error) {
+	s := newSession(conn, c, false)
+
+	msg, err := s.receive()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Kind != msgHello || msg.Hello == nil || msg.Snapshot == nil {
+		return nil, errors.New("netplay: expected hello from host")
+	}
+	if msg.Hello.Version != protocolVersion {
+		return nil, fmt.Errorf("netplay: host speaks protocol version %d, want %d", msg.Hello.Version, protocolVersion)
+	}
+	if err := msg.Hello.Config.validate(); err != nil {
+		return nil, fmt.Errorf("netplay: host sent an invalid config: %w", err)
+	}
+
+	s.config = msg.Hello.Config
+	c.Config.Quirks = msg.Hello.Quirks
+	if err := c.Restore(*msg.Snapshot); err != nil {
+		return nil, fmt.Errorf("netplay: %w", err)
+	}
+	c.Rand = rand.New(rand.NewSource(msg.Seed))
+
+	return s, nil
+}
+
+func (s *Session) send(msg message) error {
+	if err := s.enc.Encode(msg); err != nil {
+		return fmt.Errorf("netplay: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) receive() (message, error) {
+	var msg message
+	if err := s.dec.Decode(&msg); err != nil {
+		return message{}, fmt.Errorf("netplay: %w", err)
+	}
+	return msg, nil
+}
+
+// FrameNumber is the number of the next frame to run.
+func (s *Session) FrameNumber() uint32 {
+	return s.frame
+}
+
+func (s *Session) Config() Config {
+	return s.config
+}
+
+// Frame submits the local keypad state, as a bit mask with bit n for key
+// n, and runs the next frame once the remote input for it has arrived.
+// The input takes effect InputDelay frames from now.
+func (s *Session) Frame(keys uint16) error {
+	for ; s.nextInput <= s.frame+uint32(s.config.InputDelay); s.nextInput++ {
+		s.local[s.nextInput] = keys
+		if err := s.send(message{Kind: msgInput, Frame: s.nextInput, Keys: keys}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if _, ok := s.remote[s.frame]; ok {
+			break
+		}
+		msg, err := s.receive()
+		if err != nil {
+			return err
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+
+	return s.step(true)
+}
+
+// step runs the current frame from the recorded inputs and, on hash
+// frames, records the hash and optionally sends it.
+func (s *Session) step(sendHash bool) error {
+	f := s.frame
+	setKeys(s.cpu, s.local[f]|s.remote[f])
+	for i := 0; i < s.config.InstructionsPerFrame; i++ {
+		s.cpu.Execute()
+	}
+	s.cpu.TickTimers()
+	s.frame++
+
+	s.forget()
+
+	if (f+1)%uint32(s.config.HashInterval) != 0 {
+		return nil
+	}
+
+	sum := Hash(s.cpu)
+	s.localHash[f] = sum
+	if sendHash {
+		if err := s.send(message{Kind: msgHash, Frame: f, Sum: sum, Epoch: s.epoch}); err != nil {
+			return err
+		}
+	}
+	return s.compare(f)
+}
+
+// forget drops the inputs and hashes of every frame more than
+// historyFrames old. A resync can move the frame number on by more than
+// one, so older entries are swept rather than deleted one by one.
+func (s *Session) forget() {
+	if s.frame < historyFrames {
+		return
+	}
+	old := s.frame - historyFrames
+	for _, m := range []map[uint32]uint16{s.local, s.remote} {
+		maps.DeleteFunc(m, func(f uint32, _ uint16) bool { return f <= old })
+	}
+	for _, m := range []map[uint32]uint64{s.localHash, s.remoteHash} {
+		maps.DeleteFunc(m, func(f uint32, _ uint64) bool { return f <= old })
+	}
+}
+
+func (s *Session) handle(msg message) error {
+	switch msg.Kind {
+	case msgInput:
+		s.remote[msg.Frame] = msg.Keys
+	case msgHash:
+		if msg.Epoch != s.epoch {
+			return nil
+		}
+		s.remoteHash[msg.Frame] = msg.Sum
+		return s.compare(msg.Frame)
+	case msgResync:
+		if s.host || msg.Snapshot == nil {
+			return errors.New("netplay: unexpected resync")
+		}
+		return s.resync(msg)
+	default:
+		return fmt.Errorf("netplay: unexpected message kind %d", msg.Kind)
+	}
+	return nil
+}
+
+// compare checks the hashes for frame f once both are known. Only the
+// host acts on a mismatch; the guest waits for the resync.
+func (s *Session) compare(f uint32) error {
+	local, ok := s.localHash[f]
+	if !ok {
+		return nil
+	}
+	remote, ok := s.remoteHash[f]
+	if !ok {
+		return nil
+	}
+	delete(s.remoteHash, f)
+
+	if local == remote {
+		return nil
+	}
+
+	s.Desyncs++
+	if !s.host {
+		return nil
+	}
+
+	s.epoch++
+	s.Resyncs++
+	seed := rand.Int63()
+	s.cpu.Rand = rand.New(rand.NewSource(seed))
+	snapshot := s.cpu.Snapshot()
+	clear(s.remoteHash)
+
+	return s.send(message{Kind: msgResync, Frame: s.frame, Seed: seed, Epoch: s.epoch, Snapshot: &snapshot})
+}
+
+// resync adopts the host's state at msg.Frame. If the guest has already
+// run past that frame it replays the frames in between from the inputs it
+// has, so both sides stay on the same frame.
+func (s *Session) resync(msg message) error {
+	if err := s.cpu.Restore(*msg.Snapshot); err != nil {
+		return fmt.Errorf("netplay: %w", err)
+	}
+	s.cpu.Rand = rand.New(rand.NewSource(msg.Seed))
+	s.epoch = msg.Epoch
+	s.Resyncs++
+
+	for f := range s.localHash {
+		if f >= msg.Frame {
+			delete(s.localHash, f)
+		}
+	}
+	clear(s.remoteHash)
+
+	target := s.frame
+	s.frame = msg.Frame
+	for s.frame < target {
+		if err := s.step(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setKeys(c *cpu.Cpu, keys uint16) {
+	for i := range c.Keys {
+		c.Keys[i] = keys&(1<<i) != 0
+	}
+}
+
+// Hash summarises the machine state both sides must agree on: memory,
+// registers, stack, timers and the display.
+func Hash(c *cpu.Cpu) uint64 {
+	s := c.Snapshot()
+	h := fnv.New64a()
+	h.Write(s.Memory)
+	h.Write(s.Registers[:])
+	binary.Write(h, binary.BigEndian, s.Stack)
+	binary.Write(h, binary.BigEndian, []uint16{uint16(s.Sp), s.Pc, s.I, uint16(s.Dt), uint16(s.St)})
+	h.Write(s.Display[:])
+	return h.Sum64()
+}
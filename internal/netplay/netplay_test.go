@@ -0,0 +1,193 @@
+package netplay
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+// The program stores random bytes and counts frames in which key 0 is
+// up, so any difference in seeds or inputs shows in memory.
+var program = []uint8{
+	0xC0, 0xFF, // RND V0, #FF
+	0xA3, 0x00, // LD I, #300
+	0xF0, 0x55, // LD [I], V0
+	0xE1, 0x9E, // SKP V1
+	0x72, 0x01, // ADD V2, #01
+	0x82, 0x04, // ADD V2, V0
+	0xA3, 0x01, // LD I, #301
+	0xF2, 0x55, // LD [I], V2
+	0x12, 0x00, // JP #200
+}
+
+func pair(t *testing.T, config Config) (host, guest *Session, hostCpu, guestCpu *cpu.Cpu) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	hostCpu = cpu.NewCpu(4096, 0x200)
+	if err := hostCpu.LoadGame(program); err != nil {
+		t.Fatal(err)
+	}
+	guestCpu = cpu.NewCpu(4096, 0x200)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+
+	guestConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostConn := <-accepted
+	t.Cleanup(func() {
+		hostConn.Close()
+		guestConn.Close()
+	})
+
+	var joinErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		guest, joinErr = Join(guestConn, guestCpu)
+	}()
+
+	host, err = Host(hostConn, hostCpu, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if joinErr != nil {
+		t.Fatal(joinErr)
+	}
+
+	return host, guest, hostCpu, guestCpu
+}
+
+// play runs frames on both sides at once. Each side presses its own key
+// on a different schedule; before is called on the guest's machine ahead
+// of each of its frames.
+func play(t *testing.T, host, guest *Session, frames int, before func(frame int)) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	run := func(i int, s *Session, key uint16, period int, before func(int)) {
+		defer wg.Done()
+		for f := 0; f < frames; f++ {
+			if before != nil {
+				before(f)
+			}
+			var keys uint16
+			if f/period%2 == 1 {
+				keys = key
+			}
+			if err := s.Frame(keys); err != nil {
+				errs[i] = err
+				return
+			}
+		}
+	}
+
+	wg.Add(2)
+	go run(0, host, 1<<0, 7, nil)
+	go run(1, guest, 1<<1, 5, before)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLockstepStaysInSync(t *testing.T) {
+	host, guest, hostCpu, guestCpu := pair(t, Config{InputDelay: 3, HashInterval: 10, InstructionsPerFrame: 10})
+
+	play(t, host, guest, 200, nil)
+
+	if host.FrameNumber() != 200 || guest.FrameNumber() != 200 {
+		t.Fatalf("Expected both sides at frame 200, got %d and %d", host.FrameNumber(), guest.FrameNumber())
+	}
+	if !reflect.DeepEqual(hostCpu.Snapshot(), guestCpu.Snapshot()) {
+		t.Error("Expected host and guest states to match")
+	}
+	if host.Desyncs != 0 || guest.Desyncs != 0 {
+		t.Errorf("Expected no desyncs, got %d and %d", host.Desyncs, guest.Desyncs)
+	}
+	if hostCpu.I < 0x300 {
+		t.Error("Expected the program to have run")
+	}
+}
+
+func TestDesyncIsRepairedFromHost(t *testing.T) {
+	host, guest, hostCpu, guestCpu := pair(t, Config{InputDelay: 2, HashInterval: 10, InstructionsPerFrame: 10})
+
+	play(t, host, guest, 300, func(frame int) {
+		if frame == 25 {
+			guestCpu.Memory[0x400]++
+		}
+	})
+
+	if host.Resyncs == 0 || guest.Resyncs == 0 {
+		t.Fatalf("Expected a resync, got %d on the host and %d on the guest", host.Resyncs, guest.Resyncs)
+	}
+	if !reflect.DeepEqual(hostCpu.Snapshot(), guestCpu.Snapshot()) {
+		t.Error("Expected host and guest states to match after the resync")
+	}
+}
+
+func TestZeroInputDelay(t *testing.T) {
+	host, guest, hostCpu, guestCpu := pair(t, Config{InputDelay: 0, HashInterval: 1, InstructionsPerFrame: 5})
+
+	play(t, host, guest, 50, nil)
+
+	if Hash(hostCpu) != Hash(guestCpu) {
+		t.Error("Expected host and guest hashes to match")
+	}
+}
+
+func TestHostRejectsInvalidConfig(t *testing.T) {
+	_, err := Host(nil, cpu.NewCpu(4096, 0x200), Config{InputDelay: -1})
+	if err == nil {
+		t.Error("Expected an invalid config to be rejected")
+	}
+}
+
+func TestHistoryIsForgottenAfterAJump(t *testing.T) {
+	c := cpu.NewCpu(4096, 0x200)
+	if err := c.LoadGame(program); err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(&bytes.Buffer{}, c, false)
+	s.config = Config{HashInterval: 1000, InstructionsPerFrame: 1}
+
+	for f := uint32(0); f < 100; f++ {
+		s.local[f], s.remote[f] = 1, 1
+		s.localHash[f], s.remoteHash[f] = 1, 1
+	}
+
+	// A resync can move the frame number well past the old history.
+	s.frame = historyFrames + 100
+	if err := s.step(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(s.local) + len(s.remote) + len(s.localHash) + len(s.remoteHash); n != 0 {
+		t.Errorf("Expected the old history to be forgotten, got %d entries", n)
+	}
+}
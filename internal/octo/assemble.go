@@ -0,0 +1,985 @@
+package octo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SourceError reports a problem at a line of Octo source.
+type SourceError struct {
+	Line int
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+const programStart = 0x200
+
+// Assemble compiles Octo source into a program image loaded at 0x200.
+// It covers the language Octo cartridges are written in: labels,
+// :const, :alias, :calc, :macro and :stringmode, structured if, loop
+// and while, the comparison pseudo-ops, and every CHIP-8, SUPER-CHIP
+// and XO-CHIP instruction. Breakpoints, monitors and :include are
+// debugger and file features with no effect on the image; :include is
+// rejected.
+//
+// When anything comes before the main label the image starts with a
+// jump to it. Source without a main label, such as the byte listings
+// Octo's disassembler produces, runs from its first byte.
+func Assemble(source string) (program []byte, err error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{
+		tokens:  tokens,
+		here:    programStart,
+		labels:  map[string]int{},
+		consts:  map[string]float64{},
+		aliases: map[string]int{},
+		macros:  map[string]*macro{},
+		modes:   map[string][]stringMode{},
+	}
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].text == ":" && tokens[i+1].text == "main" {
+			c.mainPending = true
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*SourceError)
+			if !ok {
+				panic(r)
+			}
+			program, err = nil, se
+		}
+	}()
+
+	c.compile()
+	return c.rom, nil
+}
+
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// tokenize splits source at whitespace. Comments run from # to the end
+// of the line, strings are double-quoted with backslash escapes, and
+// braces and parentheses stand alone so expressions need no spaces
+// around them.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+
+	for i := 0; i < len(source); {
+		ch := source[i]
+		switch {
+		case ch == '\n':
+			line++
+			i++
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			i++
+		case ch == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case ch == '"':
+			var text strings.Builder
+			start := line
+			for i++; ; i++ {
+				if i >= len(source) {
+					return nil, &SourceError{Line: start, Err: errors.New("unterminated string")}
+				}
+				ch := source[i]
+				if ch == '"' {
+					i++
+					break
+				}
+				if ch == '\n' {
+					line++
+				}
+				if ch == '\\' && i+1 < len(source) {
+					i++
+					ch = source[i]
+					switch ch {
+					case 'n':
+						ch = '\n'
+					case 'r':
+						ch = '\r'
+					case 't':
+						ch = '\t'
+					case 'v':
+						ch = '\v'
+					case '0':
+						ch = 0
+					}
+				}
+				text.WriteByte(ch)
+			}
+			tokens = append(tokens, token{text: text.String(), line: start, quoted: true})
+		case strings.IndexByte("{}()", ch) >= 0:
+			tokens = append(tokens, token{text: string(ch), line: line})
+			i++
+		default:
+			start := i
+			for i < len(source) && strings.IndexByte(" \t\r\n#\"{}()", source[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, token{text: source[start:i], line: line})
+		}
+	}
+
+	return tokens, nil
+}
+
+type fixupKind int
+
+const (
+	fixAddress fixupKind = iota // the low 12 bits of an instruction
+	fixWord                     // a big-endian 16-bit value
+	fixUnpack                   // the operands of the v0 := and v1 := pair :unpack emits
+)
+
+// fixup records a use of a label before its definition.
+type fixup struct {
+	kind fixupKind
+	at   int
+	max  int
+	name string
+	line int
+}
+
+type macro struct {
+	args  []string
+	body  []token
+	calls int
+}
+
+type stringMode struct {
+	alphabet string
+	body     []token
+	calls    int
+}
+
+type blockKind int
+
+const (
+	loopBlock blockKind = iota
+	branchBlock
+)
+
+// block is an open loop or if ... begin. For a loop, at is its first
+// instruction and breaks the jumps its whiles leave through; for a
+// branch, at is the jump to patch once the else or end is reached.
+type block struct {
+	kind   blockKind
+	at     int
+	breaks []int
+	line   int
+}
+
+// maxTokens bounds macro expansion, which could otherwise recurse
+// forever.
+const maxTokens = 1 << 20
+
+type compiler struct {
+	tokens []token
+	pos    int
+	line   int
+
+	rom     []byte
+	written []bool
+	here    int
+
+	// mainPending is set while main is still to be defined and nothing
+	// has been placed ahead of it; jumpToMain once something has.
+	mainPending bool
+	jumpToMain  bool
+
+	labels  map[string]int
+	consts  map[string]float64
+	aliases map[string]int
+	macros  map[string]*macro
+	modes   map[string][]stringMode
+	fixups  []fixup
+	blocks  []block
+}
+
+func (c *compiler) fail(format string, args ...any) {
+	panic(&SourceError{Line: c.line, Err: fmt.Errorf(format, args...)})
+}
+
+func (c *compiler) compile() {
+	for c.pos < len(c.tokens) {
+		c.statement()
+	}
+
+	if n := len(c.blocks); n > 0 {
+		b := c.blocks[n-1]
+		c.line = b.line
+		if b.kind == loopBlock {
+			c.fail("loop without again")
+		}
+		c.fail("begin without end")
+	}
+
+	if c.jumpToMain {
+		c.patch(programStart, 0x1000, c.labels["main"])
+	}
+
+	for _, f := range c.fixups {
+		c.line = f.line
+		v, ok := c.labels[f.name]
+		if !ok {
+			if k, isConst := c.consts[f.name]; isConst {
+				v, ok = int(math.Floor(k)), true
+			}
+		}
+		if !ok {
+			c.fail("undefined name %q", f.name)
+		}
+		if v < 0 || v > f.max {
+			c.fail("address 0x%X of %s is out of range", v, f.name)
+		}
+
+		i := f.at - programStart
+		switch f.kind {
+		case fixAddress:
+			c.rom[i] |= byte(v >> 8)
+			c.rom[i+1] = byte(v)
+		case fixWord:
+			c.rom[i] = byte(v >> 8)
+			c.rom[i+1] = byte(v)
+		case fixUnpack:
+			c.rom[i+1] |= byte(v >> 8)
+			c.rom[i+3] = byte(v)
+		}
+	}
+}
+
+func (c *compiler) next() token {
+	if c.pos >= len(c.tokens) {
+		c.fail("unexpected end of source")
+	}
+	t := c.tokens[c.pos]
+	c.pos++
+	c.line = t.line
+	return t
+}
+
+func (c *compiler) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.pos].text
+}
+
+func (c *compiler) expect(text string) {
+	if t := c.next(); t.text != text || t.quoted {
+		c.fail("expected %s, got %q", text, t.text)
+	}
+}
+
+// splice inserts tokens to be read next.
+func (c *compiler) splice(tokens []token) {
+	if len(c.tokens)+len(tokens) > maxTokens {
+		c.fail("macro expansion is too large")
+	}
+	rest := append(tokens, c.tokens[c.pos:]...)
+	c.tokens = append(c.tokens[:c.pos], rest...)
+}
+
+// pc returns the address the next byte goes to. Anything placed before
+// main is defined makes room for the jump to it.
+func (c *compiler) pc() int {
+	if c.mainPending {
+		c.mainPending = false
+		c.jumpToMain = true
+		c.inst(0x1000)
+	}
+	return c.here
+}
+
+func (c *compiler) emit(b int) {
+	addr := c.pc()
+	if addr > 0xFFFF {
+		c.fail("program extends past 0xFFFF")
+	}
+
+	i := addr - programStart
+	for len(c.rom) <= i {
+		c.rom = append(c.rom, 0)
+		c.written = append(c.written, false)
+	}
+	if c.written[i] {
+		c.fail("address 0x%X is already in use", addr)
+	}
+	c.rom[i], c.written[i] = byte(b), true
+	c.here++
+}
+
+func (c *compiler) inst(op int) {
+	c.emit(op >> 8)
+	c.emit(op & 0xFF)
+}
+
+// patch sets the instruction at addr to op with a 12-bit address.
+func (c *compiler) patch(at, op, addr int) {
+	if addr > 0xFFF {
+		c.fail("address 0x%X is out of range for a jump", addr)
+	}
+	op |= addr
+	c.rom[at-programStart], c.rom[at-programStart+1] = byte(op>>8), byte(op)
+}
+
+var reserved = map[string]bool{
+	":": true, ":=": true, "+=": true, "-=": true, "=-": true, "|=": true, "&=": true, "^=": true,
+	">>=": true, "<<=": true, "==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+	"key": true, "-key": true, "hex": true, "bighex": true, "long": true, "random": true,
+	"delay": true, "buzzer": true, "pitch": true, "i": true, "if": true, "then": true,
+	"begin": true, "else": true, "end": true, "loop": true, "again": true, "while": true,
+	"return": true, ";": true, "clear": true, "bcd": true, "save": true, "load": true,
+	"saveflags": true, "loadflags": true, "sprite": true, "jump": true, "jump0": true,
+	"native": true, "hires": true, "lores": true, "exit": true, "scroll-down": true,
+	"scroll-up": true, "scroll-left": true, "scroll-right": true, "plane": true, "audio": true,
+	"{": true, "}": true, "(": true, ")": true, "-": true,
+}
+
+func isName(t token) bool {
+	if t.quoted || t.text == "" || reserved[t.text] || strings.HasPrefix(t.text, ":") {
+		return false
+	}
+	_, isNumber := parseNumber(t.text)
+	return !isNumber && !(t.text[0] >= '0' && t.text[0] <= '9')
+}
+
+// name reads a name being defined.
+func (c *compiler) name() string {
+	t := c.next()
+	if !isName(t) {
+		c.fail("%q cannot be used as a name", t.text)
+	}
+	if _, ok := c.registerOf(t); ok {
+		c.fail("%q is a register", t.text)
+	}
+	return t.text
+}
+
+func (c *compiler) defined(name string) bool {
+	_, label := c.labels[name]
+	_, constant := c.consts[name]
+	_, m := c.macros[name]
+	_, s := c.modes[name]
+	return label || constant || m || s
+}
+
+func (c *compiler) defineLabel(name string, addr int) {
+	if c.defined(name) {
+		c.fail("%q is already defined", name)
+	}
+	c.labels[name] = addr
+}
+
+func (c *compiler) defineConst(name string, v float64) {
+	if c.defined(name) {
+		c.fail("%q is already defined", name)
+	}
+	c.consts[name] = v
+}
+
+func (c *compiler) registerOf(t token) (int, bool) {
+	if t.quoted {
+		return 0, false
+	}
+	if r, ok := c.aliases[t.text]; ok {
+		return r, true
+	}
+	if len(t.text) == 2 && (t.text[0] == 'v' || t.text[0] == 'V') {
+		if r, err := strconv.ParseUint(t.text[1:], 16, 4); err == nil {
+			return int(r), true
+		}
+	}
+	return 0, false
+}
+
+func (c *compiler) register() int {
+	t := c.next()
+	r, ok := c.registerOf(t)
+	if !ok {
+		c.fail("expected a register, got %q", t.text)
+	}
+	return r
+}
+
+// value resolves a number or a defined name. It reports false for a name
+// not defined yet, which only an address may use.
+func (c *compiler) value(t token) (int, bool) {
+	if _, ok := c.registerOf(t); ok {
+		c.fail("expected a value, got register %s", t.text)
+	}
+	if n, ok := parseNumber(t.text); ok && !t.quoted {
+		return n, true
+	}
+	if v, ok := c.consts[t.text]; ok {
+		return int(math.Floor(v)), true
+	}
+	if v, ok := c.labels[t.text]; ok {
+		return v, true
+	}
+	if !isName(t) {
+		c.fail("expected a value, got %q", t.text)
+	}
+	return 0, false
+}
+
+func (c *compiler) definedValue(t token) int {
+	v, ok := c.value(t)
+	if !ok {
+		c.fail("undefined name %q", t.text)
+	}
+	return v
+}
+
+func (c *compiler) byteOf(t token) int {
+	v := c.definedValue(t)
+	if v < -128 || v > 255 {
+		c.fail("%d does not fit in a byte", v)
+	}
+	return v & 0xFF
+}
+
+func (c *compiler) nibble() int {
+	v := c.definedValue(c.next())
+	if v < 0 || v > 15 {
+		c.fail("%d does not fit in a nibble", v)
+	}
+	return v
+}
+
+// reference emits op with an address operand no wider than max. A name
+// not yet defined is patched at the end.
+func (c *compiler) reference(kind fixupKind, op, max int) {
+	t := c.next()
+	at := c.pc()
+	v, ok := c.value(t)
+	if !ok {
+		c.fixups = append(c.fixups, fixup{kind: kind, at: at, max: max, name: t.text, line: t.line})
+		v = 0
+	}
+	if v < 0 || v > max {
+		c.fail("address 0x%X is out of range", v)
+	}
+
+	switch kind {
+	case fixAddress:
+		c.inst(op | v)
+	case fixWord:
+		c.inst(v)
+	case fixUnpack:
+		c.inst(0x6000 | op<<4 | v>>8)
+		c.inst(0x6100 | v&0xFF)
+	}
+}
+
+func (c *compiler) statement() {
+	t := c.next()
+	if t.quoted {
+		c.fail("unexpected string %q", t.text)
+	}
+
+	switch t.text {
+	case ":":
+		name := c.name()
+		if name == "main" && c.mainPending {
+			c.mainPending = false
+		}
+		c.defineLabel(name, c.pc())
+	case ":alias":
+		name := c.name()
+		c.aliases[name] = c.register()
+	case ":const":
+		name := c.name()
+		c.defineConst(name, float64(c.definedValue(c.next())))
+	case ":calc":
+		name := c.name()
+		c.defineConst(name, c.calc())
+	case ":byte":
+		if c.peek() == "{" {
+			v := int(math.Floor(c.calc()))
+			if v < -128 || v > 255 {
+				c.fail("%d does not fit in a byte", v)
+			}
+			c.emit(v & 0xFF)
+		} else {
+			c.emit(c.byteOf(c.next()))
+		}
+	case ":pointer":
+		c.reference(fixWord, 0, 0xFFFF)
+	case ":call":
+		c.reference(fixAddress, 0x2000, 0xFFF)
+	case ":org":
+		addr := c.definedValue(c.next())
+		if addr < programStart || addr > 0xFFFF {
+			c.fail("cannot place code at 0x%X", addr)
+		}
+		c.pc()
+		c.here = addr
+	case ":next":
+		name := c.name()
+		c.defineLabel(name, c.pc()+1)
+	case ":unpack":
+		if c.peek() == "long" {
+			c.next()
+			c.reference(fixUnpack, 0, 0xFFFF)
+		} else {
+			c.reference(fixUnpack, c.nibble(), 0xFFF)
+		}
+	case ":breakpoint", ":proto":
+		c.next()
+	case ":monitor":
+		c.next()
+		c.next()
+	case ":assert":
+		message := "assertion failed"
+		if c.pos < len(c.tokens) && c.tokens[c.pos].quoted {
+			message = "assertion failed: " + c.next().text
+		}
+		if c.calc() == 0 {
+			c.fail("%s", message)
+		}
+	case ":macro":
+		name := c.name()
+		var args []string
+		for c.peek() != "{" {
+			args = append(args, c.name())
+		}
+		if c.defined(name) {
+			c.fail("%q is already defined", name)
+		}
+		c.macros[name] = &macro{args: args, body: c.body()}
+	case ":stringmode":
+		name := c.name()
+		alphabet := c.next()
+		if !alphabet.quoted {
+			c.fail("expected a string of characters, got %q", alphabet.text)
+		}
+		if _, ok := c.modes[name]; !ok && c.defined(name) {
+			c.fail("%q is already defined", name)
+		}
+		c.modes[name] = append(c.modes[name], stringMode{alphabet: alphabet.text, body: c.body()})
+	case ":include":
+		c.fail(":include is not supported")
+
+	case "return", ";":
+		c.inst(0x00EE)
+	case "clear":
+		c.inst(0x00E0)
+	case "hires":
+		c.inst(0x00FF)
+	case "lores":
+		c.inst(0x00FE)
+	case "exit":
+		c.inst(0x00FD)
+	case "scroll-left":
+		c.inst(0x00FC)
+	case "scroll-right":
+		c.inst(0x00FB)
+	case "scroll-down":
+		c.inst(0x00C0 | c.nibble())
+	case "scroll-up":
+		c.inst(0x00D0 | c.nibble())
+	case "bcd":
+		c.inst(0xF033 | c.register()<<8)
+	case "save", "load":
+		x := c.register()
+		if c.peek() == "-" {
+			c.next()
+			op := 0x5002
+			if t.text == "load" {
+				op = 0x5003
+			}
+			c.inst(op | x<<8 | c.register()<<4)
+		} else if t.text == "save" {
+			c.inst(0xF055 | x<<8)
+		} else {
+			c.inst(0xF065 | x<<8)
+		}
+	case "saveflags":
+		c.inst(0xF075 | c.register()<<8)
+	case "loadflags":
+		c.inst(0xF085 | c.register()<<8)
+	case "sprite":
+		x := c.register()
+		y := c.register()
+		c.inst(0xD000 | x<<8 | y<<4 | c.nibble())
+	case "jump":
+		c.reference(fixAddress, 0x1000, 0xFFF)
+	case "jump0":
+		c.reference(fixAddress, 0xB000, 0xFFF)
+	case "native":
+		c.reference(fixAddress, 0x0000, 0xFFF)
+	case "plane":
+		c.inst(0xF001 | c.nibble()<<8)
+	case "audio":
+		c.inst(0xF002)
+	case "delay":
+		c.expect(":=")
+		c.inst(0xF015 | c.register()<<8)
+	case "buzzer":
+		c.expect(":=")
+		c.inst(0xF018 | c.register()<<8)
+	case "pitch":
+		c.expect(":=")
+		c.inst(0xF03A | c.register()<<8)
+	case "i":
+		c.index()
+
+	case "loop":
+		c.blocks = append(c.blocks, block{kind: loopBlock, at: c.pc(), line: t.line})
+	case "while":
+		n := len(c.blocks) - 1
+		for n >= 0 && c.blocks[n].kind != loopBlock {
+			n--
+		}
+		if n < 0 {
+			c.fail("while outside a loop")
+		}
+		c.condition()(true)
+		c.blocks[n].breaks = append(c.blocks[n].breaks, c.pc())
+		c.inst(0x1000)
+	case "again":
+		b := c.pop(loopBlock, "again without loop")
+		at := c.pc()
+		c.inst(0x1000)
+		c.patch(at, 0x1000, b.at)
+		for _, at := range b.breaks {
+			c.patch(at, 0x1000, c.pc())
+		}
+	case "if":
+		emit := c.condition()
+		switch c.next().text {
+		case "then":
+			emit(false)
+		case "begin":
+			emit(true)
+			c.blocks = append(c.blocks, block{kind: branchBlock, at: c.pc(), line: t.line})
+			c.inst(0x1000)
+		default:
+			c.fail("expected then or begin")
+		}
+	case "else":
+		b := c.pop(branchBlock, "else without begin")
+		at := c.pc()
+		c.inst(0x1000)
+		c.patch(b.at, 0x1000, c.pc())
+		c.blocks = append(c.blocks, block{kind: branchBlock, at: at, line: t.line})
+	case "end":
+		b := c.pop(branchBlock, "end without begin")
+		c.patch(b.at, 0x1000, c.pc())
+
+	default:
+		if x, ok := c.registerOf(t); ok {
+			c.assign(x)
+			return
+		}
+		if m, ok := c.macros[t.text]; ok {
+			c.expandMacro(m)
+			return
+		}
+		if modes, ok := c.modes[t.text]; ok {
+			c.expandString(modes)
+			return
+		}
+		if n, ok := parseNumber(t.text); ok {
+			if n < -128 || n > 255 {
+				c.fail("%d does not fit in a byte", n)
+			}
+			c.emit(n & 0xFF)
+			return
+		}
+		if !isName(t) {
+			c.fail("unexpected %q", t.text)
+		}
+		c.pos--
+		c.reference(fixAddress, 0x2000, 0xFFF)
+	}
+}
+
+func (c *compiler) pop(kind blockKind, message string) block {
+	n := len(c.blocks) - 1
+	if n < 0 || c.blocks[n].kind != kind {
+		c.fail("%s", message)
+	}
+	b := c.blocks[n]
+	c.blocks = c.blocks[:n]
+	return b
+}
+
+// body reads the tokens of a brace-delimited macro body.
+func (c *compiler) body() []token {
+	c.expect("{")
+	var body []token
+	depth := 1
+	for {
+		t := c.next()
+		if !t.quoted {
+			switch t.text {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+		}
+		if depth == 0 {
+			return body
+		}
+		body = append(body, t)
+	}
+}
+
+func (c *compiler) expandMacro(m *macro) {
+	line := c.line
+	args := map[string]token{}
+	for _, name := range m.args {
+		args[name] = c.next()
+	}
+
+	expansion := make([]token, 0, len(m.body))
+	for _, t := range m.body {
+		if a, ok := args[t.text]; ok && !t.quoted {
+			t = a
+		} else if t.text == "CALLS" && !t.quoted {
+			t.text = strconv.Itoa(m.calls)
+		}
+		t.line = line
+		expansion = append(expansion, t)
+	}
+	m.calls++
+	c.splice(expansion)
+}
+
+// expandString expands the string mode body once per character of the
+// string that follows, with VALUE the character's position in the
+// alphabet, CHAR its code and INDEX its position in the string.
+func (c *compiler) expandString(modes []stringMode) {
+	text := c.next()
+	if !text.quoted {
+		c.fail("expected a string, got %q", text.text)
+	}
+
+	var expansion []token
+	for index := 0; index < len(text.text); index++ {
+		ch := text.text[index]
+		found := false
+		for i := range modes {
+			m := &modes[i]
+			value := strings.IndexByte(m.alphabet, ch)
+			if value < 0 {
+				continue
+			}
+			values := map[string]int{"VALUE": value, "CHAR": int(ch), "INDEX": index, "CALLS": m.calls}
+			for _, t := range m.body {
+				if v, ok := values[t.text]; ok && !t.quoted {
+					t.text = strconv.Itoa(v)
+				}
+				t.line = text.line
+				expansion = append(expansion, t)
+			}
+			m.calls++
+			found = true
+			break
+		}
+		if !found {
+			c.fail("string mode has no character %q", ch)
+		}
+	}
+	c.splice(expansion)
+}
+
+func (c *compiler) index() {
+	switch op := c.next().text; op {
+	case ":=":
+		switch c.peek() {
+		case "hex":
+			c.next()
+			c.inst(0xF029 | c.register()<<8)
+		case "bighex":
+			c.next()
+			c.inst(0xF030 | c.register()<<8)
+		case "long":
+			c.next()
+			c.inst(0xF000)
+			c.reference(fixWord, 0, 0xFFFF)
+		default:
+			c.reference(fixAddress, 0xA000, 0xFFF)
+		}
+	case "+=":
+		c.inst(0xF01E | c.register()<<8)
+	default:
+		c.fail("unknown operator %q for i", op)
+	}
+}
+
+var registerOps = map[string]int{
+	":=":  0x0,
+	"|=":  0x1,
+	"&=":  0x2,
+	"^=":  0x3,
+	"+=":  0x4,
+	"-=":  0x5,
+	">>=": 0x6,
+	"=-":  0x7,
+	"<<=": 0xE,
+}
+
+func (c *compiler) assign(x int) {
+	op := c.next().text
+	code, ok := registerOps[op]
+	if !ok {
+		c.fail("unknown operator %q", op)
+	}
+
+	t := c.next()
+	if y, ok := c.registerOf(t); ok {
+		c.inst(0x8000 | x<<8 | y<<4 | code)
+		return
+	}
+
+	switch {
+	case op == ":=" && t.text == "random":
+		c.inst(0xC000 | x<<8 | c.byteOf(c.next()))
+	case op == ":=" && t.text == "key":
+		c.inst(0xF00A | x<<8)
+	case op == ":=" && t.text == "delay":
+		c.inst(0xF007 | x<<8)
+	case op == ":=":
+		c.inst(0x6000 | x<<8 | c.byteOf(t))
+	case op == "+=":
+		c.inst(0x7000 | x<<8 | c.byteOf(t))
+	case op == "-=":
+		c.inst(0x7000 | x<<8 | -c.byteOf(t)&0xFF)
+	default:
+		c.fail("%s needs a register, got %q", op, t.text)
+	}
+}
+
+var negations = map[string]string{
+	"==": "!=", "!=": "==",
+	"<": ">=", ">=": "<",
+	">": "<=", "<=": ">",
+	"key": "-key", "-key": "key",
+}
+
+// condition reads a condition and returns the function that emits it.
+// The emitted code ends with a skip over the next instruction when the
+// condition, or its negation if negate is set, does not hold. The
+// ordering comparisons work on a copy in the compare-temp register, VF
+// unless aliased, and leave VF changed.
+func (c *compiler) condition() func(negate bool) {
+	x := c.register()
+	op := c.next().text
+	if _, ok := negations[op]; !ok {
+		c.fail("unknown comparison %q", op)
+	}
+
+	var operand token
+	if op != "key" && op != "-key" {
+		operand = c.next()
+	}
+	y, isRegister := c.registerOf(operand)
+	var n int
+	if op != "key" && op != "-key" && !isRegister {
+		n = c.byteOf(operand)
+	}
+
+	temp := 0xF
+	if r, ok := c.aliases["compare-temp"]; ok {
+		temp = r
+	}
+	copyOperand := func() {
+		if isRegister {
+			c.inst(0x8000 | temp<<8 | y<<4)
+		} else {
+			c.inst(0x6000 | temp<<8 | n)
+		}
+	}
+
+	return func(negate bool) {
+		op := op
+		if negate {
+			op = negations[op]
+		}
+
+		switch op {
+		case "==":
+			if isRegister {
+				c.inst(0x9000 | x<<8 | y<<4)
+			} else {
+				c.inst(0x4000 | x<<8 | n)
+			}
+		case "!=":
+			if isRegister {
+				c.inst(0x5000 | x<<8 | y<<4)
+			} else {
+				c.inst(0x3000 | x<<8 | n)
+			}
+		case "key":
+			c.inst(0xE0A1 | x<<8)
+		case "-key":
+			c.inst(0xE09E | x<<8)
+		case ">", "<=":
+			// temp = operand - vx, leaving VF clear when vx is larger.
+			copyOperand()
+			c.inst(0x8005 | temp<<8 | x<<4)
+			if op == ">" {
+				c.inst(0x3F01)
+			} else {
+				c.inst(0x3F00)
+			}
+		case "<", ">=":
+			// temp = vx - operand, leaving VF clear when vx is smaller.
+			copyOperand()
+			c.inst(0x8007 | temp<<8 | x<<4)
+			if op == "<" {
+				c.inst(0x3F01)
+			} else {
+				c.inst(0x3F00)
+			}
+		}
+	}
+}
+
+// parseNumber reads a decimal, 0x hexadecimal or 0b binary integer with
+// an optional minus sign.
+func parseNumber(s string) (int, bool) {
+	digits := strings.TrimPrefix(s, "-")
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
+		digits, base = digits[2:], 16
+	case strings.HasPrefix(digits, "0b") || strings.HasPrefix(digits, "0B"):
+		digits, base = digits[2:], 2
+	}
+
+	v, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		return 0, false
+	}
+	if strings.HasPrefix(s, "-") {
+		v = -v
+	}
+	return int(v), true
+}
@@ -0,0 +1,127 @@
+package octo
+
+import (
+	"math"
+	"strconv"
+)
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var binaryOps = map[string]func(a, b float64) float64{
+	"+":   func(a, b float64) float64 { return a + b },
+	"-":   func(a, b float64) float64 { return a - b },
+	"*":   func(a, b float64) float64 { return a * b },
+	"/":   func(a, b float64) float64 { return a / b },
+	"%":   math.Mod,
+	"&":   func(a, b float64) float64 { return float64(int64(a) & int64(b)) },
+	"|":   func(a, b float64) float64 { return float64(int64(a) | int64(b)) },
+	"^":   func(a, b float64) float64 { return float64(int64(a) ^ int64(b)) },
+	"<<":  func(a, b float64) float64 { return float64(int64(a) << uint64(b)) },
+	">>":  func(a, b float64) float64 { return float64(int64(a) >> uint64(b)) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"<":   func(a, b float64) float64 { return truth(a < b) },
+	"<=":  func(a, b float64) float64 { return truth(a <= b) },
+	"==":  func(a, b float64) float64 { return truth(a == b) },
+	"!=":  func(a, b float64) float64 { return truth(a != b) },
+	">=":  func(a, b float64) float64 { return truth(a >= b) },
+	">":   func(a, b float64) float64 { return truth(a > b) },
+}
+
+var unaryOps = map[string]func(float64) float64{
+	"-":     func(a float64) float64 { return -a },
+	"~":     func(a float64) float64 { return float64(^int64(a)) },
+	"!":     func(a float64) float64 { return truth(a == 0) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+	"sign": func(a float64) float64 {
+		switch {
+		case a > 0:
+			return 1
+		case a < 0:
+			return -1
+		}
+		return 0
+	},
+}
+
+// calc evaluates a braced :calc expression. As in Octo, operators have
+// no precedence and evaluate right to left, so { 2 * 3 + 1 } is 8.
+func (c *compiler) calc() float64 {
+	c.expect("{")
+	v := c.expression()
+	c.expect("}")
+	return v
+}
+
+func (c *compiler) expression() float64 {
+	left := c.term()
+	if op, ok := binaryOps[c.peek()]; ok {
+		c.next()
+		return op(left, c.expression())
+	}
+	return left
+}
+
+func (c *compiler) term() float64 {
+	t := c.next()
+	if t.quoted {
+		c.fail("unexpected string %q in expression", t.text)
+	}
+
+	switch t.text {
+	case "(":
+		v := c.expression()
+		c.expect(")")
+		return v
+	case "HERE":
+		return float64(c.pc())
+	case "PI":
+		return math.Pi
+	case "E":
+		return math.E
+	case "strlen":
+		s := c.next()
+		if !s.quoted {
+			c.fail("strlen needs a string, got %q", s.text)
+		}
+		return float64(len(s.text))
+	case "@":
+		addr := int(c.term()) - programStart
+		if addr < 0 || addr >= len(c.rom) {
+			return 0
+		}
+		return float64(c.rom[addr])
+	}
+
+	if op, ok := unaryOps[t.text]; ok {
+		return op(c.term())
+	}
+	if n, ok := parseNumber(t.text); ok {
+		return float64(n)
+	}
+	if v, err := strconv.ParseFloat(t.text, 64); err == nil {
+		return v
+	}
+	if v, ok := c.consts[t.text]; ok {
+		return v
+	}
+	if v, ok := c.labels[t.text]; ok {
+		return float64(v)
+	}
+	c.fail("undefined name %q in expression", t.text)
+	return 0
+}
@@ -0,0 +1,119 @@
+package octo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"os"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+// Cartridge is the payload of an Octo cartridge GIF: the program source
+// and the options it was saved with.
+type Cartridge struct {
+	Program string  `json:"program"`
+	Options Options `json:"options"`
+}
+
+// Decode extracts the payload of an Octo cartridge. Octo hides it in the
+// low two bits of every pixel's palette index, four pixels per byte,
+// most significant bits first, continuing across frames. The first four
+// bytes give the big-endian length of the JSON payload that follows.
+func Decode(r io.Reader) (*Cartridge, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var acc byte
+	bits := 0
+	for _, frame := range g.Image {
+		b := frame.Rect
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				acc = acc<<2 | frame.ColorIndexAt(x, y)&3
+				bits += 2
+				if bits == 8 {
+					data = append(data, acc)
+					acc, bits = 0, 0
+				}
+			}
+		}
+	}
+
+	if len(data) < 4 {
+		return nil, errors.New("cartridge image too small to hold a payload")
+	}
+
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size > len(data)-4 {
+		return nil, fmt.Errorf("cartridge payload of %d bytes exceeds the %d bytes the image holds", size, len(data)-4)
+	}
+
+	var cart Cartridge
+	if err := json.Unmarshal(data[4:4+size], &cart); err != nil {
+		return nil, fmt.Errorf("cartridge payload: %w", err)
+	}
+
+	return &cart, nil
+}
+
+func DecodeFile(path string) (*Cartridge, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cart, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cart, nil
+}
+
+// Encode writes cart as a single-frame cartridge GIF without label art.
+func Encode(w io.Writer, cart *Cartridge) error {
+	payload, err := json.Marshal(cart)
+	if err != nil {
+		return err
+	}
+
+	data := append([]byte{
+		byte(len(payload) >> 24), byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)),
+	}, payload...)
+
+	const width = 128
+	height := (len(data)*4 + width - 1) / width
+
+	palette := color.Palette{
+		color.Gray{0x00}, color.Gray{0x10}, color.Gray{0x20}, color.Gray{0x30},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for i, b := range data {
+		for j := 0; j < 4; j++ {
+			img.Pix[i*4+j] = (b >> (6 - 2*j)) & 3
+		}
+	}
+
+	return gif.EncodeAll(w, &gif.GIF{Image: []*image.Paletted{img}, Delay: []int{0}})
+}
+
+// Configure applies the cartridge quirks to c and loads its program. The
+// tick rate and colors are frontend settings a Cpu has no place for;
+// loader.Parse carries them on the ROM for config.FromROM.
+func (cart *Cartridge) Configure(c *cpu.Cpu) error {
+	program, err := Assemble(cart.Program)
+	if err != nil {
+		return err
+	}
+
+	c.Config.Quirks = cart.Options.Quirks()
+	return c.LoadGame(program)
+}
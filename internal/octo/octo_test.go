@@ -0,0 +1,280 @@
+package octo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	cart := &Cartridge{
+		Program: ": main\n0x00 0xE0 # clear\n0x12 0x02\n",
+		Options: Options{
+			TickRate:        20,
+			FillColor:       "#FFCC00",
+			BackgroundColor: "#996600",
+			ShiftQuirks:     true,
+			LoadStoreQuirks: true,
+			ClipQuirks:      true,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, cart); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if got.Program != cart.Program || got.Options != cart.Options {
+		t.Errorf("Expected %+v, got %+v", cart, got)
+	}
+}
+
+func TestDecode_acrossFrames(t *testing.T) {
+	payload := []byte(`{"program":"0x12 0x00","options":{"tickrate":7}}`)
+	data := append([]byte{0, 0, 0, byte(len(payload))}, payload...)
+
+	palette := color.Palette{color.Black, color.White, color.Gray{0x40}, color.Gray{0x80}, color.Gray{0xC0}}
+	var frames []*image.Paletted
+	for start := 0; start < len(data); start += 8 {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 4), palette)
+		for i := 0; i < 32 && start+i/4 < len(data); i++ {
+			b := data[start+i/4]
+			// Label art lives in the upper bits of the index.
+			frame.Pix[i] = 4 | (b>>(6-2*(i%4)))&3
+		}
+		frames = append(frames, frame)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: frames, Delay: make([]int, len(frames))}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if got.Options.TickRate != 7 || got.Program != "0x12 0x00" {
+		t.Errorf("Unexpected cartridge %+v", got)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	program, err := Assemble(": main\n  0x60 12 # LD V0, 12\n0b11110000 -1\n")
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+
+	expected := []byte{0x60, 12, 0xF0, 0xFF}
+	if !bytes.Equal(program, expected) {
+		t.Errorf("Expected %X, got %X", expected, program)
+	}
+}
+
+func TestAssemble_instructions(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"clear return ;", "00E0 00EE 00EE"},
+		{"v3 := 0x12 v3 := v4 v3 += 1 v3 -= 1 v3 += v4 v3 -= v4 v3 =- v4", "6312 8340 7301 73FF 8344 8345 8347"},
+		{"v3 |= v4 v3 &= v4 v3 ^= v4 v3 >>= v4 v3 <<= v4", "8341 8342 8343 8346 834E"},
+		{"v3 := random 0xF0 v3 := key v3 := delay delay := v3 buzzer := v3", "C3F0 F30A F307 F315 F318"},
+		{"i := 0x300 i += v3 i := hex v3 i := bighex v3 i := long 0x1234", "A300 F31E F329 F330 F000 1234"},
+		{"bcd v3 save v3 load v3 save v1 - v3 load v1 - v3", "F333 F355 F365 5132 5133"},
+		{"sprite v1 v2 5 jump 0x300 jump0 0x300 :call 0x300", "D125 1300 B300 2300"},
+		{"hires lores scroll-down 4 scroll-up 2 scroll-left scroll-right exit", "00FF 00FE 00C4 00D2 00FC 00FB 00FD"},
+		{"plane 3 audio pitch := v3 saveflags v3 loadflags v3", "F301 F002 F33A F375 F385"},
+		{"if v1 == 5 then v2 := 1", "4105 6201"},
+		{"if v1 != v2 then clear", "5120 00E0"},
+		{"if v1 key then clear if v1 -key then clear", "E1A1 00E0 E19E 00E0"},
+		{"if v1 > 5 then clear", "6F05 8F15 3F01 00E0"},
+		{"if v1 <= v2 then clear", "8F20 8F15 3F00 00E0"},
+		{"if v1 < 5 then clear", "6F05 8F17 3F01 00E0"},
+		{":alias compare-temp vE if v1 >= v2 then clear", "8E20 8E17 3F00 00E0"},
+	}
+
+	for _, tt := range tests {
+		program, err := Assemble(tt.source)
+		if err != nil {
+			t.Errorf("%q: %v", tt.source, err)
+			continue
+		}
+		if got := fmt.Sprintf("% X", program); got != spaced(tt.expected) {
+			t.Errorf("%q: expected %s, got %s", tt.source, spaced(tt.expected), got)
+		}
+	}
+}
+
+// spaced turns "00E0 00EE" into the "00 E0 00 EE" that % X prints.
+func spaced(words string) string {
+	var out []string
+	for _, w := range strings.Fields(words) {
+		for i := 0; i < len(w); i += 2 {
+			out = append(out, w[i:i+2])
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestAssemble_layout(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"loop", ": main loop v0 += 1 while v0 != 10 again", "7001 400A 1208 1200"},
+		{"else", ": main if v0 == 1 begin v1 := 1 else v1 := 2 end", "3001 1208 6101 120A 6102"},
+		{"jump to main", ": data 0xFF 0x81 : main i := data sprite v0 v0 2 jump main", "1204 FF81 A202 D002 1204"},
+		{"forward call", ": main draw loop again : draw return", "2204 1202 00EE"},
+		{"macro", ":macro count { :byte CALLS } : main count count", "0001"},
+		{"string mode", `:stringmode text "ABC" { :byte { VALUE + 1 } } : main text "CAB"`, "030102"},
+		{"calc", ":const SPEED 3 :calc SLOW { SPEED * 2 + 1 } : main v0 := SLOW :byte { SLOW - 1 }", "6009 08"},
+		{"next", ": main :next slot v2 := 0 i := slot", "6200 A201"},
+	}
+
+	for _, tt := range tests {
+		program, err := Assemble(tt.source)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := fmt.Sprintf("% X", program); got != spaced(tt.expected) {
+			t.Errorf("%s: expected %s, got %s", tt.name, spaced(tt.expected), got)
+		}
+	}
+}
+
+func TestAssemble_org(t *testing.T) {
+	source := `
+:alias px v5
+:macro bump reg amount { reg += amount }
+: main
+	bump px 3
+	:unpack 0xA target
+	:org 0x300
+: target
+	:byte { @ 0x200 }
+`
+	program, err := Assemble(source)
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+
+	if len(program) != 0x101 {
+		t.Fatalf("Expected the image to reach 0x300, got %d bytes", len(program))
+	}
+	if got := fmt.Sprintf("% X", program[:6]); got != "75 03 60 A3 61 00" {
+		t.Errorf("Expected the macro and the unpacked target, got %s", got)
+	}
+	if program[0x100] != 0x75 {
+		t.Errorf("Expected @ to read back the first byte, got %02X", program[0x100])
+	}
+}
+
+func TestAssemble_errors(t *testing.T) {
+	tests := []struct {
+		source string
+		line   int
+		text   string
+	}{
+		{": main\n  jump nowhere", 2, `undefined name "nowhere"`},
+		{"loop\nv0 += 1", 1, "loop without again"},
+		{"v0 := 300", 1, "does not fit in a byte"},
+		{": main\n: main", 2, "already defined"},
+		{"\n\nend", 3, "end without begin"},
+		{`:include "lib.8o"`, 1, "not supported"},
+		{"v0 := 1 :org 0x200 v0 := 2", 1, "already in use"},
+		{`:assert "too big" { 1 > 2 }`, 1, "too big"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.source)
+
+		var se *SourceError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: expected a SourceError, got %v", tt.source, err)
+			continue
+		}
+		if se.Line != tt.line || !strings.Contains(se.Error(), tt.text) {
+			t.Errorf("%q: expected %q on line %d, got %v", tt.source, tt.text, tt.line, err)
+		}
+	}
+}
+
+func TestAssemble_run(t *testing.T) {
+	source, err := os.ReadFile("testdata/sum.8o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Assemble(string(source))
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+
+	c := cpu.NewCpu(4096, 0x200)
+	if err := c.LoadGame(program); err != nil {
+		t.Fatal(err)
+	}
+	for range 1000 {
+		c.Execute()
+	}
+
+	if c.Registers[5] != 55 || c.Registers[0xA] != 1 {
+		t.Errorf("Expected a sum of 55 and the greater-than branch, got V5=%d VA=%d", c.Registers[5], c.Registers[0xA])
+	}
+
+	var lit int
+	for _, p := range c.Display {
+		if p != 0 {
+			lit++
+		}
+	}
+	if lit != 28 {
+		t.Errorf("Expected two 5s of 14 pixels on screen, got %d lit pixels", lit)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	cart := &Cartridge{
+		Program: ": main\n\tv1 >>= v2\n",
+		Options: Options{ShiftQuirks: false, LoadStoreQuirks: true, JumpQuirks: true, ClipQuirks: true},
+	}
+
+	c := cpu.NewCpu(4096, 0x200)
+	if err := cart.Configure(c); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	expected := cpu.Quirks{Shift: true, Jump: true}
+	if c.Config.Quirks != expected {
+		t.Errorf("Expected quirks %+v, got %+v", expected, c.Config.Quirks)
+	}
+
+	if c.Memory[0x200] != 0x81 || c.Memory[0x201] != 0x26 {
+		t.Errorf("Expected program to be loaded at 0x200")
+	}
+}
+
+func TestOptions_Colors(t *testing.T) {
+	o := Options{FillColor: "#FFFFFF", BackgroundColor: "#000000", BlendColor: "#888888"}
+
+	colors := o.Colors()
+	if len(colors) != 3 || colors[0] != "#000000" || colors[2] != "#888888" {
+		t.Errorf("Expected background, fill and blend colours, got %v", colors)
+	}
+}
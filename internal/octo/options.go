@@ -0,0 +1,88 @@
+package octo
+
+import (
+	"encoding/json"
+	"strconv"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+// Number is an integer option. Octo writes these as JSON numbers, but
+// hand-maintained metadata often quotes them, so both are accepted.
+type Number int
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*n = Number(v)
+		return nil
+	}
+
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*n = Number(v)
+	return nil
+}
+
+// Options are the run settings Octo stores alongside a program, both in
+// cartridges and in CHIP-8 Archive metadata. Octo names its quirks after
+// the behaviour it enables, so several map to the inverse of ours.
+type Options struct {
+	TickRate        Number `json:"tickrate,omitempty"`
+	FillColor       string `json:"fillColor,omitempty"`
+	FillColor2      string `json:"fillColor2,omitempty"`
+	BlendColor      string `json:"blendColor,omitempty"`
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+	BuzzColor       string `json:"buzzColor,omitempty"`
+	QuietColor      string `json:"quietColor,omitempty"`
+	ShiftQuirks     bool   `json:"shiftQuirks"`
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"`
+	JumpQuirks      bool   `json:"jumpQuirks"`
+	LogicQuirks     bool   `json:"logicQuirks"`
+	ClipQuirks      bool   `json:"clipQuirks"`
+	VBlankQuirks    bool   `json:"vBlankQuirks"`
+	VfOrderQuirks   bool   `json:"vfOrderQuirks"`
+	MaxSize         Number `json:"maxSize,omitempty"`
+	ScreenRotation  Number `json:"screenRotation,omitempty"`
+	TouchInputMode  string `json:"touchInputMode,omitempty"`
+	FontStyle       string `json:"fontStyle,omitempty"`
+}
+
+// Presets are the quirk flags of Octo's compatibility profiles, keyed by
+// the platform names used by config and romdb. Octo has no CHIP-48 or
+// quirk-free profile, so chip48 and modern are missing.
+var Presets = map[string]Options{
+	"chip8":  {LogicQuirks: true, ClipQuirks: true, VBlankQuirks: true},
+	"schip":  {ShiftQuirks: true, LoadStoreQuirks: true, JumpQuirks: true, ClipQuirks: true},
+	"xochip": {},
+}
+
+// Quirks converts the Octo quirk flags. vBlankQuirks and vfOrderQuirks
+// have no counterpart in the interpreter and are ignored.
+func (o Options) Quirks() cpu.Quirks {
+	return cpu.Quirks{
+		Shift:           !o.ShiftQuirks,
+		MemoryIncrement: !o.LoadStoreQuirks,
+		Jump:            o.JumpQuirks,
+		VfReset:         o.LogicQuirks,
+		Wrap:            !o.ClipQuirks,
+	}
+}
+
+// Colors returns the palette as background, fill, fill2 and blend,
+// omitting any that are unset.
+func (o Options) Colors() []string {
+	var colors []string
+	for _, color := range []string{o.BackgroundColor, o.FillColor, o.FillColor2, o.BlendColor} {
+		if color != "" {
+			colors = append(colors, color)
+		}
+	}
+	return colors
+}
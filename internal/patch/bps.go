@@ -0,0 +1,216 @@
+package patch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const bpsMagic = "BPS1"
+
+// bpsFooterSize is the three CRC-32s that end a BPS patch: source,
+// target and the patch up to that point.
+const bpsFooterSize = 12
+
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// ApplyBPS applies a BPS patch. The source, the patch and the result are
+// each checked against the CRC-32 the patch records for them, and a
+// mismatch is reported as ErrChecksum.
+func ApplyBPS(source, patch []byte) ([]byte, error) {
+	if len(patch) < len(bpsMagic)+bpsFooterSize || string(patch[:len(bpsMagic)]) != bpsMagic {
+		return nil, errors.New("bps: missing BPS1 header")
+	}
+
+	footer := patch[len(patch)-bpsFooterSize:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:])
+
+	if got := crc32.ChecksumIEEE(patch[:len(patch)-4]); got != patchCRC {
+		return nil, fmt.Errorf("bps: patch %w: CRC-32 is %08X, expected %08X", ErrChecksum, got, patchCRC)
+	}
+	if got := crc32.ChecksumIEEE(source); got != sourceCRC {
+		return nil, fmt.Errorf("bps: source %w: CRC-32 is %08X, expected %08X; is this the ROM the patch was made for?", ErrChecksum, got, sourceCRC)
+	}
+
+	r := &bpsReader{data: patch[:len(patch)-bpsFooterSize], pos: len(bpsMagic)}
+	sourceSize := r.number()
+	targetSize := r.number()
+	metadataSize := r.number()
+	if r.err == nil && sourceSize != uint64(len(source)) {
+		return nil, fmt.Errorf("bps: source is %d bytes, expected %d", len(source), sourceSize)
+	}
+	if r.err == nil && targetSize > maxTargetSize {
+		return nil, fmt.Errorf("bps: target size %d is too large", targetSize)
+	}
+	r.skip(metadataSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	target := make([]byte, 0, min(targetSize, uint64(len(source)+len(patch))))
+	var sourceOffset, targetOffset int
+	for r.pos < len(r.data) {
+		action := r.number()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if action>>2 >= targetSize-uint64(len(target)) {
+			return nil, fmt.Errorf("bps: offset %d: action writes past the %d-byte target", r.pos, targetSize)
+		}
+		command, length := action&3, int(action>>2)+1
+
+		switch command {
+		case bpsSourceRead:
+			if len(target)+length > len(source) {
+				return nil, fmt.Errorf("bps: offset %d: source read past the end of the source", r.pos)
+			}
+			target = append(target, source[len(target):len(target)+length]...)
+		case bpsTargetRead:
+			target = append(target, r.bytes(length)...)
+		case bpsSourceCopy:
+			sourceOffset += r.signed()
+			if sourceOffset < 0 || sourceOffset > len(source)-length {
+				return nil, fmt.Errorf("bps: offset %d: source copy outside the source", r.pos)
+			}
+			target = append(target, source[sourceOffset:sourceOffset+length]...)
+			sourceOffset += length
+		case bpsTargetCopy:
+			targetOffset += r.signed()
+			if targetOffset < 0 || targetOffset >= len(target) {
+				return nil, fmt.Errorf("bps: offset %d: target copy outside the target", r.pos)
+			}
+			// The copy may overlap what it writes, which repeats a pattern.
+			for i := 0; i < length; i++ {
+				target = append(target, target[targetOffset])
+				targetOffset++
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+
+	if len(target) != int(targetSize) {
+		return nil, fmt.Errorf("bps: patch produced %d bytes, expected %d", len(target), targetSize)
+	}
+	if got := crc32.ChecksumIEEE(target); got != targetCRC {
+		return nil, fmt.Errorf("bps: target %w: CRC-32 is %08X, expected %08X", ErrChecksum, got, targetCRC)
+	}
+	return target, nil
+}
+
+// bpsReader decodes the variable-length numbers BPS uses. The first error
+// sticks and later reads return zero.
+type bpsReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bpsReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.err = fmt.Errorf("bps: offset %d: unexpected end of patch", r.pos)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *bpsReader) number() uint64 {
+	var n uint64
+	shift := uint64(1)
+	for i := 0; i < 10; i++ {
+		b := r.byte()
+		n += uint64(b&0x7F) * shift
+		if b&0x80 != 0 || r.err != nil {
+			return n
+		}
+		shift <<= 7
+		n += shift
+	}
+	r.err = fmt.Errorf("bps: offset %d: number too large", r.pos)
+	return 0
+}
+
+// signed decodes a relative offset: the low bit is the sign.
+func (r *bpsReader) signed() int {
+	n := r.number()
+	if n&1 != 0 {
+		return -int(n >> 1)
+	}
+	return int(n >> 1)
+}
+
+func (r *bpsReader) bytes(n int) []byte {
+	if r.err == nil && n > len(r.data)-r.pos {
+		r.err = fmt.Errorf("bps: offset %d: unexpected end of patch", r.pos)
+	}
+	if r.err != nil {
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *bpsReader) skip(n uint64) {
+	if r.err == nil && n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("bps: offset %d: metadata runs past the end", r.pos)
+		return
+	}
+	r.bytes(int(n))
+}
+
+func appendNumber(b []byte, n uint64) []byte {
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+		if n == 0 {
+			return append(b, 0x80|x)
+		}
+		b = append(b, x)
+		n--
+	}
+}
+
+// CreateBPS describes target as runs of bytes kept from the source at the
+// same offset and runs of new bytes stored in the patch. That is a fine
+// encoding for bug fixes and translations, which change bytes in place.
+func CreateBPS(source, target []byte) []byte {
+	patch := []byte(bpsMagic)
+	patch = appendNumber(patch, uint64(len(source)))
+	patch = appendNumber(patch, uint64(len(target)))
+	patch = appendNumber(patch, 0)
+
+	for i := 0; i < len(target); {
+		same := i < len(source) && source[i] == target[i]
+		end := i
+		for end < len(target) && (end < len(source) && source[end] == target[end]) == same {
+			end++
+		}
+
+		if same {
+			patch = appendNumber(patch, uint64(end-i-1)<<2|bpsSourceRead)
+		} else {
+			patch = appendNumber(patch, uint64(end-i-1)<<2|bpsTargetRead)
+			patch = append(patch, target[i:end]...)
+		}
+		i = end
+	}
+
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
@@ -0,0 +1,116 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ipsMagic = "PATCH"
+	ipsEOF   = "EOF"
+
+	// ipsEOFOffset is the record offset that would be read as the EOF
+	// marker, so no record may start there.
+	ipsEOFOffset = 0x454F46
+
+	ipsMaxSize = 0xFFFF
+)
+
+// ApplyIPS applies an IPS patch, including run-length records and the
+// truncation extension that follows the EOF marker.
+func ApplyIPS(source, patch []byte) ([]byte, error) {
+	if len(patch) < len(ipsMagic) || string(patch[:len(ipsMagic)]) != ipsMagic {
+		return nil, errors.New("ips: missing PATCH header")
+	}
+	target := append([]byte(nil), source...)
+
+	pos := len(ipsMagic)
+	for {
+		if pos+3 > len(patch) {
+			return nil, fmt.Errorf("ips: offset %d: missing EOF marker", pos)
+		}
+		if string(patch[pos:pos+3]) == ipsEOF {
+			pos += 3
+			break
+		}
+		if pos+5 > len(patch) {
+			return nil, fmt.Errorf("ips: offset %d: truncated record", pos)
+		}
+		offset := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		size := int(patch[pos+3])<<8 | int(patch[pos+4])
+		pos += 5
+
+		var data []byte
+		if size == 0 {
+			if pos+3 > len(patch) {
+				return nil, fmt.Errorf("ips: offset %d: truncated run", pos)
+			}
+			count := int(patch[pos])<<8 | int(patch[pos+1])
+			data = make([]byte, count)
+			for i := range data {
+				data[i] = patch[pos+2]
+			}
+			pos += 3
+		} else {
+			if pos+size > len(patch) {
+				return nil, fmt.Errorf("ips: offset %d: record of %d bytes runs past the end", pos, size)
+			}
+			data = patch[pos : pos+size]
+			pos += size
+		}
+
+		if end := offset + len(data); end > len(target) {
+			target = append(target, make([]byte, end-len(target))...)
+		}
+		copy(target[offset:], data)
+	}
+
+	switch len(patch) - pos {
+	case 0:
+	case 3:
+		size := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		if size < len(target) {
+			target = target[:size]
+		}
+	default:
+		return nil, fmt.Errorf("ips: offset %d: %d unexpected bytes after EOF", pos, len(patch)-pos)
+	}
+	return target, nil
+}
+
+// CreateIPS writes one record per run of differing bytes. A target
+// shorter than the source is recorded with the truncation extension.
+func CreateIPS(source, target []byte) ([]byte, error) {
+	if len(target) > maxTargetSize {
+		return nil, fmt.Errorf("ips: target of %d bytes is too large", len(target))
+	}
+
+	patch := []byte(ipsMagic)
+	for i := 0; i < len(target); {
+		if i < len(source) && source[i] == target[i] {
+			i++
+			continue
+		}
+
+		start := i
+		// Records at the offset spelling EOF would end the patch early,
+		// so start one byte sooner and rewrite a byte that is unchanged.
+		if start == ipsEOFOffset {
+			start--
+		}
+		end := i
+		for end < len(target) && end-start < ipsMaxSize && (end >= len(source) || source[end] != target[end]) {
+			end++
+		}
+
+		patch = append(patch, byte(start>>16), byte(start>>8), byte(start), byte((end-start)>>8), byte(end-start))
+		patch = append(patch, target[start:end]...)
+		i = end
+	}
+
+	patch = append(patch, ipsEOF...)
+	if len(target) < len(source) {
+		patch = append(patch, byte(len(target)>>16), byte(len(target)>>8), byte(len(target)))
+	}
+	return patch, nil
+}
@@ -0,0 +1,78 @@
+// Package patch applies and creates IPS and BPS patches, the usual
+// formats for distributing ROM hacks as a difference from the original.
+//
+// IPS is a list of byte ranges to overwrite and carries no checks. BPS
+// describes the target in terms of the source and records CRC-32s of the
+// source, the target and the patch itself, all of which Apply verifies.
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type Format string
+
+const (
+	IPS Format = "ips"
+	BPS Format = "bps"
+)
+
+// maxTargetSize bounds what a patch may produce, which is far more than
+// any CHIP-8 ROM needs. It is also the most IPS offsets can address.
+const maxTargetSize = 1 << 24
+
+var (
+	ErrUnknownFormat = errors.New("unknown patch format")
+	ErrChecksum      = errors.New("checksum mismatch")
+)
+
+// Detect returns the format of a patch from its header.
+func Detect(patch []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(ipsMagic)):
+		return IPS, nil
+	case bytes.HasPrefix(patch, []byte(bpsMagic)):
+		return BPS, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Apply patches source and returns the result; source is not modified.
+func Apply(source, patch []byte) ([]byte, error) {
+	format, err := Detect(patch)
+	if err != nil {
+		return nil, err
+	}
+	if format == IPS {
+		return ApplyIPS(source, patch)
+	}
+	return ApplyBPS(source, patch)
+}
+
+// ApplyFile patches source with the patch file at path.
+func ApplyFile(source []byte, path string) ([]byte, error) {
+	patch, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := Apply(source, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return target, nil
+}
+
+// Create returns a patch in format that turns source into target.
+func Create(format Format, source, target []byte) ([]byte, error) {
+	switch format {
+	case IPS:
+		return CreateIPS(source, target)
+	case BPS:
+		return CreateBPS(source, target), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
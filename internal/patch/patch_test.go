@@ -0,0 +1,164 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+var roundTrips = []struct {
+	name           string
+	source, target []byte
+}{
+	{"same", []byte{1, 2, 3}, []byte{1, 2, 3}},
+	{"changed", []byte{1, 2, 3, 4, 5}, []byte{1, 9, 3, 8, 8}},
+	{"grown", []byte{1, 2}, []byte{1, 3, 0, 0, 7}},
+	{"shrunk", []byte{1, 2, 3, 4}, []byte{1, 2}},
+	{"from nothing", nil, []byte{0x12, 0x00}},
+	{"to nothing", []byte{1}, []byte{}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{IPS, BPS} {
+		for _, tt := range roundTrips {
+			patch, err := Create(format, tt.source, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := Detect(patch); err != nil || got != format {
+				t.Errorf("%s %s: Expected the patch to be detected as %s, got %s (%v)", format, tt.name, format, got, err)
+			}
+
+			got, err := Apply(tt.source, patch)
+			if err != nil {
+				t.Errorf("%s %s: Expected the patch to apply, got %v", format, tt.name, err)
+				continue
+			}
+			if !bytes.Equal(got, tt.target) {
+				t.Errorf("%s %s: Expected %v, got %v", format, tt.name, tt.target, got)
+			}
+		}
+	}
+}
+
+func TestApplyIPS(t *testing.T) {
+	patch := []byte("PATCH" +
+		"\x00\x00\x01\x00\x02\xAA\xBB" + // two bytes at 1
+		"\x00\x00\x06\x00\x00\x00\x03\xCC" + // three 0xCC at 6
+		"EOF" + "\x00\x00\x08") // truncate to 8 bytes
+
+	got, err := ApplyIPS([]byte{0, 1, 2, 3}, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0xAA, 0xBB, 3, 0, 0, 0xCC, 0xCC}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	for _, bad := range []string{"PATCH", "PATCH\x00\x00\x01\x00\x05\xAA", "PATCHEOF\x00"} {
+		if _, err := ApplyIPS(nil, []byte(bad)); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestCreateIPSAvoidsEOFOffset(t *testing.T) {
+	source := make([]byte, ipsEOFOffset+2)
+	target := bytes.Clone(source)
+	target[ipsEOFOffset] = 1
+
+	patch, err := CreateIPS(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(patch[5:len(patch)-3], []byte("EOF")) {
+		t.Errorf("Expected no record to start at the EOF offset")
+	}
+	if got, err := ApplyIPS(source, patch); err != nil || !bytes.Equal(got, target) {
+		t.Errorf("Expected the patch to apply, got %v", err)
+	}
+}
+
+// TestApplyBPSCopies uses the two copy actions CreateBPS never emits.
+func TestApplyBPSCopies(t *testing.T) {
+	source := []byte("ABCDEF")
+	target := []byte("DEFxyxyxyA")
+
+	patch := []byte(bpsMagic)
+	patch = appendNumber(patch, uint64(len(source)))
+	patch = appendNumber(patch, uint64(len(target)))
+	patch = appendNumber(patch, 3)
+	patch = append(patch, "a=b"...)
+	patch = appendNumber(patch, 2<<2|bpsSourceCopy) // DEF
+	patch = appendNumber(patch, 3<<1)
+	patch = appendNumber(patch, 1<<2|bpsTargetRead) // xy
+	patch = append(patch, "xy"...)
+	patch = appendNumber(patch, 3<<2|bpsTargetCopy) // xyxy, overlapping
+	patch = appendNumber(patch, 3<<1)
+	patch = appendNumber(patch, 0<<2|bpsSourceCopy) // A, moving back
+	patch = appendNumber(patch, 6<<1|1)
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+
+	got, err := ApplyBPS(source, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(target) {
+		t.Errorf("Expected %q, got %q", target, got)
+	}
+}
+
+func TestApplyBPSChecksums(t *testing.T) {
+	source := []byte{1, 2, 3, 4}
+	patch := CreateBPS(source, []byte{1, 2, 5, 4})
+
+	if _, err := ApplyBPS([]byte{1, 2, 3, 5}, patch); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected the wrong source to fail its checksum, got %v", err)
+	}
+
+	corrupt := bytes.Clone(patch)
+	corrupt[len(corrupt)-13] ^= 0xFF
+	if _, err := ApplyBPS(source, corrupt); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected a corrupt patch to fail its checksum, got %v", err)
+	}
+
+	// A patch that is consistent with itself but produces the wrong target.
+	wrongTarget := bytes.Clone(patch[:len(patch)-8])
+	wrongTarget = binary.LittleEndian.AppendUint32(wrongTarget, 0)
+	wrongTarget = binary.LittleEndian.AppendUint32(wrongTarget, crc32.ChecksumIEEE(wrongTarget))
+	if _, err := ApplyBPS(source, wrongTarget); !errors.Is(err, ErrChecksum) || !bytes.Contains([]byte(err.Error()), []byte("target")) {
+		t.Errorf("Expected the target to fail its checksum, got %v", err)
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	if _, err := Apply(nil, []byte("UPS1")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func FuzzApply(f *testing.F) {
+	for _, tt := range roundTrips {
+		ips, _ := CreateIPS(tt.source, tt.target)
+		f.Add(tt.source, ips)
+		f.Add(tt.source, CreateBPS(tt.source, tt.target))
+	}
+
+	f.Fuzz(func(t *testing.T, source, patch []byte) {
+		Apply(source, patch)
+
+		// Skip the checksums so that the decoder itself is exercised.
+		if len(patch) >= len(bpsMagic)+bpsFooterSize && string(patch[:len(bpsMagic)]) == bpsMagic {
+			body := patch[:len(patch)-bpsFooterSize]
+			fixed := binary.LittleEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(source))
+			fixed = binary.LittleEndian.AppendUint32(fixed, 0)
+			fixed = binary.LittleEndian.AppendUint32(fixed, crc32.ChecksumIEEE(fixed))
+			ApplyBPS(source, fixed)
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package profile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+type frame struct {
+	entry    uint16
+	callSite uint16
+}
+
+// Profiler executes instructions on a Cpu and counts them per PC and per
+// call stack. Subroutines are inferred from CALL and RET: a CALL that
+// pushes onto the stack opens a frame for its target, a RET that pops
+// closes the innermost one.
+type Profiler struct {
+	cpu      *cpu.Cpu
+	Symbols  symbols.Table
+	PcCounts map[uint16]uint64
+
+	frames  []frame
+	samples map[string]*sample
+}
+
+type sample struct {
+	pcs     []uint16
+	entries []uint16
+	count   uint64
+}
+
+func New(c *cpu.Cpu, syms symbols.Table) *Profiler {
+	return &Profiler{
+		cpu:      c,
+		Symbols:  syms,
+		PcCounts: map[uint16]uint64{},
+		frames:   []frame{{entry: c.Config.ProgramStart}},
+		samples:  map[string]*sample{},
+	}
+}
+
+func (p *Profiler) Step() {
+	c := p.cpu
+	pc := c.Pc
+	sp := c.Sp
+	opcode := c.Opcode()
+
+	p.PcCounts[pc]++
+	p.record(pc)
+
+	c.Execute()
+
+	switch {
+	case opcode&0xF000 == 0x2000 && c.Sp == sp+1:
+		p.frames = append(p.frames, frame{entry: opcode & 0x0FFF, callSite: pc})
+	case opcode == 0x00EE && c.Sp+1 == sp && len(p.frames) > 1:
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+}
+
+func (p *Profiler) Run(steps int) {
+	for i := 0; i < steps; i++ {
+		p.Step()
+	}
+}
+
+// record counts one instruction at pc against the current call stack.
+// Stacks are stored leaf first: the executing pc, then each active call
+// site, alongside the entry point of the subroutine each one runs in.
+func (p *Profiler) record(pc uint16) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%04X", pc)
+	for i := len(p.frames) - 1; i > 0; i-- {
+		fmt.Fprintf(&sb, " %04X", p.frames[i].callSite)
+	}
+	key := sb.String()
+
+	if s, ok := p.samples[key]; ok {
+		s.count++
+		return
+	}
+
+	s := &sample{count: 1}
+	s.pcs = append(s.pcs, pc)
+	s.entries = append(s.entries, p.frames[len(p.frames)-1].entry)
+	for i := len(p.frames) - 1; i > 0; i-- {
+		s.pcs = append(s.pcs, p.frames[i].callSite)
+		s.entries = append(s.entries, p.frames[i-1].entry)
+	}
+	p.samples[key] = s
+}
+
+// FunctionCounts returns the number of instructions executed directly in
+// each subroutine, keyed by function name.
+func (p *Profiler) FunctionCounts() map[string]uint64 {
+	counts := map[string]uint64{}
+	for _, s := range p.samples {
+		counts[p.functionName(s.entries[0])] += s.count
+	}
+	return counts
+}
+
+func (p *Profiler) functionName(entry uint16) string {
+	if entry == p.cpu.Config.ProgramStart {
+		return p.Symbols.Name(entry, "main")
+	}
+	return p.Symbols.Name(entry, fmt.Sprintf("sub_%03X", entry))
+}
+
+// WritePprof writes the collected samples as a gzip-compressed
+// profile.proto message readable by go tool pprof.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strs := newStringTable()
+	var buf protoBuffer
+
+	buf.message(1, func(m *protoBuffer) {
+		m.int64(1, strs.index("instructions"))
+		m.int64(2, strs.index("count"))
+	})
+
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	locationIDs := map[uint16]uint64{}
+	functionIDs := map[uint16]uint64{}
+	owners := map[uint16]uint16{}
+
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.pcs))
+		for i, pc := range s.pcs {
+			id, ok := locationIDs[pc]
+			if !ok {
+				id = uint64(len(locationIDs) + 1)
+				locationIDs[pc] = id
+				owners[pc] = s.entries[i]
+			}
+			ids[i] = id
+		}
+		buf.message(2, func(m *protoBuffer) {
+			m.packedUint64(1, ids)
+			m.packedInt64(2, []int64{int64(s.count)})
+		})
+	}
+
+	buf.message(3, func(m *protoBuffer) {
+		m.uint64(1, 1)
+		m.uint64(3, uint64(len(p.cpu.Memory)))
+		m.int64(5, strs.index("rom"))
+		m.bool(7, true)
+		m.bool(8, true)
+	})
+
+	pcs := make([]uint16, 0, len(locationIDs))
+	for pc := range locationIDs {
+		pcs = append(pcs, pc)
+	}
+	sort.Slice(pcs, func(i, j int) bool { return locationIDs[pcs[i]] < locationIDs[pcs[j]] })
+
+	for _, pc := range pcs {
+		entry := owners[pc]
+		fid, ok := functionIDs[entry]
+		if !ok {
+			fid = uint64(len(functionIDs) + 1)
+			functionIDs[entry] = fid
+		}
+		buf.message(4, func(m *protoBuffer) {
+			m.uint64(1, locationIDs[pc])
+			m.uint64(2, 1)
+			m.uint64(3, uint64(pc))
+			m.message(4, func(line *protoBuffer) {
+				line.uint64(1, fid)
+				line.int64(2, int64(pc))
+			})
+		})
+	}
+
+	entries := make([]uint16, 0, len(functionIDs))
+	for entry := range functionIDs {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return functionIDs[entries[i]] < functionIDs[entries[j]] })
+
+	for _, entry := range entries {
+		name := strs.index(p.functionName(entry))
+		buf.message(5, func(m *protoBuffer) {
+			m.uint64(1, functionIDs[entry])
+			m.int64(2, name)
+			m.int64(3, name)
+			m.int64(4, strs.index("rom"))
+			m.int64(5, int64(entry))
+		})
+	}
+
+	for _, s := range strs.strings {
+		buf.string(6, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(buf.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type stringTable struct {
+	strings []string
+	indices map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indices: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indices[s]; ok {
+		return i
+	}
+	i := int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	t.indices[s] = i
+	return i
+}
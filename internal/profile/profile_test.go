@@ -0,0 +1,125 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/symbols"
+)
+
+// main: CALL 0x108; JP 0x100 (loop)
+// 0x108: ADD V1, 1; RET
+var loopProgram = []uint8{
+	0x21, 0x08, 0x11, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x71, 0x01, 0x00, 0xEE,
+}
+
+func newProfiler(syms symbols.Table) *Profiler {
+	c := cpu.NewCpu(512, 0x100)
+	c.LoadGame(loopProgram)
+	return New(c, syms)
+}
+
+func TestProfiler_counts(t *testing.T) {
+	p := newProfiler(nil)
+	p.Run(8)
+
+	if p.PcCounts[0x108] != 2 {
+		t.Errorf("Expected 0x108 to execute 2 times, got %d", p.PcCounts[0x108])
+	}
+
+	counts := p.FunctionCounts()
+
+	if counts["main"] != 4 {
+		t.Errorf("Expected main to execute 4 instructions, got %d", counts["main"])
+	}
+
+	if counts["sub_108"] != 4 {
+		t.Errorf("Expected sub_108 to execute 4 instructions, got %d", counts["sub_108"])
+	}
+}
+
+func TestProfiler_symbols(t *testing.T) {
+	p := newProfiler(symbols.Table{0x108: "increment"})
+	p.Run(4)
+
+	if p.FunctionCounts()["increment"] != 2 {
+		t.Errorf("Expected the symbol name to be used for 0x108, got %v", p.FunctionCounts())
+	}
+}
+
+func TestProfiler_WritePprof(t *testing.T) {
+	p := newProfiler(symbols.Table{0x108: "increment"})
+	p.Run(8)
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof failed: %v", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Expected gzip output: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress profile: %v", err)
+	}
+
+	fields := map[uint64]int{}
+	var strs []string
+	for len(data) > 0 {
+		key, n := readVarint(data)
+		data = data[n:]
+		if key&7 != 2 {
+			t.Fatalf("Expected only length-delimited top-level fields, got wire type %d", key&7)
+		}
+		length, n := readVarint(data)
+		data = data[n:]
+		if key>>3 == 6 {
+			strs = append(strs, string(data[:length]))
+		}
+		fields[key>>3]++
+		data = data[length:]
+	}
+
+	if fields[2] != 4 {
+		t.Errorf("Expected 4 distinct stacks, got %d samples", fields[2])
+	}
+
+	if fields[4] != 4 {
+		t.Errorf("Expected 4 locations, got %d", fields[4])
+	}
+
+	if fields[5] != 2 {
+		t.Errorf("Expected 2 functions, got %d", fields[5])
+	}
+
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("Expected string table to start with the empty string, got %q", strs)
+	}
+
+	found := false
+	for _, s := range strs {
+		if s == "increment" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected string table to contain the symbol name, got %q", strs)
+	}
+}
+
+func readVarint(data []byte) (uint64, int) {
+	var v uint64
+	for i, b := range data {
+		v |= uint64(b&0x7F) << (7 * i)
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, len(data)
+}
@@ -0,0 +1,77 @@
+package profile
+
+// A minimal protocol buffer writer, sufficient for the subset of
+// profile.proto that pprof needs. Field numbers follow
+// github.com/google/pprof/proto/profile.proto.
+
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.data = append(b.data, byte(v)|0x80)
+		v >>= 7
+	}
+	b.data = append(b.data, byte(v))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuffer) string(field int, v string) {
+	b.bytes(field, []byte(v))
+}
+
+func (b *protoBuffer) packedUint64(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed protoBuffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytes(field, packed.data)
+}
+
+func (b *protoBuffer) packedInt64(field int, vs []int64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed protoBuffer
+	for _, v := range vs {
+		packed.varint(uint64(v))
+	}
+	b.bytes(field, packed.data)
+}
+
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	var m protoBuffer
+	encode(&m)
+	b.bytes(field, m.data)
+}
@@ -0,0 +1,249 @@
+package cpu
+
+// RefMachine is a plain reading of the CHIP-8 instruction set, written
+// to be checked against the spec line by line rather than to be fast. It
+// shares no code with the interpreter, so running both side by side
+// catches regressions in either. It is exported only to the tests in
+// cpu_test, which check the generated vectors against it.
+//
+// Each instruction computes its result before touching VF, so a flag
+// always wins when VF is also the destination. Random returns the byte
+// Cxkk masks; it must be set before a Cxkk is stepped.
+type RefMachine struct {
+	Memory  []uint8
+	V       [16]uint8
+	I       uint16
+	PC      uint16
+	Stack   [16]uint16
+	SP      uint8
+	DT, ST  uint8
+	Display [DisplayWidth * DisplayHeight]uint8
+	Keys    [16]bool
+	Quirks  Quirks
+	Random  func() uint8
+}
+
+// Addresses wrap around the end of memory. PC wraps when it is fetched
+// from, so a jump past the end leaves it unwrapped until the next step.
+func (m *RefMachine) addr(a uint16) int {
+	return int(a) % len(m.Memory)
+}
+
+func (m *RefMachine) flag(set bool) {
+	if set {
+		m.V[0xF] = 1
+	} else {
+		m.V[0xF] = 0
+	}
+}
+
+// Step executes the instruction at PC.
+func (m *RefMachine) Step() {
+	m.PC = uint16(m.addr(m.PC))
+	opcode := uint16(m.Memory[m.addr(m.PC)])<<8 | uint16(m.Memory[m.addr(m.PC+1)])
+	x := opcode >> 8 & 0xF
+	y := opcode >> 4 & 0xF
+	n := opcode & 0xF
+	kk := uint8(opcode)
+	nnn := opcode & 0xFFF
+
+	next := m.PC + 2
+	skip := m.PC + 4
+
+	switch opcode >> 12 {
+	case 0x0:
+		switch opcode {
+		case 0x00E0:
+			m.Display = [DisplayWidth * DisplayHeight]uint8{}
+		case 0x00EE:
+			if m.SP == 0 || int(m.SP) > len(m.Stack) {
+				next = m.PC
+				break
+			}
+			m.SP--
+			next = m.Stack[m.SP]
+		}
+	case 0x1:
+		next = nnn
+	case 0x2:
+		if int(m.SP) == len(m.Stack) {
+			break
+		}
+		m.Stack[m.SP] = m.PC + 2
+		m.SP++
+		next = nnn
+	case 0x3:
+		if m.V[x] == kk {
+			next = skip
+		}
+	case 0x4:
+		if m.V[x] != kk {
+			next = skip
+		}
+	case 0x5:
+		if n == 0 && m.V[x] == m.V[y] {
+			next = skip
+		}
+	case 0x6:
+		m.V[x] = kk
+	case 0x7:
+		m.V[x] += kk
+	case 0x8:
+		m.alu(x, y, n)
+	case 0x9:
+		if n == 0 && m.V[x] != m.V[y] {
+			next = skip
+		}
+	case 0xA:
+		m.I = nnn
+	case 0xB:
+		if m.Quirks.Jump {
+			next = uint16(m.V[x]) + nnn
+		} else {
+			next = uint16(m.V[0]) + nnn
+		}
+	case 0xC:
+		m.V[x] = m.Random() & kk
+	case 0xD:
+		m.draw(m.V[x], m.V[y], n)
+	case 0xE:
+		pressed := m.Keys[m.V[x]&0xF]
+		switch kk {
+		case 0x9E:
+			if pressed {
+				next = skip
+			}
+		case 0xA1:
+			if !pressed {
+				next = skip
+			}
+		}
+	case 0xF:
+		next = m.misc(x, kk, next)
+	}
+
+	m.PC = next
+}
+
+func (m *RefMachine) alu(x, y, op uint16) {
+	vx, vy := m.V[x], m.V[y]
+
+	switch op {
+	case 0x0:
+		m.V[x] = vy
+	case 0x1, 0x2, 0x3:
+		switch op {
+		case 0x1:
+			m.V[x] = vx | vy
+		case 0x2:
+			m.V[x] = vx & vy
+		case 0x3:
+			m.V[x] = vx ^ vy
+		}
+		if m.Quirks.VfReset {
+			m.V[0xF] = 0
+		}
+	case 0x4:
+		m.V[x] = vx + vy
+		m.flag(int(vx)+int(vy) > 0xFF)
+	case 0x5:
+		m.V[x] = vx - vy
+		m.flag(vx >= vy)
+	case 0x6:
+		if m.Quirks.Shift {
+			vx = vy
+		}
+		m.V[x] = vx >> 1
+		m.flag(vx&0x01 != 0)
+	case 0x7:
+		m.V[x] = vy - vx
+		m.flag(vy >= vx)
+	case 0xE:
+		if m.Quirks.Shift {
+			vx = vy
+		}
+		m.V[x] = vx << 1
+		m.flag(vx&0x80 != 0)
+	}
+}
+
+func (m *RefMachine) draw(vx, vy uint8, rows uint16) {
+	collided := false
+	x0 := int(vx) % DisplayWidth
+	y0 := int(vy) % DisplayHeight
+
+	for row := 0; row < int(rows); row++ {
+		sprite := m.Memory[m.addr(m.I+uint16(row))]
+		for bit := 0; bit < 8; bit++ {
+			if sprite&(0x80>>bit) == 0 {
+				continue
+			}
+
+			px, py := x0+bit, y0+row
+			if !m.Quirks.Wrap && (px >= DisplayWidth || py >= DisplayHeight) {
+				continue
+			}
+			px %= DisplayWidth
+			py %= DisplayHeight
+
+			if m.Display[py*DisplayWidth+px] == 1 {
+				collided = true
+			}
+			m.Display[py*DisplayWidth+px] ^= 1
+		}
+	}
+
+	m.flag(collided)
+}
+
+func (m *RefMachine) misc(x uint16, op uint8, next uint16) uint16 {
+	switch op {
+	case 0x07:
+		m.V[x] = m.DT
+	case 0x0A:
+		for key := range m.Keys {
+			if m.Keys[key] {
+				m.V[x] = uint8(key)
+				return next
+			}
+		}
+		return m.PC
+	case 0x15:
+		m.DT = m.V[x]
+	case 0x18:
+		m.ST = m.V[x]
+	case 0x1E:
+		m.I += uint16(m.V[x])
+	case 0x29:
+		m.I = FontStart + uint16(m.V[x]&0xF)*FontGlyphSize
+	case 0x33:
+		m.Memory[m.addr(m.I)] = m.V[x] / 100
+		m.Memory[m.addr(m.I+1)] = m.V[x] / 10 % 10
+		m.Memory[m.addr(m.I+2)] = m.V[x] % 10
+	case 0x55:
+		for r := uint16(0); r <= x; r++ {
+			m.Memory[m.addr(m.I+r)] = m.V[r]
+		}
+		if m.Quirks.MemoryIncrement {
+			m.I += x + 1
+		}
+	case 0x65:
+		for r := uint16(0); r <= x; r++ {
+			m.V[r] = m.Memory[m.addr(m.I+r)]
+		}
+		if m.Quirks.MemoryIncrement {
+			m.I += x + 1
+		}
+	}
+	return next
+}
+
+// Tick decrements the delay and sound timers.
+func (m *RefMachine) Tick() {
+	if m.DT > 0 {
+		m.DT--
+	}
+	if m.ST > 0 {
+		m.ST--
+	}
+}
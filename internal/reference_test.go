@@ -0,0 +1,129 @@
+package cpu
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// newRefMachine copies c into a reference machine whose Cxkk draws come
+// from a generator seeded like c's.
+func newRefMachine(c *Cpu, seed int64) *RefMachine {
+	rng := rand.New(rand.NewSource(seed))
+	return &RefMachine{
+		Memory:  append([]uint8(nil), c.Memory...),
+		V:       c.Registers,
+		I:       c.I,
+		PC:      c.Pc,
+		Stack:   c.Stack,
+		SP:      c.Sp,
+		DT:      c.Dt,
+		ST:      c.St,
+		Display: c.Display,
+		Keys:    c.Keys,
+		Quirks:  c.Config.Quirks,
+		Random:  func() uint8 { return uint8(rng.Intn(256)) },
+	}
+}
+
+// mismatch returns the first piece of state that differs between the
+// production interpreter and the reference, or "" when they agree.
+func mismatch(c *Cpu, m *RefMachine) string {
+	switch {
+	case c.Pc != m.PC:
+		return fmt.Sprintf("PC: cpu 0x%03X, reference 0x%03X", c.Pc, m.PC)
+	case c.Sp != m.SP:
+		return fmt.Sprintf("SP: cpu %d, reference %d", c.Sp, m.SP)
+	case c.I != m.I:
+		return fmt.Sprintf("I: cpu 0x%03X, reference 0x%03X", c.I, m.I)
+	case c.Dt != m.DT || c.St != m.ST:
+		return fmt.Sprintf("timers: cpu DT=%d ST=%d, reference DT=%d ST=%d", c.Dt, c.St, m.DT, m.ST)
+	case c.Stack != m.Stack:
+		return fmt.Sprintf("stack: cpu %v, reference %v", c.Stack, m.Stack)
+	case c.Display != m.Display:
+		return "display"
+	}
+
+	for r := range c.Registers {
+		if c.Registers[r] != m.V[r] {
+			return fmt.Sprintf("V%X: cpu %d, reference %d", r, c.Registers[r], m.V[r])
+		}
+	}
+	for addr := range c.Memory {
+		if c.Memory[addr] != m.Memory[addr] {
+			return fmt.Sprintf("memory[0x%03X]: cpu %d, reference %d", addr, c.Memory[addr], m.Memory[addr])
+		}
+	}
+	return ""
+}
+
+// randomProgram is mostly valid instructions with random operands, with
+// some raw words mixed in. Jump and call targets stay in the program so
+// that runs don't wander into zeroed memory.
+func randomProgram(rng *rand.Rand, size int) []uint8 {
+	instructions := newInstructionSet()
+	program := make([]uint8, size)
+
+	for i := 0; i+1 < size; i += 2 {
+		var opcode uint16
+		if rng.Intn(10) == 0 {
+			opcode = uint16(rng.Intn(0x10000))
+		} else {
+			instr := instructions[rng.Intn(len(instructions))]
+			opcode = instr.Pattern | uint16(rng.Intn(0x10000))&^instr.Mask
+			switch instr.Pattern {
+			case 0x1000, 0x2000:
+				opcode = instr.Pattern | uint16(0x200+rng.Intn(size/2)*2)
+			}
+		}
+		program[i] = uint8(opcode >> 8)
+		program[i+1] = uint8(opcode)
+	}
+	return program
+}
+
+func TestReferenceModel(t *testing.T) {
+	const (
+		programs = 200
+		steps    = 2000
+	)
+
+	rng := rand.New(rand.NewSource(1))
+
+	for p := 0; p < programs; p++ {
+		quirks := quirksFromByte(uint8(rng.Intn(32)))
+		program := randomProgram(rng, 256)
+
+		c := NewCpu(4096, 0x200)
+		c.Config.Quirks = quirks
+		if err := c.LoadGame(program); err != nil {
+			t.Fatal(err)
+		}
+		seed := rng.Int63()
+		c.Rand = rand.New(rand.NewSource(seed))
+		ref := newRefMachine(c, seed)
+
+		for step := 0; step < steps; step++ {
+			if rng.Intn(8) == 0 {
+				for key := range c.Keys {
+					c.Keys[key] = rng.Intn(4) == 0
+				}
+				ref.Keys = c.Keys
+			}
+
+			pc := c.Pc
+			opcode := c.Opcode()
+			c.Execute()
+			ref.Step()
+			if step%10 == 9 {
+				c.TickTimers()
+				ref.Tick()
+			}
+
+			if diff := mismatch(c, ref); diff != "" {
+				t.Fatalf("Program %d (quirks %+v) diverged at step %d, %04X %s at 0x%03X: %s",
+					p, quirks, step, opcode, Disassemble(opcode), pc, diff)
+			}
+		}
+	}
+}
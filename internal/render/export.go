@@ -0,0 +1,77 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// glowLevels is how many shades between the background and each other
+// color GIF frames use for afterglow.
+const glowLevels = 16
+
+// Scale returns img enlarged n times, each pixel a square of n by n.
+func Scale(img image.Image, n int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()*n, b.Dy()*n))
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			out.Set(x, y, img.At(b.Min.X+x/n, b.Min.Y+y/n))
+		}
+	}
+	return out
+}
+
+// WritePNG writes img enlarged scale times.
+func WritePNG(w io.Writer, img image.Image, scale int) error {
+	return png.Encode(w, Scale(img, scale))
+}
+
+// GIF records frames for an animated GIF. Its colors are the palette and
+// the shades afterglow fades through.
+type GIF struct {
+	scale   int
+	delay   int
+	palette color.Palette
+	anim    gif.GIF
+}
+
+// NewGIF records frames of a renderer using palette, enlarged scale times
+// and each shown for delay hundredths of a second.
+func NewGIF(palette Palette, scale, delay int) *GIF {
+	g := &GIF{scale: scale, delay: delay}
+	bg := palette.color(0)
+	g.palette = append(g.palette, bg)
+	for _, c := range palette[1:] {
+		for level := 1; level <= glowLevels; level++ {
+			g.palette = append(g.palette, blend(bg, c, float64(level)/glowLevels))
+		}
+	}
+	return g
+}
+
+// Add records img as the next frame.
+func (g *GIF) Add(img image.Image) {
+	scaled := Scale(img, g.scale)
+	frame := image.NewPaletted(scaled.Rect, g.palette)
+	draw.Draw(frame, frame.Rect, scaled, image.Point{}, draw.Src)
+	g.anim.Image = append(g.anim.Image, frame)
+	g.anim.Delay = append(g.anim.Delay, g.delay)
+}
+
+// Len returns the number of frames recorded.
+func (g *GIF) Len() int {
+	return len(g.anim.Image)
+}
+
+// Encode writes the recorded frames as a GIF that loops forever.
+func (g *GIF) Encode(w io.Writer) error {
+	if len(g.anim.Image) == 0 {
+		return errors.New("no frames recorded")
+	}
+	return gif.EncodeAll(w, &g.anim)
+}
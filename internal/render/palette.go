@@ -0,0 +1,111 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Palette holds the colors of pixel values: the background first, then
+// lit pixels. A four-color palette gives each combination of the two
+// XO-CHIP planes its own color, with value 3 for pixels lit on both.
+type Palette []color.RGBA
+
+var builtins = map[string]Palette{
+	"mono":  mustParse("#000000", "#ffffff"),
+	"amber": mustParse("#1a0f00", "#ffb000"),
+	"green": mustParse("#001a08", "#33ff66"),
+
+	// Octo's default colors, for XO-CHIP games drawn on both planes.
+	"octo": mustParse("#996600", "#ffcc00", "#ff6600", "#662200"),
+
+	// The four shades of an early handheld LCD.
+	"lcd": mustParse("#9bbc0f", "#306230", "#8bac0f", "#0f380f"),
+}
+
+// Builtin returns a copy of the built-in palette called name.
+func Builtin(name string) (Palette, bool) {
+	p, ok := builtins[name]
+	return slices.Clone(p), ok
+}
+
+// Builtins lists the names of the built-in palettes.
+func Builtins() []string {
+	return slices.Sorted(maps.Keys(builtins))
+}
+
+// ParsePalette reads two to four "#rrggbb" colors, reporting every
+// invalid one.
+func ParsePalette(colors []string) (Palette, error) {
+	if len(colors) < 2 || len(colors) > 4 {
+		return nil, fmt.Errorf("palette has %d colors, want 2 to 4", len(colors))
+	}
+
+	p := make(Palette, len(colors))
+	var errs []error
+	for i, s := range colors {
+		c, err := parseColor(s)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		p[i] = c
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func mustParse(colors ...string) Palette {
+	p, err := ParsePalette(colors)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func parseColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
+
+// Hex returns the colors as "#rrggbb" strings.
+func (p Palette) Hex() []string {
+	out := make([]string, len(p))
+	for i, c := range p {
+		out[i] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return out
+}
+
+// Lookup returns the palette a flag or setting names: a built-in palette
+// or comma-separated colors.
+func Lookup(s string) (Palette, error) {
+	if p, ok := Builtin(s); ok {
+		return p, nil
+	}
+	if !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("unknown palette %q", s)
+	}
+	return ParsePalette(strings.Split(s, ","))
+}
+
+// color returns the color of a pixel value. Values past the end of the
+// palette take its last color, so a two-color palette shows pixels on
+// either plane lit.
+func (p Palette) color(v uint8) color.RGBA {
+	if int(v) >= len(p) {
+		return p[len(p)-1]
+	}
+	return p[v]
+}
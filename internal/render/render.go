@@ -0,0 +1,151 @@
+// Package render is the stage between the display buffer and the
+// frontends. It colors pixels from a palette, lets dark pixels fade like
+// the phosphor of a CRT, and can hold back the half-drawn frames that make
+// XOR sprite redraws flicker. It needs no window, so it also serves for
+// PNG and GIF export.
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+const size = cpu.DisplayWidth * cpu.DisplayHeight
+
+// maxHeld is how many frames in a row Steady may hold back, so that a
+// screen that keeps erasing is still shown.
+const maxHeld = 3
+
+type Options struct {
+	Palette Palette
+
+	// Decay is how much of a pixel's glow is left one frame after it goes
+	// dark, from 0 for none to below 1.
+	Decay float64
+
+	// Steady shows a frame only once the screen settles: frames that
+	// erase pixels without lighting any are held back until a sprite is
+	// drawn, the screen stops changing or maxHeld frames have passed.
+	Steady bool
+}
+
+// Renderer turns display buffers into images. Call Frame once per
+// emulated frame; decay and Steady both depend on the frames before.
+type Renderer struct {
+	options Options
+
+	last   [size]uint8 // the last frame given
+	screen [size]uint8 // the frame being shown
+	held   int
+
+	// The glow of each pixel, 1 when lit and decaying once dark, and the
+	// value it was last lit with.
+	glow  [size]float64
+	glowV [size]uint8
+
+	img *image.RGBA
+}
+
+func New(options Options) (*Renderer, error) {
+	var errs []error
+	if len(options.Palette) < 2 || len(options.Palette) > 4 {
+		errs = append(errs, fmt.Errorf("palette has %d colors, want 2 to 4", len(options.Palette)))
+	}
+	if options.Decay < 0 || options.Decay >= 1 {
+		errs = append(errs, fmt.Errorf("decay %g is not at least 0 and below 1", options.Decay))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{
+		options: options,
+		img:     image.NewRGBA(image.Rect(0, 0, cpu.DisplayWidth, cpu.DisplayHeight)),
+	}
+	r.draw()
+	return r, nil
+}
+
+// Options returns the options the renderer was created with.
+func (r *Renderer) Options() Options {
+	return r.options
+}
+
+// Reset forgets the frames before, as after loading a ROM.
+func (r *Renderer) Reset() {
+	r.last, r.screen, r.held = [size]uint8{}, [size]uint8{}, 0
+	r.glow, r.glowV = [size]float64{}, [size]uint8{}
+	r.draw()
+}
+
+// Frame takes the display buffer at the end of an emulated frame and
+// updates the screen and image.
+func (r *Renderer) Frame(display *[size]uint8) {
+	if !r.options.Steady || r.steady(display) {
+		r.screen = *display
+		r.held = 0
+	} else {
+		r.held++
+	}
+	r.last = *display
+
+	for i, v := range r.screen {
+		if v != 0 {
+			r.glow[i], r.glowV[i] = 1, v
+		} else {
+			r.glow[i] *= r.options.Decay
+		}
+	}
+	r.draw()
+}
+
+// steady reports whether display should be shown: it lights a pixel, it
+// is the same as the frame before, or too many frames were held back.
+func (r *Renderer) steady(display *[size]uint8) bool {
+	if r.held >= maxHeld || *display == r.last {
+		return true
+	}
+	for i, v := range display {
+		if v&^r.last[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Screen returns the pixel values being shown, which with Steady may
+// trail the display buffer by a few frames.
+func (r *Renderer) Screen() *[size]uint8 {
+	return &r.screen
+}
+
+// Image returns the shown frame with its afterglow, one image pixel per
+// display pixel. The image is reused by the next call to Frame.
+func (r *Renderer) Image() *image.RGBA {
+	return r.img
+}
+
+func (r *Renderer) draw() {
+	p := r.options.Palette
+	bg := p.color(0)
+	for i, v := range r.screen {
+		c := p.color(v)
+		if v == 0 && r.glow[i] > 0 {
+			c = blend(bg, p.color(r.glowV[i]), r.glow[i])
+		}
+		pix := r.img.Pix[i*4 : i*4+4]
+		pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
+	}
+}
+
+// blend mixes t of b into a.
+func blend(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 0xFF}
+}
@@ -0,0 +1,193 @@
+package render
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+var (
+	black = color.RGBA{0, 0, 0, 0xFF}
+	white = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+func mustNew(t *testing.T, options Options) *Renderer {
+	t.Helper()
+	if options.Palette == nil {
+		options.Palette, _ = Builtin("mono")
+	}
+	r, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLookup(t *testing.T) {
+	p, err := Lookup("#102030,#ffffff,#000000,#abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 4 || p[0] != (color.RGBA{0x10, 0x20, 0x30, 0xFF}) {
+		t.Errorf("Expected four colors starting with #102030, got %v", p)
+	}
+	if got := strings.Join(p.Hex(), ","); got != "#102030,#ffffff,#000000,#abcdef" {
+		t.Errorf("Expected the colors back as hex, got %s", got)
+	}
+
+	if _, err := Lookup("lcd"); err != nil {
+		t.Errorf("Expected the lcd palette to be built in, got %v", err)
+	}
+	if _, err := Lookup("sepia"); err == nil {
+		t.Errorf("Expected an unknown palette to fail")
+	}
+
+	_, err = ParsePalette([]string{"#000000", "red", "#12345g"})
+	if err == nil || !strings.Contains(err.Error(), "red") || !strings.Contains(err.Error(), "#12345g") {
+		t.Errorf("Expected both invalid colors to be reported, got %v", err)
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	_, err := New(Options{Palette: Palette{black}, Decay: 1})
+	if err == nil || !strings.Contains(err.Error(), "palette") || !strings.Contains(err.Error(), "decay") {
+		t.Errorf("Expected the palette and decay to be reported, got %v", err)
+	}
+}
+
+func TestRenderer_palette(t *testing.T) {
+	p, _ := Builtin("octo")
+	r := mustNew(t, Options{Palette: p})
+
+	var display [size]uint8
+	display[0], display[1], display[2] = 1, 2, 3
+	r.Frame(&display)
+
+	img := r.Image()
+	// Pixels 0-2 hold values 1-3 and pixel 3 the background.
+	for v, want := range p {
+		if got := img.RGBAAt((v+3)%4, 0); got != want {
+			t.Errorf("Expected value %d to be %v, got %v", v, want, got)
+		}
+	}
+
+	mono := mustNew(t, Options{})
+	mono.Frame(&display)
+	if got := mono.Image().RGBAAt(2, 0); got != white {
+		t.Errorf("Expected a two-color palette to show both planes lit, got %v", got)
+	}
+}
+
+func TestRenderer_decay(t *testing.T) {
+	r := mustNew(t, Options{Decay: 0.5})
+
+	var display [size]uint8
+	display[0] = 1
+	r.Frame(&display)
+	if got := r.Image().RGBAAt(0, 0); got != white {
+		t.Errorf("Expected a lit pixel to be white, got %v", got)
+	}
+
+	display[0] = 0
+	r.Frame(&display)
+	if got := r.Image().RGBAAt(0, 0); got.R != 0x80 {
+		t.Errorf("Expected half the glow after a frame, got %v", got)
+	}
+	r.Frame(&display)
+	if got := r.Image().RGBAAt(0, 0); got.R != 0x40 {
+		t.Errorf("Expected a quarter of the glow after two frames, got %v", got)
+	}
+
+	r.Reset()
+	if got := r.Image().RGBAAt(0, 0); got != black {
+		t.Errorf("Expected Reset to clear the glow, got %v", got)
+	}
+}
+
+func TestRenderer_steady(t *testing.T) {
+	r := mustNew(t, Options{Steady: true})
+
+	var sprite, erased, moved [size]uint8
+	sprite[0] = 1
+	moved[1] = 1
+
+	r.Frame(&sprite)
+	if r.Screen()[0] != 1 {
+		t.Fatalf("Expected a drawn sprite to be shown")
+	}
+
+	// The sprite is erased at the end of one frame and drawn one pixel
+	// over in the next: the blank frame between is never shown.
+	r.Frame(&erased)
+	if r.Screen()[0] != 1 {
+		t.Errorf("Expected the erase-only frame to be held back")
+	}
+	r.Frame(&moved)
+	if r.Screen()[0] != 0 || r.Screen()[1] != 1 {
+		t.Errorf("Expected the redrawn sprite to be shown")
+	}
+
+	// A real erase shows once the screen stops changing.
+	r.Frame(&erased)
+	r.Frame(&erased)
+	if r.Screen()[1] != 0 {
+		t.Errorf("Expected a settled erase to be shown")
+	}
+
+	plain := mustNew(t, Options{})
+	plain.Frame(&sprite)
+	plain.Frame(&erased)
+	if plain.Screen()[0] != 0 {
+		t.Errorf("Expected every frame to be shown without Steady")
+	}
+}
+
+func TestExport(t *testing.T) {
+	r := mustNew(t, Options{Decay: 0.5})
+	var display [size]uint8
+	display[0] = 1
+
+	var buf bytes.Buffer
+	r.Frame(&display)
+	if err := WritePNG(&buf, r.Image(), 4); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Errorf("Expected a 256x128 image, got %v", b)
+	}
+	if c := color.RGBAModel.Convert(img.At(3, 3)); c != white {
+		t.Errorf("Expected pixel 0 to fill a 4x4 square, got %v", c)
+	}
+
+	g := NewGIF(r.Options().Palette, 2, 5)
+	if err := g.Encode(&buf); err == nil {
+		t.Errorf("Expected an empty GIF to fail")
+	}
+	g.Add(r.Image())
+	display[0] = 0
+	r.Frame(&display)
+	g.Add(r.Image())
+
+	buf.Reset()
+	if err := g.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 || anim.Delay[1] != 5 {
+		t.Fatalf("Expected two frames of 5/100 s, got %d with delays %v", len(anim.Image), anim.Delay)
+	}
+	r8, _, _, _ := anim.Image[1].At(0, 0).RGBA()
+	if r8>>8 != 0x80 {
+		t.Errorf("Expected the afterglow shade in the second frame, got %#x", r8>>8)
+	}
+}
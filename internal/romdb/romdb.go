@@ -0,0 +1,191 @@
+package romdb
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+//go:embed roms.json
+var embedded []byte
+
+var (
+	hashPattern   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	colorPattern  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	knownPlatform = map[string]bool{"chip8": true, "chip48": true, "schip": true, "xochip": true, "modern": true}
+)
+
+type Entry struct {
+	Title                string           `json:"title"`
+	Platform             string           `json:"platform,omitempty"`
+	InstructionsPerFrame int              `json:"instructionsPerFrame,omitempty"`
+	Quirks               cpu.Quirks       `json:"quirks"`
+	Colors               []string         `json:"colors,omitempty"`
+	Keymap               map[string]uint8 `json:"keymap,omitempty"`
+}
+
+// Apply configures c for the ROM the entry describes.
+func (e Entry) Apply(c *cpu.Cpu) {
+	c.Config.Quirks = e.Quirks
+}
+
+// DB maps lowercase hex SHA-1 hashes of ROM images to their metadata.
+type DB struct {
+	entries map[string]Entry
+}
+
+func Parse(data []byte) (*DB, error) {
+	var entries map[string]Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	db := New()
+	var errs []error
+	for hash, e := range entries {
+		hash = strings.ToLower(hash)
+		if err := validate(hash, e); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		db.entries[hash] = e
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func validate(hash string, e Entry) error {
+	if !hashPattern.MatchString(hash) {
+		return fmt.Errorf("%q is not a SHA-1 hash", hash)
+	}
+	if e.Platform != "" && !knownPlatform[e.Platform] {
+		return fmt.Errorf("%s: unknown platform %q", hash, e.Platform)
+	}
+	if e.InstructionsPerFrame < 0 {
+		return fmt.Errorf("%s: negative instructionsPerFrame", hash)
+	}
+	for _, color := range e.Colors {
+		if !colorPattern.MatchString(color) {
+			return fmt.Errorf("%s: invalid color %q", hash, color)
+		}
+	}
+	for key, index := range e.Keymap {
+		if index > 0xF {
+			return fmt.Errorf("%s: key %q maps to keypad index %d", hash, key, index)
+		}
+	}
+	return nil
+}
+
+// Embedded returns the database compiled into the binary.
+func Embedded() *DB {
+	db, err := Parse(embedded)
+	if err != nil {
+		panic("romdb: invalid embedded database: " + err.Error())
+	}
+	return db
+}
+
+// Default returns the embedded database with the user's override file,
+// if there is one, applied on top.
+func Default() (*DB, error) {
+	db := Embedded()
+
+	path, err := OverridePath()
+	if err != nil {
+		return db, nil
+	}
+
+	if err := db.LoadOverrides(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OverridePath is the per-user override file, roms.json in the chip8
+// directory under os.UserConfigDir.
+func OverridePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "roms.json"), nil
+}
+
+// LoadOverrides reads a database file in the embedded format. Its
+// entries replace any existing entries with the same hash.
+func (db *DB) LoadOverrides(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	overrides, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	db.Override(overrides)
+	return nil
+}
+
+func (db *DB) Override(other *DB) {
+	for hash, e := range other.entries {
+		db.entries[hash] = e
+	}
+}
+
+func New() *DB {
+	return &DB{entries: map[string]Entry{}}
+}
+
+func (db *DB) Add(hash string, e Entry) error {
+	hash = strings.ToLower(hash)
+	if err := validate(hash, e); err != nil {
+		return err
+	}
+	db.entries[hash] = e
+	return nil
+}
+
+// Marshal encodes db in the format Parse reads.
+func (db *DB) Marshal() ([]byte, error) {
+	return json.MarshalIndent(db.entries, "", "  ")
+}
+
+func (db *DB) Len() int {
+	return len(db.entries)
+}
+
+func Hash(rom []byte) string {
+	sum := sha1.Sum(rom)
+	return hex.EncodeToString(sum[:])
+}
+
+func (db *DB) Lookup(rom []byte) (Entry, bool) {
+	e, ok := db.entries[Hash(rom)]
+	return e, ok
+}
+
+// LoadGame loads rom into c and, when the database knows it, applies
+// its metadata first. The returned bool reports whether it matched.
+func (db *DB) LoadGame(c *cpu.Cpu, rom []byte) (Entry, bool, error) {
+	e, ok := db.Lookup(rom)
+	if ok {
+		e.Apply(c)
+	}
+	return e, ok, c.LoadGame(rom)
+}
@@ -0,0 +1,129 @@
+package romdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+var testROM = []byte{0x83, 0x46, 0x12, 0x02}
+
+func testDB(t *testing.T) *DB {
+	t.Helper()
+
+	data := `{
+		"` + Hash(testROM) + `": {
+			"title": "Shift Test",
+			"platform": "chip8",
+			"instructionsPerFrame": 15,
+			"quirks": {"shift": true, "vfReset": true},
+			"colors": ["#000000", "#FFFFFF"],
+			"keymap": {"w": 5, "s": 8}
+		}
+	}`
+
+	db, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return db
+}
+
+func TestEmbedded(t *testing.T) {
+	db := Embedded()
+	if db.Len() == 0 {
+		t.Fatal("Expected the embedded database to have entries")
+	}
+
+	rom, err := os.ReadFile(filepath.Join("..", "testdata", "roms", "keypad.ch8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := db.Lookup(rom)
+	if !ok {
+		t.Fatalf("Expected keypad.ch8 (%s) to be in the embedded database", Hash(rom))
+	}
+	if e.Title != "Keypad Test" || e.Keymap["a"] != 0xA {
+		t.Errorf("Expected the keypad test entry with its keymap, got %+v", e)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	db := testDB(t)
+
+	e, ok := db.Lookup(testROM)
+	if !ok {
+		t.Fatal("Expected the test ROM to be found")
+	}
+
+	if e.Title != "Shift Test" || e.InstructionsPerFrame != 15 || e.Keymap["w"] != 5 {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	if _, ok := db.Lookup([]byte{0x00}); ok {
+		t.Errorf("Expected an unknown ROM not to be found")
+	}
+}
+
+func TestLoadGame_appliesQuirks(t *testing.T) {
+	db := testDB(t)
+	c := cpu.NewCpu(4096, 0x200)
+
+	_, ok, err := db.LoadGame(c, testROM)
+	if err != nil || !ok {
+		t.Fatalf("Expected LoadGame to match, got ok=%v err=%v", ok, err)
+	}
+
+	if !c.Config.Quirks.Shift || !c.Config.Quirks.VfReset {
+		t.Errorf("Expected quirks to be applied, got %+v", c.Config.Quirks)
+	}
+
+	c.Registers[4] = 0x04
+	c.Execute()
+
+	if c.Registers[3] != 0x02 {
+		t.Errorf("Expected shift quirk to shift V4 into V3, got 0x%X", c.Registers[3])
+	}
+}
+
+func TestParse_reportsEveryInvalidEntry(t *testing.T) {
+	data := `{
+		"nothex": {"title": "a"},
+		"0000000000000000000000000000000000000001": {"title": "b", "platform": "nes"},
+		"0000000000000000000000000000000000000002": {"title": "c", "colors": ["red"]},
+		"0000000000000000000000000000000000000003": {"title": "d", "keymap": {"q": 16}}
+	}`
+
+	_, err := Parse([]byte(data))
+	if err == nil {
+		t.Fatal("Expected Parse to fail")
+	}
+
+	for _, want := range []string{"not a SHA-1", "unknown platform", "invalid color", "keypad index 16"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	db := testDB(t)
+
+	path := filepath.Join(t.TempDir(), "roms.json")
+	data := `{"` + Hash(testROM) + `": {"title": "Local Title", "quirks": {"jump": true}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.LoadOverrides(path); err != nil {
+		t.Fatalf("LoadOverrides failed: %v", err)
+	}
+
+	e, _ := db.Lookup(testROM)
+	if e.Title != "Local Title" || !e.Quirks.Jump || e.Quirks.Shift {
+		t.Errorf("Expected the override to replace the entry, got %+v", e)
+	}
+}
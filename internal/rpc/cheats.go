@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/pesos228/chip8/internal/cheat"
+)
+
+// maxAddresses bounds the addresses searchNarrow lists; the count is
+// always exact.
+const maxAddresses = 256
+
+// searchStart begins a memory search with every address as a candidate.
+func (s *Server) searchStart(params json.RawMessage) (any, error) {
+	if err := decode(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	s.search = cheat.NewSearch(s.cpu)
+	return map[string]any{"count": len(s.cpu.Memory)}, nil
+}
+
+// searchNarrow drops the candidates that do not fit op: "equal" to value,
+// or "changed", "unchanged", "decreased" or "increased" since the last
+// narrowing.
+func (s *Server) searchNarrow(params json.RawMessage) (any, error) {
+	var p struct {
+		Op    string `json:"op"`
+		Value *uint8 `json:"value"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if s.search == nil {
+		return nil, newError(CodeUnknownState, "no search in progress, call searchStart")
+	}
+
+	var count int
+	switch p.Op {
+	case "equal":
+		if p.Value == nil {
+			return nil, newError(CodeInvalidParams, "equal needs a value")
+		}
+		count = s.search.Equal(*p.Value)
+	case "changed":
+		count = s.search.Changed()
+	case "unchanged":
+		count = s.search.Unchanged()
+	case "decreased":
+		count = s.search.Decreased()
+	case "increased":
+		count = s.search.Increased()
+	default:
+		return nil, newError(CodeInvalidParams, "unknown op %q", p.Op)
+	}
+
+	addresses := s.search.Candidates()
+	if len(addresses) > maxAddresses {
+		addresses = addresses[:maxAddresses]
+	}
+	return map[string]any{"count": count, "addresses": addresses}, nil
+}
+
+// freeze holds address at value at the start of every frame.
+func (s *Server) freeze(params json.RawMessage) (any, error) {
+	var p struct {
+		Address *int   `json:"address"`
+		Value   uint8  `json:"value"`
+		Comment string `json:"comment"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Address == nil {
+		return nil, newError(CodeInvalidParams, "expected an address")
+	}
+	if err := s.checkRange(*p.Address, 1); err != nil {
+		return nil, err
+	}
+
+	code := cheat.Code{Address: uint16(*p.Address), Value: p.Value, Comment: p.Comment}
+	s.cheats.Freeze(code)
+	s.cpu.Memory[code.Address] = code.Value
+	return nil, nil
+}
+
+func (s *Server) unfreeze(params json.RawMessage) (any, error) {
+	var p struct {
+		Address int `json:"address"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Address < 0 || p.Address > 0xFFFF || !s.cheats.Unfreeze(uint16(p.Address)) {
+		return nil, newError(CodeUnknownState, "address 0x%X is not frozen", p.Address)
+	}
+	return nil, nil
+}
+
+// listCheats returns the frozen codes in the cheat file format.
+func (s *Server) listCheats(params json.RawMessage) (any, error) {
+	if err := decode(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for _, code := range s.cheats.Codes() {
+		codes = append(codes, code.String())
+	}
+	return map[string]any{"codes": codes}, nil
+}
@@ -0,0 +1,366 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/cheat"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+var methods = map[string]method{
+	"load":           (*Server).load,
+	"reset":          (*Server).reset,
+	"step":           (*Server).step,
+	"frame":          (*Server).frame,
+	"getRegisters":   (*Server).getRegisters,
+	"setRegisters":   (*Server).setRegisters,
+	"readMemory":     (*Server).readMemory,
+	"writeMemory":    (*Server).writeMemory,
+	"setKey":         (*Server).setKey,
+	"getFramebuffer": (*Server).getFramebuffer,
+	"saveState":      (*Server).saveState,
+	"loadState":      (*Server).loadState,
+	"searchStart":    (*Server).searchStart,
+	"searchNarrow":   (*Server).searchNarrow,
+	"freeze":         (*Server).freeze,
+	"unfreeze":       (*Server).unfreeze,
+	"listCheats":     (*Server).listCheats,
+}
+
+// maxSteps bounds a single step or frame call so one request cannot
+// hold the machine indefinitely.
+const maxSteps = 10_000_000
+
+// Registers is the result of getRegisters and, with every field
+// optional, the params of setRegisters.
+type Registers struct {
+	V     [16]uint8  `json:"v"`
+	I     uint16     `json:"i"`
+	PC    uint16     `json:"pc"`
+	SP    uint8      `json:"sp"`
+	Stack [16]uint16 `json:"stack"`
+	DT    uint8      `json:"dt"`
+	ST    uint8      `json:"st"`
+}
+
+func (s *Server) registers() Registers {
+	c := s.cpu
+	return Registers{V: c.Registers, I: c.I, PC: c.Pc, SP: c.Sp, Stack: c.Stack, DT: c.Dt, ST: c.St}
+}
+
+// load takes either a path on the server's machine or the ROM bytes
+// themselves, in any format the loader understands. The quirks and speed
+// come from the resolver, which also reads the config next to a path.
+// Frozen codes and the search belong to the ROM they were made for, so
+// loading a different one drops them.
+func (s *Server) load(params json.RawMessage) (any, error) {
+	var p struct {
+		Path string `json:"path"`
+		Name string `json:"name"`
+		Data []int  `json:"data"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	data, err := toBytes(p.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rom *loader.ROM
+	switch {
+	case p.Path != "" && p.Data != nil:
+		return nil, newError(CodeInvalidParams, "give either path or data, not both")
+	case p.Path != "":
+		rom, err = loader.LoadFile(p.Path)
+	case p.Data != nil:
+		name := p.Name
+		if name == "" {
+			name = "rom"
+		}
+		rom, err = loader.Parse(name, data)
+	default:
+		return nil, newError(CodeInvalidParams, "expected path or data")
+	}
+	if err != nil {
+		return nil, newError(CodeLoadFailed, "%v", err)
+	}
+
+	settings, err := s.resolver.Load(s.cpu, rom, p.Path)
+	if err != nil {
+		return nil, newError(CodeLoadFailed, "%v", err)
+	}
+	s.instructionsPerFrame = settings.InstructionsPerFrame
+	if s.rom == nil || !bytes.Equal(s.rom.Data, rom.Data) {
+		s.cheats = cheat.Set{}
+		s.search = nil
+	}
+	s.rom = rom
+
+	return map[string]any{"name": rom.Name, "size": len(rom.Data)}, nil
+}
+
+// reset restarts the loaded ROM, or clears the machine if none is loaded.
+func (s *Server) reset(params json.RawMessage) (any, error) {
+	if err := decode(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	if s.rom == nil {
+		s.cpu.Reset()
+		return nil, nil
+	}
+	if err := s.rom.Load(s.cpu); err != nil {
+		return nil, newError(CodeLoadFailed, "%v", err)
+	}
+	return nil, nil
+}
+
+func count(n *int, what string) error {
+	if *n == 0 {
+		*n = 1
+	}
+	if *n < 0 || *n > maxSteps {
+		return newError(CodeInvalidParams, "%s must be between 1 and %d, got %d", what, maxSteps, *n)
+	}
+	return nil
+}
+
+// step executes count instructions, one by default.
+func (s *Server) step(params json.RawMessage) (any, error) {
+	var p struct {
+		Count int `json:"count"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if err := count(&p.Count, "count"); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < p.Count; i++ {
+		s.cpu.Execute()
+	}
+	return s.registers(), nil
+}
+
+// frame runs count frames, one by default: frozen cheats are applied,
+// then the configured number of instructions run and the timers tick.
+func (s *Server) frame(params json.RawMessage) (any, error) {
+	var p struct {
+		Count int `json:"count"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if err := count(&p.Count, "count"); err != nil {
+		return nil, err
+	}
+	if p.Count > maxSteps/s.instructionsPerFrame {
+		return nil, newError(CodeInvalidParams, "count must be at most %d", maxSteps/s.instructionsPerFrame)
+	}
+
+	for f := 0; f < p.Count; f++ {
+		s.cheats.Apply(s.cpu)
+		for i := 0; i < s.instructionsPerFrame; i++ {
+			s.cpu.Execute()
+		}
+		s.cpu.TickTimers()
+	}
+	return s.registers(), nil
+}
+
+func (s *Server) getRegisters(params json.RawMessage) (any, error) {
+	if err := decode(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+	return s.registers(), nil
+}
+
+// setRegisters changes only the fields given. V entries are set by
+// index: {"v": {"3": 10}} sets V3.
+func (s *Server) setRegisters(params json.RawMessage) (any, error) {
+	var p struct {
+		V     map[string]uint8 `json:"v"`
+		I     *uint16          `json:"i"`
+		PC    *uint16          `json:"pc"`
+		SP    *uint8           `json:"sp"`
+		Stack *[16]uint16      `json:"stack"`
+		DT    *uint8           `json:"dt"`
+		ST    *uint8           `json:"st"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	v := map[int]uint8{}
+	for key, value := range p.V {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(s.cpu.Registers) {
+			return nil, newError(CodeInvalidParams, "register index %q must be 0-15", key)
+		}
+		v[index] = value
+	}
+	if p.PC != nil && int(*p.PC) >= len(s.cpu.Memory) {
+		return nil, newError(CodeOutOfRange, "pc 0x%X is outside %d bytes of memory", *p.PC, len(s.cpu.Memory))
+	}
+	if p.SP != nil && int(*p.SP) > len(s.cpu.Stack) {
+		return nil, newError(CodeOutOfRange, "sp %d is deeper than the %d-entry stack", *p.SP, len(s.cpu.Stack))
+	}
+
+	c := s.cpu
+	for index, value := range v {
+		c.Registers[index] = value
+	}
+	if p.I != nil {
+		c.I = *p.I
+	}
+	if p.PC != nil {
+		c.Pc = *p.PC
+	}
+	if p.SP != nil {
+		c.Sp = *p.SP
+	}
+	if p.Stack != nil {
+		c.Stack = *p.Stack
+	}
+	if p.DT != nil {
+		c.Dt = *p.DT
+	}
+	if p.ST != nil {
+		c.St = *p.ST
+	}
+	return s.registers(), nil
+}
+
+func (s *Server) checkRange(address, length int) error {
+	if address < 0 || length < 0 || address+length > len(s.cpu.Memory) {
+		return newError(CodeOutOfRange, "%d bytes at 0x%X exceed %d bytes of memory", length, address, len(s.cpu.Memory))
+	}
+	return nil
+}
+
+// readMemory returns length bytes from address as an array of numbers.
+func (s *Server) readMemory(params json.RawMessage) (any, error) {
+	var p struct {
+		Address int `json:"address"`
+		Length  int `json:"length"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if err := s.checkRange(p.Address, p.Length); err != nil {
+		return nil, err
+	}
+
+	data := make([]int, p.Length)
+	for i := range data {
+		data[i] = int(s.cpu.Memory[p.Address+i])
+	}
+	return map[string]any{"address": p.Address, "data": data}, nil
+}
+
+func (s *Server) writeMemory(params json.RawMessage) (any, error) {
+	var p struct {
+		Address int   `json:"address"`
+		Data    []int `json:"data"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if err := s.checkRange(p.Address, len(p.Data)); err != nil {
+		return nil, err
+	}
+	data, err := toBytes(p.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(s.cpu.Memory[p.Address:], data)
+	return map[string]any{"written": len(data)}, nil
+}
+
+// toBytes converts a JSON array of numbers, the form scripts send bytes
+// in, checking each is a byte.
+func toBytes(values []int) ([]byte, error) {
+	if values == nil {
+		return nil, nil
+	}
+	data := make([]byte, len(values))
+	for i, value := range values {
+		if value < 0 || value > 0xFF {
+			return nil, newError(CodeInvalidParams, "data[%d] = %d is not a byte", i, value)
+		}
+		data[i] = uint8(value)
+	}
+	return data, nil
+}
+
+// setKey presses or releases keypad key 0-15.
+func (s *Server) setKey(params json.RawMessage) (any, error) {
+	var p struct {
+		Key     *int `json:"key"`
+		Pressed bool `json:"pressed"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Key == nil || *p.Key < 0 || *p.Key >= len(s.cpu.Keys) {
+		return nil, newError(CodeInvalidParams, "key must be 0-15")
+	}
+
+	s.cpu.Keys[*p.Key] = p.Pressed
+	return nil, nil
+}
+
+// getFramebuffer returns the display as rows of "0" and "1" characters,
+// which is easy to print and to index in any language.
+func (s *Server) getFramebuffer(params json.RawMessage) (any, error) {
+	if err := decode(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+
+	rows := make([]string, cpu.DisplayHeight)
+	row := make([]byte, cpu.DisplayWidth)
+	for y := range rows {
+		for x := range row {
+			row[x] = '0' + s.cpu.Display[y*cpu.DisplayWidth+x]
+		}
+		rows[y] = string(row)
+	}
+	return map[string]any{"width": cpu.DisplayWidth, "height": cpu.DisplayHeight, "rows": rows}, nil
+}
+
+// saveState keeps a snapshot in a named slot on the server.
+func (s *Server) saveState(params json.RawMessage) (any, error) {
+	var p struct {
+		Slot string `json:"slot"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	s.states[p.Slot] = s.cpu.Snapshot()
+	return map[string]any{"slot": p.Slot}, nil
+}
+
+func (s *Server) loadState(params json.RawMessage) (any, error) {
+	var p struct {
+		Slot string `json:"slot"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	snapshot, ok := s.states[p.Slot]
+	if !ok {
+		return nil, newError(CodeUnknownState, "no state saved in slot %q", p.Slot)
+	}
+	if err := s.cpu.Restore(snapshot); err != nil {
+		return nil, newError(CodeInternalError, "%v", err)
+	}
+	return s.registers(), nil
+}
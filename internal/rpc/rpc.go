@@ -0,0 +1,254 @@
+// Package rpc is a JSON-RPC 2.0 control API for a Cpu, for driving the
+// interpreter from scripts. Requests and responses are newline-delimited
+// JSON on a stream connection; batches and notifications are supported.
+//
+// Failures are reported as JSON-RPC error objects. Besides the standard
+// codes, the server uses CodeLoadFailed, CodeOutOfRange and
+// CodeUnknownState, and sets data to an object with a "detail" string.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/cheat"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/loader"
+)
+
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeLoadFailed   = -32001
+	CodeOutOfRange   = -32002
+	CodeUnknownState = -32003
+)
+
+const maxLineSize = 4 << 20
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    ErrorData `json:"data"`
+}
+
+type ErrorData struct {
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Message, e.Code, e.Data.Detail)
+}
+
+var messages = map[int]string{
+	CodeParseError:     "Parse error",
+	CodeInvalidRequest: "Invalid Request",
+	CodeMethodNotFound: "Method not found",
+	CodeInvalidParams:  "Invalid params",
+	CodeInternalError:  "Internal error",
+	CodeLoadFailed:     "ROM load failed",
+	CodeOutOfRange:     "Out of range",
+	CodeUnknownState:   "Unknown state",
+}
+
+func newError(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: messages[code], Data: ErrorData{Detail: fmt.Sprintf(format, args...)}}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type method func(s *Server, params json.RawMessage) (any, error)
+
+// Server serialises calls from any number of connections onto one Cpu.
+type Server struct {
+	mu                   sync.Mutex
+	cpu                  *cpu.Cpu
+	rom                  *loader.ROM
+	instructionsPerFrame int
+	resolver             *config.Resolver
+	states               map[string]cpu.Snapshot
+	search               *cheat.Search
+	cheats               cheat.Set
+}
+
+// NewServer controls c. rom, if not nil, is the program reset restarts.
+func NewServer(c *cpu.Cpu, rom *loader.ROM, instructionsPerFrame int) *Server {
+	return &Server{
+		cpu:                  c,
+		rom:                  rom,
+		instructionsPerFrame: instructionsPerFrame,
+		resolver:             &config.Resolver{},
+		states:               map[string]cpu.Snapshot{},
+	}
+}
+
+// SetResolver sets how the settings of a ROM given to load are found. By
+// default only the ROM's own hints are applied over the defaults.
+func (s *Server) SetResolver(r *config.Resolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolver = r
+}
+
+// Serve accepts connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn answers requests on rw, one JSON value per line, until the
+// connection is closed.
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	scanner := bufio.NewScanner(rw)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		reply := s.Handle(line)
+		if reply == nil {
+			continue
+		}
+		if _, err := rw.Write(append(reply, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Handle answers one request or batch and returns the encoded response,
+// or nil when nothing should be sent back.
+func (s *Server) Handle(data []byte) []byte {
+	var reply any
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			reply = response{JSONRPC: "2.0", Error: newError(CodeParseError, "%v", err), ID: json.RawMessage("null")}
+		} else if len(batch) == 0 {
+			reply = response{JSONRPC: "2.0", Error: newError(CodeInvalidRequest, "empty batch"), ID: json.RawMessage("null")}
+		} else {
+			var responses []response
+			for _, item := range batch {
+				if resp, ok := s.call(item); ok {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) == 0 {
+				return nil
+			}
+			reply = responses
+		}
+	} else {
+		resp, ok := s.call(data)
+		if !ok {
+			return nil
+		}
+		reply = resp
+	}
+
+	out, err := json.Marshal(reply)
+	if err != nil {
+		out, _ = json.Marshal(response{JSONRPC: "2.0", Error: newError(CodeInternalError, "%v", err), ID: json.RawMessage("null")})
+	}
+	return out
+}
+
+// call runs a single request. The boolean is false for notifications,
+// which get no response.
+func (s *Server) call(data []byte) (response, bool) {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return response{JSONRPC: "2.0", Error: newError(CodeParseError, "%v", err), ID: json.RawMessage("null")}, true
+		}
+		return response{JSONRPC: "2.0", Error: newError(CodeInvalidRequest, "%v", err), ID: json.RawMessage("null")}, true
+	}
+
+	id := req.ID
+	notification := id == nil
+	if notification {
+		id = json.RawMessage("null")
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return response{JSONRPC: "2.0", Error: newError(CodeInvalidRequest, "expected jsonrpc \"2.0\" and a method"), ID: id}, true
+	}
+
+	m, ok := methods[req.Method]
+	if !ok {
+		return response{JSONRPC: "2.0", Error: newError(CodeMethodNotFound, "no method %q", req.Method), ID: id}, !notification
+	}
+
+	s.mu.Lock()
+	result, err := m(s, req.Params)
+	s.mu.Unlock()
+
+	if notification {
+		return response{}, false
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = newError(CodeInternalError, "%v", err)
+		}
+		return response{JSONRPC: "2.0", Error: rpcErr, ID: id}, true
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	return response{JSONRPC: "2.0", Result: result, ID: id}, true
+}
+
+// decode unmarshals params, which may be omitted, rejecting unknown
+// fields so that typos in scripts are reported.
+func decode(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return newError(CodeInvalidParams, "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/config"
+)
+
+type reply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func call(t *testing.T, s *Server, req string) reply {
+	t.Helper()
+
+	out := s.Handle([]byte(req))
+	if out == nil {
+		t.Fatalf("Expected a response to %s", req)
+	}
+	var r reply
+	if err := json.Unmarshal(out, &r); err != nil {
+		t.Fatalf("Expected a JSON response, got %s: %v", out, err)
+	}
+	return r
+}
+
+func result(t *testing.T, s *Server, req string, v any) {
+	t.Helper()
+
+	r := call(t, s, req)
+	if r.Error != nil {
+		t.Fatalf("Expected %s to succeed, got %v", req, r.Error)
+	}
+	if v != nil {
+		if err := json.Unmarshal(r.Result, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+
+	tests := []struct {
+		req  string
+		code int
+	}{
+		{`{"jsonrpc":"2.0","method":"step"`, CodeParseError},
+		{`{"jsonrpc":"1.0","method":"step","id":1}`, CodeInvalidRequest},
+		{`{"jsonrpc":"2.0","method":"fly","id":1}`, CodeMethodNotFound},
+		{`{"jsonrpc":"2.0","method":"step","params":{"steps":1},"id":1}`, CodeInvalidParams},
+		{`{"jsonrpc":"2.0","method":"step","params":{"count":-1},"id":1}`, CodeInvalidParams},
+		{`{"jsonrpc":"2.0","method":"load","params":{"path":"/does/not/exist.ch8"},"id":1}`, CodeLoadFailed},
+		{`{"jsonrpc":"2.0","method":"readMemory","params":{"address":4000,"length":100},"id":1}`, CodeOutOfRange},
+		{`{"jsonrpc":"2.0","method":"writeMemory","params":{"address":0,"data":[256]},"id":1}`, CodeInvalidParams},
+		{`{"jsonrpc":"2.0","method":"loadState","params":{"slot":"missing"},"id":1}`, CodeUnknownState},
+		{`{"jsonrpc":"2.0","method":"searchNarrow","params":{"op":"changed"},"id":1}`, CodeUnknownState},
+		{`{"jsonrpc":"2.0","method":"freeze","params":{"address":4096,"value":1},"id":1}`, CodeOutOfRange},
+	}
+
+	for _, tt := range tests {
+		r := call(t, s, tt.req)
+		if r.Error == nil {
+			t.Errorf("Expected error %d for %s, got result %s", tt.code, tt.req, r.Result)
+			continue
+		}
+		if r.Error.Code != tt.code || r.Error.Message != messages[tt.code] || r.Error.Data.Detail == "" {
+			t.Errorf("Expected error %d %q with detail for %s, got %+v", tt.code, messages[tt.code], tt.req, r.Error)
+		}
+	}
+}
+
+func TestNotificationsAndBatches(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+
+	if out := s.Handle([]byte(`{"jsonrpc":"2.0","method":"setKey","params":{"key":3,"pressed":true}}`)); out != nil {
+		t.Errorf("Expected no response to a notification, got %s", out)
+	}
+	if !s.cpu.Keys[3] {
+		t.Error("Expected the notification to press key 3")
+	}
+
+	out := s.Handle([]byte(`[{"jsonrpc":"2.0","method":"getRegisters","id":1},{"jsonrpc":"2.0","method":"reset"},{"jsonrpc":"2.0","method":"nope","id":"b"}]`))
+	var replies []reply
+	if err := json.Unmarshal(out, &replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("Expected 2 replies, got %d", len(replies))
+	}
+	if string(replies[0].ID) != "1" || replies[0].Error != nil {
+		t.Errorf("Expected a result for id 1, got %+v", replies[0])
+	}
+	if string(replies[1].ID) != `"b"` || replies[1].Error == nil || replies[1].Error.Code != CodeMethodNotFound {
+		t.Errorf("Expected method not found for id \"b\", got %+v", replies[1])
+	}
+}
+
+func TestControlSession(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+
+	// LD V0, 8; LD F, V0; DRW V1, V1, 5; LD ST, V0; JP 208
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"name":"glyph.ch8","data":[96,8,240,41,209,21,240,24,18,8]},"id":1}`, nil)
+
+	var regs Registers
+	result(t, s, `{"jsonrpc":"2.0","method":"step","params":{"count":2},"id":2}`, &regs)
+	if regs.PC != 0x204 || regs.V[0] != 8 || regs.I != 40 {
+		t.Errorf("Expected PC 0x204, V0 8 and I 40, got %+v", regs)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"saveState","params":{"slot":"a"},"id":3}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"frame","id":4}`, &regs)
+	if regs.PC != 0x208 || regs.ST != 7 {
+		t.Errorf("Expected PC 0x208 and ST 7 after a frame, got %+v", regs)
+	}
+
+	var fb struct {
+		Width, Height int
+		Rows          []string
+	}
+	result(t, s, `{"jsonrpc":"2.0","method":"getFramebuffer","id":5}`, &fb)
+	if fb.Width != 64 || len(fb.Rows) != 32 || !strings.HasPrefix(fb.Rows[0], "11110000") {
+		t.Errorf("Expected the 8 glyph in the top-left corner, got %v", fb.Rows[:2])
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"loadState","params":{"slot":"a"},"id":6}`, &regs)
+	if regs.PC != 0x204 {
+		t.Errorf("Expected loadState to restore PC 0x204, got 0x%X", regs.PC)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"setRegisters","params":{"v":{"10":5},"i":768},"id":7}`, &regs)
+	if regs.V[10] != 5 || regs.I != 0x300 {
+		t.Errorf("Expected VA 5 and I 0x300, got %+v", regs)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"writeMemory","params":{"address":768,"data":[1,2,3]},"id":8}`, nil)
+	var mem struct{ Data []int }
+	result(t, s, `{"jsonrpc":"2.0","method":"readMemory","params":{"address":768,"length":3},"id":9}`, &mem)
+	if len(mem.Data) != 3 || mem.Data[2] != 3 {
+		t.Errorf("Expected [1 2 3], got %v", mem.Data)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"reset","id":10}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"getRegisters","id":11}`, &regs)
+	if regs.PC != 0x200 || regs.V[0] != 0 {
+		t.Errorf("Expected reset to restart the ROM, got %+v", regs)
+	}
+}
+
+func TestServeOverTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	go s.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("{\"jsonrpc\":\"2.0\",\"method\":\"getRegisters\",\"id\":7}\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r reply
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.ID) != "7" || r.Error != nil {
+		t.Errorf("Expected a result for id 7, got %s", line)
+	}
+}
+
+func TestCheats(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+
+	// Lose a life twice a frame: LD I, 0x300; LD V0, [I]; ADD V0, 0xFF; LD [I], V0; JP 0x200
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"data":[163,0,240,101,112,255,240,85,18,0]},"id":1}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"writeMemory","params":{"address":768,"data":[100]},"id":2}`, nil)
+
+	var search struct {
+		Count     int
+		Addresses []int
+	}
+	result(t, s, `{"jsonrpc":"2.0","method":"searchStart","id":3}`, &search)
+	if search.Count != 4096 {
+		t.Errorf("Expected every address to be a candidate, got %d", search.Count)
+	}
+	for i := 0; i < 2; i++ {
+		result(t, s, `{"jsonrpc":"2.0","method":"frame","id":4}`, nil)
+		result(t, s, `{"jsonrpc":"2.0","method":"searchNarrow","params":{"op":"decreased"},"id":5}`, &search)
+	}
+	result(t, s, `{"jsonrpc":"2.0","method":"searchNarrow","params":{"op":"equal","value":96},"id":6}`, &search)
+	if search.Count != 1 || search.Addresses[0] != 0x300 {
+		t.Errorf("Expected the search to find 0x300, got %+v", search)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"freeze","params":{"address":768,"value":9,"comment":"lives"},"id":7}`, nil)
+	var mem struct{ Data []int }
+	for i := 0; i < 3; i++ {
+		result(t, s, `{"jsonrpc":"2.0","method":"frame","id":8}`, nil)
+		result(t, s, `{"jsonrpc":"2.0","method":"readMemory","params":{"address":768,"length":1},"id":9}`, &mem)
+		if mem.Data[0] != 7 {
+			t.Errorf("Expected the frozen lives to be back to 9 at every frame and 7 after it, got %d", mem.Data[0])
+		}
+	}
+
+	var list struct{ Codes []string }
+	result(t, s, `{"jsonrpc":"2.0","method":"listCheats","id":10}`, &list)
+	if len(list.Codes) != 1 || list.Codes[0] != "0x300:09 # lives" {
+		t.Errorf("Expected the frozen code to be listed, got %v", list.Codes)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"unfreeze","params":{"address":768},"id":11}`, nil)
+	if r := call(t, s, `{"jsonrpc":"2.0","method":"unfreeze","params":{"address":768},"id":12}`); r.Error == nil || r.Error.Code != CodeUnknownState {
+		t.Errorf("Expected unfreezing twice to fail with CodeUnknownState, got %+v", r.Error)
+	}
+	result(t, s, `{"jsonrpc":"2.0","method":"frame","id":13}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"readMemory","params":{"address":768,"length":1},"id":14}`, &mem)
+	if mem.Data[0] != 5 {
+		t.Errorf("Expected the lives to fall again once unfrozen, got %d", mem.Data[0])
+	}
+}
+
+func TestLoadDropsCheatsForAnotherROM(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"data":[18,0]},"id":1}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"freeze","params":{"address":768,"value":9},"id":2}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"searchStart","id":3}`, nil)
+
+	var list struct{ Codes []string }
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"data":[18,0]},"id":4}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"listCheats","id":5}`, &list)
+	if len(list.Codes) != 1 {
+		t.Errorf("Expected reloading the same ROM to keep its cheats, got %v", list.Codes)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"data":[18,2,18,2]},"id":6}`, nil)
+	result(t, s, `{"jsonrpc":"2.0","method":"listCheats","id":7}`, &list)
+	if len(list.Codes) != 0 {
+		t.Errorf("Expected another ROM to drop the cheats, got %v", list.Codes)
+	}
+	if r := call(t, s, `{"jsonrpc":"2.0","method":"searchNarrow","params":{"op":"changed"},"id":8}`); r.Error == nil || r.Error.Code != CodeUnknownState {
+		t.Errorf("Expected another ROM to end the search, got %+v", r.Error)
+	}
+}
+
+func TestLoadResolvesSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "game.ch8")
+	if err := os.WriteFile(path, []byte{0x12, 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "game.json"), []byte(`{"platform": "chip8", "instructionsPerFrame": 7}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	params, _ := json.Marshal(map[string]string{"path": path})
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":`+string(params)+`,"id":1}`, nil)
+
+	chip8, _ := config.PlatformQuirks("chip8")
+	if s.cpu.Config.Quirks != chip8 || s.instructionsPerFrame != 7 {
+		t.Errorf("Expected the config next to the ROM to apply, got %+v at %d", s.cpu.Config.Quirks, s.instructionsPerFrame)
+	}
+
+	result(t, s, `{"jsonrpc":"2.0","method":"load","params":{"data":[18,2]},"id":2}`, nil)
+	if defaults := config.Defaults(); s.cpu.Config.Quirks != defaults.Quirks || s.instructionsPerFrame != defaults.InstructionsPerFrame {
+		t.Errorf("Expected another ROM not to keep the previous settings, got %+v at %d", s.cpu.Config.Quirks, s.instructionsPerFrame)
+	}
+}
@@ -0,0 +1,76 @@
+package cpu
+
+import (
+	"fmt"
+)
+
+type Snapshot struct {
+	Memory    []uint8
+	Registers [16]uint8
+	Stack     [16]uint16
+	Sp        uint8
+	Pc        uint16
+	I         uint16
+	Dt        uint8
+	St        uint8
+	Display   [DisplayWidth * DisplayHeight]uint8
+	Keys      [16]bool
+}
+
+// Snapshot copies the machine state between instructions. It may be
+// called from any goroutine while another one is running Execute. A PC
+// left past the end of memory by a jump is stored wrapped, as the next
+// Execute would fetch it.
+func (c *Cpu) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc := c.Pc
+	if len(c.Memory) > 0 {
+		pc = c.wrap(pc)
+	}
+
+	return Snapshot{
+		Memory:    append([]uint8(nil), c.Memory...),
+		Registers: c.Registers,
+		Stack:     c.Stack,
+		Sp:        c.Sp,
+		Pc:        pc,
+		I:         c.I,
+		Dt:        c.Dt,
+		St:        c.St,
+		Display:   c.Display,
+		Keys:      c.Keys,
+	}
+}
+
+// Restore replaces the machine state with s. Snapshots can come from a
+// peer, so one that does not fit this cpu is rejected and nothing is
+// changed.
+func (c *Cpu) Restore(s Snapshot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(s.Memory) != len(c.Memory) {
+		return fmt.Errorf("snapshot memory size (%d bytes) does not match cpu memory size (%d bytes)", len(s.Memory), len(c.Memory))
+	}
+	if int(s.Sp) > len(s.Stack) {
+		return fmt.Errorf("snapshot sp %d is deeper than the %d-entry stack", s.Sp, len(s.Stack))
+	}
+	if len(s.Memory) > 0 && int(s.Pc) >= len(s.Memory) {
+		return fmt.Errorf("snapshot pc 0x%X is outside the %d-byte memory", s.Pc, len(s.Memory))
+	}
+
+	copy(c.Memory, s.Memory)
+	c.Registers = s.Registers
+	c.Stack = s.Stack
+	c.Sp = s.Sp
+	c.Pc = s.Pc
+	c.I = s.I
+	c.Dt = s.Dt
+	c.St = s.St
+	c.Display = s.Display
+	c.Keys = s.Keys
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Table maps ROM addresses to labels. Symbol files hold one "addr label"
+// pair per line, with the address in hex (an optional 0x prefix is
+// accepted); blank lines and lines starting with # are ignored.
+type Table map[uint16]string
+
+func Parse(r io.Reader) (Table, error) {
+	table := Table{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"addr label\", got %q", line, text)
+		}
+
+		addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[0]), "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, fields[0])
+		}
+
+		table[uint16(addr)] = fields[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func Load(path string) (Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+func (t Table) Name(addr uint16, fallback string) string {
+	if name, ok := t[addr]; ok {
+		return name
+	}
+	return fallback
+}
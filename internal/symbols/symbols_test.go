@@ -0,0 +1,37 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+# labels exported from the assembler
+0x200 main
+2A4   draw_player
+`
+	table, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if table[0x200] != "main" {
+		t.Errorf("Expected 0x200 to be main, got %q", table[0x200])
+	}
+
+	if table[0x2A4] != "draw_player" {
+		t.Errorf("Expected 0x2A4 to be draw_player, got %q", table[0x2A4])
+	}
+
+	if name := table.Name(0x300, "sub_300"); name != "sub_300" {
+		t.Errorf("Expected fallback name sub_300, got %q", name)
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("0x200 main\nzz label\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+type Divergence struct {
+	Index  int
+	Fields []string
+}
+
+func Diff(a, b []Entry) *Divergence {
+	n := min(len(a), len(b))
+
+	for i := 0; i < n; i++ {
+		if fields := compare(a[i], b[i]); len(fields) > 0 {
+			return &Divergence{Index: i, Fields: fields}
+		}
+	}
+
+	if len(a) != len(b) {
+		return &Divergence{Index: n, Fields: []string{"length"}}
+	}
+
+	return nil
+}
+
+func compare(a, b Entry) []string {
+	var fields []string
+
+	if a.Pc != b.Pc {
+		fields = append(fields, "pc")
+	}
+	if a.Opcode != b.Opcode {
+		fields = append(fields, "opcode")
+	}
+	for i := range a.Registers {
+		if a.Registers[i] != b.Registers[i] {
+			fields = append(fields, fmt.Sprintf("v%X", i))
+		}
+	}
+	if a.I != b.I {
+		fields = append(fields, "i")
+	}
+	if a.Sp != b.Sp {
+		fields = append(fields, "sp")
+	}
+	if !slices.Equal(a.Writes, b.Writes) {
+		fields = append(fields, "writes")
+	}
+
+	return fields
+}
+
+func Report(w io.Writer, a, b []Entry, d *Divergence, context int) {
+	if d == nil {
+		fmt.Fprintf(w, "traces match (%d entries)\n", len(a))
+		return
+	}
+
+	fmt.Fprintf(w, "first divergence at entry %d: %v\n", d.Index, d.Fields)
+
+	start := max(d.Index-context, 0)
+	end := d.Index + context + 1
+
+	for i := start; i < end; i++ {
+		if i >= len(a) && i >= len(b) {
+			break
+		}
+		marker := " "
+		if i == d.Index {
+			marker = ">"
+		}
+		fmt.Fprintf(w, "%s a: %s\n", marker, entryAt(a, i))
+		fmt.Fprintf(w, "%s b: %s\n", marker, entryAt(b, i))
+	}
+}
+
+func entryAt(entries []Entry, i int) string {
+	if i >= len(entries) {
+		return "<end of trace>"
+	}
+	return entries[i].String()
+}
@@ -0,0 +1,191 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+type Write struct {
+	Addr  uint16
+	Value uint8
+}
+
+// Entry describes one executed instruction: Pc and Opcode as fetched, the
+// remaining fields as they were after the instruction completed.
+type Entry struct {
+	Step      int
+	Pc        uint16
+	Opcode    uint16
+	Registers [16]uint8
+	I         uint16
+	Sp        uint8
+	Writes    []Write
+}
+
+func Record(c *cpu.Cpu, steps int) []Entry {
+	entries := make([]Entry, 0, steps)
+	before := make([]uint8, len(c.Memory))
+
+	for step := 0; step < steps; step++ {
+		copy(before, c.Memory)
+		pc := c.Pc
+		opcode := c.Opcode()
+
+		c.Execute()
+
+		entry := Entry{
+			Step:      step,
+			Pc:        pc,
+			Opcode:    opcode,
+			Registers: c.Registers,
+			I:         c.I,
+			Sp:        c.Sp,
+		}
+		for addr := range c.Memory {
+			if c.Memory[addr] != before[addr] {
+				entry.Writes = append(entry.Writes, Write{Addr: uint16(addr), Value: c.Memory[addr]})
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func WriteEntries(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(bw, e.String()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (e Entry) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%06d pc=%04X op=%04X i=%04X sp=%X v=%X", e.Step, e.Pc, e.Opcode, e.I, e.Sp, e.Registers[:])
+	if len(e.Writes) > 0 {
+		sb.WriteString(" w=")
+		for i, wr := range e.Writes {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, "%04X:%02X", wr.Addr, wr.Value)
+		}
+	}
+	return sb.String()
+}
+
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		entry, err := parseEntry(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseEntry(text string) (Entry, error) {
+	var e Entry
+
+	fields := strings.Fields(text)
+	if len(fields) < 6 {
+		return e, fmt.Errorf("malformed trace entry %q", text)
+	}
+
+	step, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return e, fmt.Errorf("invalid step %q", fields[0])
+	}
+	e.Step = step
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return e, fmt.Errorf("malformed field %q", field)
+		}
+		switch key {
+		case "pc":
+			e.Pc, err = parseHex16(value)
+		case "op":
+			e.Opcode, err = parseHex16(value)
+		case "i":
+			e.I, err = parseHex16(value)
+		case "sp":
+			var sp uint64
+			sp, err = strconv.ParseUint(value, 16, 8)
+			e.Sp = uint8(sp)
+		case "v":
+			err = parseRegisters(value, &e.Registers)
+		case "w":
+			e.Writes, err = parseWrites(value)
+		default:
+			err = fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return e, err
+		}
+	}
+
+	return e, nil
+}
+
+func parseHex16(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 16, 16)
+	return uint16(v), err
+}
+
+func parseRegisters(s string, registers *[16]uint8) error {
+	if len(s) != 32 {
+		return fmt.Errorf("expected 32 hex digits for registers, got %d", len(s))
+	}
+	for i := range registers {
+		v, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return err
+		}
+		registers[i] = uint8(v)
+	}
+	return nil
+}
+
+func parseWrites(s string) ([]Write, error) {
+	var writes []Write
+	for _, pair := range strings.Split(s, ",") {
+		addr, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed write %q", pair)
+		}
+		a, err := parseHex16(addr)
+		if err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseUint(value, 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, Write{Addr: a, Value: uint8(v)})
+	}
+	return writes, nil
+}
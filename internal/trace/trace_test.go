@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+func newTracedCpu(program []uint8) *cpu.Cpu {
+	c := cpu.NewCpu(512, 0x100)
+	c.LoadGame(program)
+	return c
+}
+
+func TestRecord(t *testing.T) {
+	c := newTracedCpu([]uint8{0x61, 0x05, 0x71, 0x03, 0xA1, 0x23})
+
+	entries := Record(c, 3)
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	if entries[1].Pc != 0x102 || entries[1].Opcode != 0x7103 {
+		t.Errorf("Expected entry 1 to be 0x7103 at 0x102, got 0x%X at 0x%X", entries[1].Opcode, entries[1].Pc)
+	}
+
+	if entries[1].Registers[1] != 8 {
+		t.Errorf("Expected V1 after entry 1 to be 8, got %d", entries[1].Registers[1])
+	}
+
+	if entries[2].I != 0x123 {
+		t.Errorf("Expected I after entry 2 to be 0x123, got 0x%X", entries[2].I)
+	}
+}
+
+func TestWriteReadEntries(t *testing.T) {
+	entries := []Entry{
+		{Step: 0, Pc: 0x200, Opcode: 0x6A05, Registers: [16]uint8{10: 5}},
+		{Step: 1, Pc: 0x202, Opcode: 0xF355, I: 0x300, Sp: 2, Writes: []Write{{Addr: 0x300, Value: 1}, {Addr: 0x301, Value: 0xFF}}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEntries(&buf, entries); err != nil {
+		t.Fatalf("WriteEntries failed: %v", err)
+	}
+
+	got, err := ReadEntries(&buf)
+	if err != nil {
+		t.Fatalf("ReadEntries failed: %v", err)
+	}
+
+	if d := Diff(entries, got); d != nil {
+		t.Errorf("Expected round-tripped trace to match, diverged at %d: %v", d.Index, d.Fields)
+	}
+}
+
+func TestReadEntries_malformed(t *testing.T) {
+	_, err := ReadEntries(strings.NewReader("000000 pc=0200 op=6A05 i=0000 sp=0 v=00\n"))
+	if err == nil {
+		t.Fatal("Expected an error for a short register field")
+	}
+	if !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected error to name the line, got %q", err)
+	}
+}
+
+func TestDiff_registers(t *testing.T) {
+	program := []uint8{0x61, 0x05, 0x62, 0x07, 0x81, 0x25, 0x61, 0x00}
+
+	a := Record(newTracedCpu(program), 4)
+
+	b := Record(newTracedCpu(program), 4)
+	b[2].Registers[15] = 1
+
+	d := Diff(a, b)
+	if d == nil {
+		t.Fatal("Expected a divergence")
+	}
+
+	if d.Index != 2 {
+		t.Errorf("Expected divergence at entry 2, got %d", d.Index)
+	}
+
+	if len(d.Fields) != 1 || d.Fields[0] != "vF" {
+		t.Errorf("Expected divergence in vF, got %v", d.Fields)
+	}
+}
+
+func TestDiff_length(t *testing.T) {
+	program := []uint8{0x61, 0x05, 0x62, 0x07}
+
+	a := Record(newTracedCpu(program), 2)
+	b := Record(newTracedCpu(program), 1)
+
+	d := Diff(a, b)
+	if d == nil || d.Index != 1 || d.Fields[0] != "length" {
+		t.Errorf("Expected length divergence at entry 1, got %+v", d)
+	}
+}
+
+func TestReport(t *testing.T) {
+	program := []uint8{0x61, 0x01, 0x61, 0x02, 0x61, 0x03, 0x61, 0x04}
+
+	a := Record(newTracedCpu(program), 4)
+	b := Record(newTracedCpu(program), 4)
+	b[2].Registers[1] = 0xFF
+
+	var buf bytes.Buffer
+	Report(&buf, a, b, Diff(a, b), 1)
+
+	out := buf.String()
+	if !strings.Contains(out, "first divergence at entry 2: [v1]") {
+		t.Errorf("Expected report header, got:\n%s", out)
+	}
+
+	if strings.Count(out, "\n") != 7 {
+		t.Errorf("Expected header plus three pairs of context lines, got:\n%s", out)
+	}
+
+	if !strings.Contains(out, "> b: 000002") {
+		t.Errorf("Expected divergent entry to be marked, got:\n%s", out)
+	}
+}
@@ -0,0 +1,375 @@
+// Package vectors generates and checks single-step test vectors: an
+// initial machine state, one opcode, and the state after executing it.
+//
+// Vectors assume 4096 bytes of memory that is zero apart from the bytes
+// listed in the state, so the font is not preloaded.
+package vectors
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+const MemorySize = 4096
+
+// State is the machine state around one step. Keys has bit n set while
+// key n is held, RAM lists every non-zero byte as [address, value] in
+// address order, and Display lists the indices (y*64 + x) of lit pixels.
+type State struct {
+	PC      uint16      `json:"pc"`
+	I       uint16      `json:"i"`
+	SP      uint8       `json:"sp"`
+	DT      uint8       `json:"dt"`
+	ST      uint8       `json:"st"`
+	V       [16]uint8   `json:"v"`
+	Stack   [16]uint16  `json:"stack"`
+	Keys    uint16      `json:"keys"`
+	RAM     [][2]uint16 `json:"ram"`
+	Display []uint16    `json:"display"`
+}
+
+// Vector is one single-step test. Random, when present, is the byte the
+// random number generator returns during the step.
+type Vector struct {
+	Name    string     `json:"name"`
+	Opcode  uint16     `json:"opcode"`
+	Quirks  cpu.Quirks `json:"quirks"`
+	Random  *uint8     `json:"random,omitempty"`
+	Initial State      `json:"initial"`
+	Final   State      `json:"final"`
+}
+
+// Profile is a quirk setting to generate vectors for. Opcodes limits it
+// to the instructions the quirks change; nil means every instruction.
+type Profile struct {
+	Name    string
+	Quirks  cpu.Quirks
+	Opcodes []string
+}
+
+var Profiles = []Profile{
+	{Name: "base"},
+	{Name: "shift", Quirks: cpu.Quirks{Shift: true}, Opcodes: []string{"8xy6", "8xyE"}},
+	{Name: "memory-increment", Quirks: cpu.Quirks{MemoryIncrement: true}, Opcodes: []string{"Fx55", "Fx65"}},
+	{Name: "jump", Quirks: cpu.Quirks{Jump: true}, Opcodes: []string{"Bnnn"}},
+	{Name: "vf-reset", Quirks: cpu.Quirks{VfReset: true}, Opcodes: []string{"8xy1", "8xy2", "8xy3"}},
+	{Name: "wrap", Quirks: cpu.Quirks{Wrap: true}, Opcodes: []string{"Dxyn"}},
+}
+
+func LookupProfile(name string) (Profile, bool) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Instructions returns the entries of the instruction table the profile
+// covers.
+func (p Profile) Instructions() []cpu.Instruction {
+	var instrs []cpu.Instruction
+	for _, instr := range cpu.Instructions() {
+		if p.Opcodes == nil || slices.Contains(p.Opcodes, Code(instr)) {
+			instrs = append(instrs, instr)
+		}
+	}
+	return instrs
+}
+
+// Code returns the opcode form of an instruction's name, such as "8xy6"
+// for "SHR Vx {, Vy} (8xy6)". Vector files are named after it.
+func Code(instr cpu.Instruction) string {
+	_, code, _ := strings.Cut(instr.Name, " (")
+	return strings.TrimSuffix(code, ")")
+}
+
+// Generate returns n vectors for instr under quirks. The same seed always
+// produces the same vectors.
+func Generate(instr cpu.Instruction, quirks cpu.Quirks, n int, seed int64) []Vector {
+	h := fnv.New64a()
+	h.Write([]byte(instr.Name))
+	rng := rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+
+	vectors := make([]Vector, 0, n)
+	for i := 0; i < n; i++ {
+		v := Vector{
+			Opcode: opcodeFor(instr, rng),
+			Quirks: quirks,
+		}
+		v.Name = fmt.Sprintf("%s %04X #%d", Code(instr), v.Opcode, i)
+		if instr.Pattern == 0xC000 {
+			random := uint8(rng.Intn(256))
+			v.Random = &random
+		}
+
+		c := newCpu(quirks, v.Random)
+		randomize(c, instr, v.Opcode, rng)
+		v.Initial = capture(c)
+		c.Execute()
+		v.Final = capture(c)
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// opcodeFor picks random operands for instr, skipping opcodes that an
+// earlier table entry would decode, such as 00E0 for 0nnn.
+func opcodeFor(instr cpu.Instruction, rng *rand.Rand) uint16 {
+	for {
+		opcode := instr.Pattern | uint16(rng.Intn(0x10000))&^instr.Mask
+		for _, other := range cpu.Instructions() {
+			if opcode&other.Mask == other.Pattern {
+				if other.Name == instr.Name {
+					return opcode
+				}
+				break
+			}
+		}
+	}
+}
+
+func randomize(c *cpu.Cpu, instr cpu.Instruction, opcode uint16, rng *rand.Rand) {
+	c.Pc = uint16(rng.Intn(MemorySize/2)) * 2
+	c.I = uint16(rng.Intn(MemorySize))
+	c.Sp = uint8(rng.Intn(len(c.Stack) + 1))
+	c.Dt = uint8(rng.Intn(256))
+	c.St = uint8(rng.Intn(256))
+	for i := range c.Registers {
+		c.Registers[i] = uint8(rng.Intn(256))
+	}
+	for i := range c.Stack {
+		c.Stack[i] = uint16(rng.Intn(MemorySize/2)) * 2
+	}
+
+	var keys uint16
+	switch rng.Intn(3) {
+	case 1:
+		keys = 1 << rng.Intn(16)
+	case 2:
+		keys = uint16(rng.Intn(0x10000))
+	}
+	setKeys(c, keys)
+
+	// Sprites are drawn over a busy screen so that collisions are common;
+	// everything else gets a few stray pixels to catch accidental changes.
+	lit := 8
+	switch instr.Pattern {
+	case 0xD000:
+		lit = len(c.Display) / 4
+	case 0x00E0:
+		lit = 64
+	}
+	for i := 0; i < lit; i++ {
+		c.Display[rng.Intn(len(c.Display))] = 1
+	}
+
+	for i := 0; i < 16; i++ {
+		c.Memory[(int(c.I)+i)%MemorySize] = uint8(rng.Intn(256))
+	}
+	c.Memory[c.Pc] = uint8(opcode >> 8)
+	c.Memory[(c.Pc+1)%MemorySize] = uint8(opcode)
+}
+
+func newCpu(quirks cpu.Quirks, random *uint8) *cpu.Cpu {
+	c := cpu.NewCpu(MemorySize, 0x200)
+	c.Config.Quirks = quirks
+	clear(c.Memory)
+
+	var value uint8
+	if random != nil {
+		value = *random
+	}
+	c.Rand = rand.New(rand.NewSource(randomSeeds()[value]))
+	return c
+}
+
+// randomSeeds maps each byte to a seed whose generator returns that byte
+// from its first Intn(256), which is the one draw Cxkk makes. Only the
+// seeded sequence is relied on, and math/rand keeps that stable.
+var randomSeeds = sync.OnceValue(func() *[256]int64 {
+	var seeds [256]int64
+	var seen [256]bool
+	for seed, found := int64(0), 0; found < len(seeds); seed++ {
+		b := rand.New(rand.NewSource(seed)).Intn(256)
+		if !seen[b] {
+			seen[b], seeds[b] = true, seed
+			found++
+		}
+	}
+	return &seeds
+})
+
+func setKeys(c *cpu.Cpu, keys uint16) {
+	for i := range c.Keys {
+		c.Keys[i] = keys&(1<<i) != 0
+	}
+}
+
+func capture(c *cpu.Cpu) State {
+	s := State{
+		PC:    c.Pc,
+		I:     c.I,
+		SP:    c.Sp,
+		DT:    c.Dt,
+		ST:    c.St,
+		V:     c.Registers,
+		Stack: c.Stack,
+	}
+	for i, pressed := range c.Keys {
+		if pressed {
+			s.Keys |= 1 << i
+		}
+	}
+	for addr, value := range c.Memory {
+		if value != 0 {
+			s.RAM = append(s.RAM, [2]uint16{uint16(addr), uint16(value)})
+		}
+	}
+	for i, pixel := range c.Display {
+		if pixel != 0 {
+			s.Display = append(s.Display, uint16(i))
+		}
+	}
+	return s
+}
+
+func load(c *cpu.Cpu, s State) error {
+	c.Pc = s.PC
+	c.I = s.I
+	c.Sp = s.SP
+	c.Dt = s.DT
+	c.St = s.ST
+	c.Registers = s.V
+	c.Stack = s.Stack
+	setKeys(c, s.Keys)
+
+	for _, entry := range s.RAM {
+		if int(entry[0]) >= MemorySize || entry[1] > 0xFF {
+			return fmt.Errorf("invalid ram entry [%d, %d]", entry[0], entry[1])
+		}
+		c.Memory[entry[0]] = uint8(entry[1])
+	}
+	for _, i := range s.Display {
+		if int(i) >= len(c.Display) {
+			return fmt.Errorf("invalid display index %d", i)
+		}
+		c.Display[i] = 1
+	}
+	return nil
+}
+
+// Run executes the vector's opcode from its initial state and returns
+// the resulting state.
+func (v Vector) Run() (State, error) {
+	c := newCpu(v.Quirks, v.Random)
+	if err := load(c, v.Initial); err != nil {
+		return State{}, fmt.Errorf("%s: %w", v.Name, err)
+	}
+	c.Execute()
+	return capture(c), nil
+}
+
+// Check runs the vector and reports every field of the final state that
+// differs from the expected one.
+func (v Vector) Check() error {
+	got, err := v.Run()
+	if err != nil {
+		return err
+	}
+	return Compare(v.Name, v.Final, got)
+}
+
+// Compare reports every field of got that differs from want, prefixing
+// each difference with name.
+func Compare(name string, want, got State) error {
+	var errs []error
+	mismatch := func(field string, want, got any) {
+		errs = append(errs, fmt.Errorf("%s: expected %s to be %v, got %v", name, field, want, got))
+	}
+
+	if got.PC != want.PC {
+		mismatch("pc", want.PC, got.PC)
+	}
+	if got.I != want.I {
+		mismatch("i", want.I, got.I)
+	}
+	if got.SP != want.SP {
+		mismatch("sp", want.SP, got.SP)
+	}
+	if got.DT != want.DT {
+		mismatch("dt", want.DT, got.DT)
+	}
+	if got.ST != want.ST {
+		mismatch("st", want.ST, got.ST)
+	}
+	if got.V != want.V {
+		mismatch("v", want.V, got.V)
+	}
+	if got.Stack != want.Stack {
+		mismatch("stack", want.Stack, got.Stack)
+	}
+	if got.Keys != want.Keys {
+		mismatch("keys", want.Keys, got.Keys)
+	}
+	if !slices.Equal(got.RAM, want.RAM) {
+		mismatch("ram", want.RAM, got.RAM)
+	}
+	if !slices.Equal(got.Display, want.Display) {
+		mismatch("display", want.Display, got.Display)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Write encodes vectors as a JSON array with one vector per line.
+func Write(w io.Writer, vectors []Vector) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[\n")
+	for i, v := range vectors {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		if i < len(vectors)-1 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n")
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+func Read(r io.Reader) ([]Vector, error) {
+	var vectors []Vector
+	if err := json.NewDecoder(r).Decode(&vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func Load(path string) ([]Vector, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vectors, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vectors, nil
+}
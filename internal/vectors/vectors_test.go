@@ -0,0 +1,90 @@
+package vectors
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+)
+
+func instruction(t *testing.T, code string) cpu.Instruction {
+	t.Helper()
+	for _, instr := range cpu.Instructions() {
+		if Code(instr) == code {
+			return instr
+		}
+	}
+	t.Fatalf("Expected an instruction for %s", code)
+	return cpu.Instruction{}
+}
+
+func generate(t *testing.T, code string, quirks cpu.Quirks, n int) []Vector {
+	t.Helper()
+	return Generate(instruction(t, code), quirks, n, 1)
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	a := generate(t, "Dxyn", cpu.Quirks{}, 10)
+	b := generate(t, "Dxyn", cpu.Quirks{}, 10)
+
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same seed to generate the same vectors")
+	}
+}
+
+func TestGenerateSkipsOpcodesOfEarlierEntries(t *testing.T) {
+	for _, v := range generate(t, "0nnn", cpu.Quirks{}, 200) {
+		if v.Opcode == 0x00E0 || v.Opcode == 0x00EE {
+			t.Errorf("Expected 0nnn vectors to skip 0x%04X", v.Opcode)
+		}
+	}
+}
+
+func TestGenerateRecordsRandomByte(t *testing.T) {
+	for _, v := range generate(t, "Cxkk", cpu.Quirks{}, 20) {
+		x := (v.Opcode & 0x0F00) >> 8
+		want := *v.Random & uint8(v.Opcode)
+		if v.Final.V[x] != want {
+			t.Errorf("Expected V%X to be %d, got %d", x, want, v.Final.V[x])
+		}
+	}
+}
+
+func TestCheckReportsMismatches(t *testing.T) {
+	v := generate(t, "7xkk", cpu.Quirks{}, 1)[0]
+	if err := v.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	v.Final.PC++
+	v.Final.Display = append(v.Final.Display, 0)
+
+	err := v.Check()
+	if err == nil {
+		t.Fatal("Expected Check to fail")
+	}
+	for _, field := range []string{"pc", "display"} {
+		if !strings.Contains(err.Error(), "expected "+field) {
+			t.Errorf("Expected error to mention %s, got %v", field, err)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	vectors := generate(t, "Fx33", cpu.Quirks{}, 3)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, vectors); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, vectors) {
+		t.Error("Expected vectors to survive a write and read")
+	}
+}
@@ -0,0 +1,125 @@
+package cpu_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/vectors"
+)
+
+// The checked-in vectors are a small sample; generate more with a larger
+// -n to run them locally or hand them to another emulator.
+//
+//go:generate go run ../cmd/chip8 genvectors -n 25 testdata/vectors
+
+func TestVectors(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "vectors", "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected vector files in testdata/vectors")
+	}
+
+	for _, file := range files {
+		rel, _ := filepath.Rel(filepath.Join("testdata", "vectors"), file)
+		t.Run(filepath.ToSlash(rel), func(t *testing.T) {
+			vs, err := vectors.Load(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range vs {
+				if err := v.Check(); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+// runReference executes the vector's opcode on the reference model from
+// the vector's initial state.
+func runReference(v vectors.Vector) vectors.State {
+	s := v.Initial
+	m := &cpu.RefMachine{
+		Memory: make([]uint8, vectors.MemorySize),
+		V:      s.V,
+		I:      s.I,
+		PC:     s.PC,
+		Stack:  s.Stack,
+		SP:     s.SP,
+		DT:     s.DT,
+		ST:     s.ST,
+		Quirks: v.Quirks,
+		Random: func() uint8 { return *v.Random },
+	}
+	for i := range m.Keys {
+		m.Keys[i] = s.Keys&(1<<i) != 0
+	}
+	for _, entry := range s.RAM {
+		m.Memory[entry[0]] = uint8(entry[1])
+	}
+	for _, i := range s.Display {
+		m.Display[i] = 1
+	}
+
+	m.Step()
+
+	got := vectors.State{
+		PC:    m.PC,
+		I:     m.I,
+		SP:    m.SP,
+		DT:    m.DT,
+		ST:    m.ST,
+		V:     m.V,
+		Stack: m.Stack,
+		Keys:  s.Keys,
+	}
+	for addr, value := range m.Memory {
+		if value != 0 {
+			got.RAM = append(got.RAM, [2]uint16{uint16(addr), uint16(value)})
+		}
+	}
+	for i, pixel := range m.Display {
+		if pixel != 0 {
+			got.Display = append(got.Display, uint16(i))
+		}
+	}
+	return got
+}
+
+func TestVectorsAgreeWithReference(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 50
+	}
+
+	for _, p := range vectors.Profiles {
+		for _, instr := range p.Instructions() {
+			for _, v := range vectors.Generate(instr, p.Quirks, n, 2) {
+				if err := vectors.Compare(p.Name+" "+v.Name+": reference model", v.Final, runReference(v)); err != nil {
+					t.Error(err)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRunReferenceDetectsDisagreement(t *testing.T) {
+	var add cpu.Instruction
+	for _, instr := range cpu.Instructions() {
+		if vectors.Code(instr) == "8xy4" {
+			add = instr
+		}
+	}
+
+	v := vectors.Generate(add, cpu.Quirks{}, 1, 1)[0]
+	v.Final.V[0xF] ^= 1
+
+	if err := vectors.Compare(v.Name, v.Final, runReference(v)); err == nil || !strings.Contains(err.Error(), "expected v") {
+		t.Errorf("Expected a changed VF to disagree with the reference model, got %v", err)
+	}
+}
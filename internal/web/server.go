@@ -0,0 +1,529 @@
+// Package web serves a browser frontend for a Cpu. The page is embedded
+// and talks to the server over a WebSocket: the server streams frames and
+// sends the keymap for the running ROM, the buzzer sound and, with a
+// renderer, the colors to draw with, the page sends keys and pause and
+// reset commands. ROMs are uploaded with a POST to /rom.
+package web
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/cheat"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/keymap"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/render"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+const FrameRate = 60
+
+const maxROMSize = 1 << 20
+
+// Frame messages are binary: a status byte followed by the display packed
+// one bit per pixel, row by row, most significant bit first.
+const (
+	statusSound  = 1 << 0
+	statusPaused = 1 << 1
+	statusLoaded = 1 << 2
+)
+
+const frameSize = 1 + cpu.DisplayWidth*cpu.DisplayHeight/8
+
+// A page that falls this many messages behind, or takes longer than
+// writeTimeout to accept one, is disconnected.
+const (
+	clientQueueSize = 64
+	writeTimeout    = 5 * time.Second
+)
+
+// Command is a message from the page.
+type Command struct {
+	Type   string `json:"type"`
+	Key    int    `json:"key"`
+	Down   bool   `json:"down"`
+	Paused bool   `json:"paused"`
+}
+
+// Server drives one Cpu for every connected page, so all of them see and
+// control the same machine.
+type Server struct {
+	mu                   sync.Mutex
+	cpu                  *cpu.Cpu
+	rom                  *loader.ROM
+	instructionsPerFrame int
+	paused               bool
+	keys                 uint16
+	frameFunc            func(keys uint16) error
+	running              bool
+	stale                bool
+	cheats               *cheat.Set
+	keymapFunc           func(rom []byte) keymap.Keymap
+	resolver             *config.Resolver
+	renderer             *render.Renderer
+	audio                *config.Audio
+	clients              map[*client]bool
+	last                 []byte
+	mux                  *http.ServeMux
+}
+
+// NewServer serves c. rom may be nil, in which case the machine waits for
+// an upload.
+func NewServer(c *cpu.Cpu, rom *loader.ROM, instructionsPerFrame int) *Server {
+	s := &Server{
+		cpu:                  c,
+		rom:                  rom,
+		instructionsPerFrame: instructionsPerFrame,
+		resolver:             &config.Resolver{},
+		clients:              map[*client]bool{},
+		mux:                  http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /ws", s.handleWebSocket)
+	s.mux.HandleFunc("POST /rom", s.handleROM)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetFrameFunc hands running the machine to fn, which is called once per
+// frame with the keys held on the page as a bit mask, bit n for key n.
+// Netplay uses it to run frames in lockstep with another player, so fn is
+// called without the server's lock and may wait on the network; pages
+// cannot reset the machine or load a ROM while it is set. If fn fails the
+// machine is paused and the local loop takes over again.
+func (s *Server) SetFrameFunc(fn func(keys uint16) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frameFunc = fn
+}
+
+// SetCheats freezes the codes in set at the start of every frame the
+// server runs itself, until a different ROM is loaded. They are not
+// applied to frames run by a frame function, where they would put netplay
+// out of step.
+func (s *Server) SetCheats(set *cheat.Set) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cheats = set
+}
+
+// SetKeymapFunc chooses the keymap pages use for each ROM. Without one
+// every ROM gets keymap.Default.
+func (s *Server) SetKeymapFunc(fn func(rom []byte) keymap.Keymap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keymapFunc = fn
+	s.sendKeymap()
+}
+
+// SetResolver sets how the settings of an uploaded ROM are found. By
+// default only the ROM's own hints are applied over the defaults.
+func (s *Server) SetResolver(r *config.Resolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolver = r
+}
+
+// SetRenderer passes frames through r before they are sent, so pages
+// show its screen rather than the display buffer, and tells pages to draw
+// in its palette with its afterglow.
+func (s *Server) SetRenderer(r *render.Renderer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renderer = r
+	s.send(s.displayMessage())
+	s.broadcast(true)
+}
+
+// SetAudio tells pages how to sound the buzzer. Without it pages use
+// config.Defaults.
+func (s *Server) SetAudio(a config.Audio) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audio = &a
+	s.send(s.audioMessage())
+}
+
+// Run steps the machine at FrameRate until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second / FrameRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.clients {
+				s.drop(c)
+			}
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+			s.Step()
+		}
+	}
+}
+
+// Step runs one frame and sends the screen to every page if it changed.
+func (s *Server) Step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+
+	switch {
+	case s.paused:
+	case s.frameFunc != nil:
+		s.runFrameFunc()
+	case s.rom != nil:
+		if s.cheats != nil {
+			s.cheats.Apply(s.cpu)
+		}
+		for i := 0; i < s.instructionsPerFrame; i++ {
+			s.cpu.Execute()
+		}
+		s.cpu.TickTimers()
+	}
+	if !s.paused && s.renderer != nil {
+		s.renderer.Frame(&s.cpu.Display)
+	}
+
+	s.broadcast(false)
+}
+
+// runFrameFunc calls the frame function with s.mu released. The machine
+// belongs to it until it returns, so meanwhile nothing else touches the
+// cpu and frames to send are put off until it is done.
+func (s *Server) runFrameFunc() {
+	fn, keys := s.frameFunc, s.keys
+	s.running = true
+	s.mu.Unlock()
+	err := fn(keys)
+	s.mu.Lock()
+	s.running = false
+
+	if err != nil {
+		log.Printf("web: %v", err)
+		s.frameFunc = nil
+		s.paused = true
+	}
+}
+
+func (s *Server) frame() []byte {
+	msg := make([]byte, frameSize)
+	if s.cpu.SoundActive() {
+		msg[0] |= statusSound
+	}
+	if s.paused {
+		msg[0] |= statusPaused
+	}
+	if s.rom != nil || s.frameFunc != nil {
+		msg[0] |= statusLoaded
+	}
+	pixels := &s.cpu.Display
+	if s.renderer != nil {
+		pixels = s.renderer.Screen()
+	}
+	for i, pixel := range pixels {
+		if pixel != 0 {
+			msg[1+i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return msg
+}
+
+func (s *Server) broadcast(force bool) {
+	if s.running {
+		s.stale = true
+		return
+	}
+	force = force || s.stale
+	s.stale = false
+
+	msg := s.frame()
+	if !force && string(msg) == string(s.last) {
+		return
+	}
+	s.last = msg
+
+	for c := range s.clients {
+		s.queue(c, OpBinary, msg)
+	}
+}
+
+// keymapMessage is the text message that tells pages which host keys
+// press which keypad keys.
+func (s *Server) keymapMessage() []byte {
+	k := keymap.Default()
+	if s.keymapFunc != nil && s.rom != nil {
+		k = s.keymapFunc(s.rom.Data)
+	}
+	msg, _ := json.Marshal(map[string]any{"keymap": k})
+	return msg
+}
+
+// displayMessage is the text message that tells pages the renderer's
+// palette and decay, or nil without a renderer.
+func (s *Server) displayMessage() []byte {
+	if s.renderer == nil {
+		return nil
+	}
+	options := s.renderer.Options()
+	msg, _ := json.Marshal(map[string]any{"display": map[string]any{
+		"palette": options.Palette.Hex(),
+		"decay":   options.Decay,
+	}})
+	return msg
+}
+
+// audioMessage is the text message that tells pages the buzzer's
+// settings, or nil if none were set.
+func (s *Server) audioMessage() []byte {
+	if s.audio == nil {
+		return nil
+	}
+	msg, _ := json.Marshal(map[string]any{"audio": map[string]any{
+		"enabled":   s.audio.Enabled,
+		"frequency": s.audio.Frequency,
+		"volume":    s.audio.Volume,
+	}})
+	return msg
+}
+
+func (s *Server) sendKeymap() {
+	s.send(s.keymapMessage())
+}
+
+// send sends a text message to every page.
+func (s *Server) send(msg []byte) {
+	if msg == nil {
+		return
+	}
+	for c := range s.clients {
+		s.queue(c, OpText, msg)
+	}
+}
+
+// client is a connected page. Messages to it are queued and written by
+// its own goroutine, so a page that stops reading holds up nobody else.
+type client struct {
+	conn *Conn
+	out  chan message
+}
+
+type message struct {
+	op   byte
+	data []byte
+}
+
+func (s *Server) addClient(conn *Conn) *client {
+	c := &client{conn: conn, out: make(chan message, clientQueueSize)}
+	s.clients[c] = true
+	go c.write()
+	return c
+}
+
+// queue hands msg to c's writer, dropping c if its queue is full.
+func (s *Server) queue(c *client, op byte, msg []byte) {
+	select {
+	case c.out <- message{op, msg}:
+	default:
+		log.Printf("web: dropping a page that stopped reading")
+		s.drop(c)
+	}
+}
+
+// drop disconnects c. The page's read loop then ends on its own.
+func (s *Server) drop(c *client) {
+	if !s.clients[c] {
+		return
+	}
+	delete(s.clients, c)
+	close(c.out)
+	c.conn.Close()
+}
+
+func (c *client) write() {
+	for msg := range c.out {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := c.conn.WriteMessage(msg.op, msg.data); err != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	c := s.addClient(conn)
+	s.queue(c, OpText, s.keymapMessage())
+	for _, msg := range [][]byte{s.displayMessage(), s.audioMessage()} {
+		if msg != nil {
+			s.queue(c, OpText, msg)
+		}
+	}
+	if s.running {
+		s.stale = true
+	} else {
+		s.queue(c, OpBinary, s.frame())
+	}
+	s.mu.Unlock()
+
+	for err == nil {
+		var op byte
+		var data []byte
+		op, data, err = conn.ReadMessage()
+		if err != nil || op != OpText {
+			continue
+		}
+
+		var cmd Command
+		if json.Unmarshal(data, &cmd) != nil {
+			log.Printf("web: ignoring malformed command %q", data)
+			continue
+		}
+		s.Apply(cmd)
+	}
+
+	s.mu.Lock()
+	s.drop(c)
+	s.mu.Unlock()
+}
+
+// Apply carries out a command from a page.
+func (s *Server) Apply(cmd Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd.Type {
+	case "key":
+		if cmd.Key < 0 || cmd.Key >= len(s.cpu.Keys) {
+			break
+		}
+		if cmd.Down {
+			s.keys |= 1 << cmd.Key
+		} else {
+			s.keys &^= 1 << cmd.Key
+		}
+		if s.frameFunc == nil && !s.running {
+			s.cpu.Keys[cmd.Key] = cmd.Down
+		}
+	case "pause":
+		s.paused = cmd.Paused
+	case "reset":
+		if s.frameFunc != nil || s.running {
+			log.Printf("web: ignoring reset during netplay")
+			return
+		}
+		if s.rom != nil {
+			if err := s.rom.Load(s.cpu); err != nil {
+				log.Printf("web: reset: %v", err)
+			}
+			s.resetRenderer()
+		}
+	default:
+		log.Printf("web: ignoring unknown command %q", cmd.Type)
+		return
+	}
+
+	s.broadcast(true)
+}
+
+// handleROM takes uploads from the page. Uploads from pages on other
+// origins are refused, so another site cannot swap the running ROM.
+func (s *Server) handleROM(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin upload", http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxROMSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "upload"
+	}
+	rom, err := loader.Parse(name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Load(rom); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Load replaces the running program and unpauses the machine. The
+// quirks and speed come from the resolver rather than the previous ROM.
+// Cheats made for another ROM are dropped. It fails while a frame
+// function is set.
+func (s *Server) Load(rom *loader.ROM) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.frameFunc != nil || s.running {
+		return errors.New("web: cannot load a ROM during netplay")
+	}
+
+	settings, err := s.resolver.Load(s.cpu, rom, "")
+	if err != nil {
+		return err
+	}
+	s.instructionsPerFrame = settings.InstructionsPerFrame
+	if s.rom == nil || !bytes.Equal(s.rom.Data, rom.Data) {
+		s.cheats = nil
+	}
+	for i := range s.cpu.Keys {
+		s.cpu.Keys[i] = false
+	}
+	s.keys = 0
+	s.rom = rom
+	s.paused = false
+	s.resetRenderer()
+	s.sendKeymap()
+	s.broadcast(true)
+	return nil
+}
+
+// resetRenderer starts the renderer afresh on the display of a newly
+// loaded program.
+func (s *Server) resetRenderer() {
+	if s.renderer != nil {
+		s.renderer.Reset()
+		s.renderer.Frame(&s.cpu.Display)
+	}
+}
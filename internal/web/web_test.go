@@ -0,0 +1,510 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cpu "github.com/pesos228/chip8/internal"
+	"github.com/pesos228/chip8/internal/cheat"
+	"github.com/pesos228/chip8/internal/config"
+	"github.com/pesos228/chip8/internal/keymap"
+	"github.com/pesos228/chip8/internal/loader"
+	"github.com/pesos228/chip8/internal/render"
+	"github.com/pesos228/chip8/internal/romdb"
+)
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, server *httptest.Server) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != acceptKey(key) {
+		t.Fatalf("Expected accept key %s, got %s", acceptKey(key), got)
+	}
+
+	return &testClient{conn: conn, r: r}
+}
+
+func (c *testClient) send(t *testing.T, fin bool, op byte, payload []byte) {
+	t.Helper()
+
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	header := []byte{b0}
+	if len(payload) < 126 {
+		header = append(header, 0x80|byte(len(payload)))
+	} else {
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+
+	if _, err := c.conn.Write(append(append(header, mask...), masked...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func (c *testClient) keymap(t *testing.T) keymap.Keymap {
+	t.Helper()
+
+	op, data := c.read(t)
+	var msg struct{ Keymap keymap.Keymap }
+	if op != OpText || json.Unmarshal(data, &msg) != nil {
+		t.Fatalf("Expected a keymap message, got op %d %q", op, data)
+	}
+	return msg.Keymap
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455, section 1.3.
+	expected := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != expected {
+		t.Errorf("Expected accept key %s, got %s", expected, got)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	server := httptest.NewServer(NewServer(cpu.NewCpu(4096, 0x200), nil, 10))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestCrossOriginRequestsRejected(t *testing.T) {
+	server := httptest.NewServer(NewServer(cpu.NewCpu(4096, 0x200), nil, 10))
+	defer server.Close()
+
+	handshake, _ := http.NewRequest("GET", server.URL+"/ws", nil)
+	handshake.Header.Set("Origin", "http://evil.example")
+	handshake.Header.Set("Connection", "Upgrade")
+	handshake.Header.Set("Upgrade", "websocket")
+	handshake.Header.Set("Sec-WebSocket-Version", "13")
+	handshake.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	upload := func(origin string) *http.Request {
+		req, _ := http.NewRequest("POST", server.URL+"/rom", bytes.NewReader([]byte{0x12, 0x00}))
+		req.Header.Set("Origin", origin)
+		return req
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"cross-origin handshake", handshake, http.StatusForbidden},
+		{"cross-origin upload", upload("http://evil.example"), http.StatusForbidden},
+		{"same-origin upload", upload(server.URL), http.StatusNoContent},
+	} {
+		resp, err := http.DefaultClient.Do(tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("Expected status %d for a %s, got %d", tc.status, tc.name, resp.StatusCode)
+		}
+	}
+}
+
+func TestStalledPageIsDropped(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	// This page never reads, so its socket fills and then its queue.
+	dial(t, server)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100000; i++ {
+			s.mu.Lock()
+			s.broadcast(true)
+			n := len(s.clients)
+			s.mu.Unlock()
+			if n == 0 {
+				done <- true
+				return
+			}
+		}
+		done <- false
+	}()
+
+	select {
+	case dropped := <-done:
+		if !dropped {
+			t.Error("Expected the stalled page to be dropped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected broadcasting to a stalled page not to block")
+	}
+}
+
+func TestBlockedFrameFuncDoesNotHoldTheServer(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	entered, release := make(chan uint16), make(chan struct{})
+	s.SetFrameFunc(func(keys uint16) error {
+		entered <- keys
+		<-release
+		return nil
+	})
+
+	stepped := make(chan struct{})
+	go func() {
+		s.Step()
+		close(stepped)
+	}()
+	<-entered
+
+	// A new page, key presses and uploads must not wait for the frame.
+	client := dial(t, server)
+	client.keymap(t)
+	client.send(t, true, OpText, []byte(`{"type":"key","key":3,"down":true}`))
+	resp, err := http.Post(server.URL+"/rom", "application/octet-stream", bytes.NewReader([]byte{0x12, 0x00}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an upload during netplay to be refused, got status %d", resp.StatusCode)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		keys := s.keys
+		s.mu.Unlock()
+		if keys == 1<<3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the key press to be taken during the frame")
+		}
+	}
+
+	close(release)
+	<-stepped
+	if _, frame := client.read(t); frame[0]&statusLoaded == 0 {
+		t.Error("Expected a frame once the frame function returned")
+	}
+
+	go s.Step()
+	if keys := <-entered; keys != 1<<3 {
+		t.Errorf("Expected the next frame to get key 3, got %016b", keys)
+	}
+}
+
+func TestUploadResolvesSettings(t *testing.T) {
+	known := []byte{0x12, 0x00}
+	db := romdb.New()
+	if err := db.Add(romdb.Hash(known), romdb.Entry{Platform: "chip8", InstructionsPerFrame: 20, Quirks: cpu.Quirks{Jump: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	s.SetResolver(&config.Resolver{DB: db})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	upload := func(data []byte) {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/rom", "application/octet-stream", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+		}
+	}
+
+	upload(known)
+	s.mu.Lock()
+	quirks, ipf := s.cpu.Config.Quirks, s.instructionsPerFrame
+	s.mu.Unlock()
+	if quirks != (cpu.Quirks{Jump: true}) || ipf != 20 {
+		t.Errorf("Expected the database entry's quirks and speed, got %+v at %d", quirks, ipf)
+	}
+
+	upload([]byte{0x13, 0x00})
+	s.mu.Lock()
+	quirks, ipf = s.cpu.Config.Quirks, s.instructionsPerFrame
+	s.mu.Unlock()
+	if defaults := config.Defaults(); quirks != defaults.Quirks || ipf != defaults.InstructionsPerFrame {
+		t.Errorf("Expected an unknown ROM to get the defaults, got %+v at %d", quirks, ipf)
+	}
+}
+
+func TestLoadDropsCheatsForAnotherROM(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	rom := func(data ...byte) *loader.ROM {
+		r, err := loader.Parse("game.ch8", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if err := s.Load(rom(0x12, 0x00)); err != nil {
+		t.Fatal(err)
+	}
+	s.SetCheats(cheat.NewSet([]cheat.Code{{Address: 0x300, Value: 9}}))
+
+	if err := s.Load(rom(0x12, 0x00)); err != nil {
+		t.Fatal(err)
+	}
+	s.Step()
+	if s.cpu.Memory[0x300] != 9 {
+		t.Error("Expected reloading the same ROM to keep its cheats")
+	}
+
+	if err := s.Load(rom(0x12, 0x02, 0x12, 0x02)); err != nil {
+		t.Fatal(err)
+	}
+	s.Step()
+	if s.cpu.Memory[0x300] != 0 {
+		t.Errorf("Expected another ROM to drop the cheats, got 0x%02X at 0x300", s.cpu.Memory[0x300])
+	}
+}
+
+func TestServerAudio(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	s.SetAudio(config.Audio{Enabled: true, Frequency: 880, Volume: 0.5})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	client := dial(t, server)
+	client.keymap(t)
+	op, data := client.read(t)
+	var msg struct{ Audio *config.Audio }
+	if op != OpText || json.Unmarshal(data, &msg) != nil || msg.Audio == nil {
+		t.Fatalf("Expected an audio message, got op %d %q", op, data)
+	}
+	if *msg.Audio != (config.Audio{Enabled: true, Frequency: 880, Volume: 0.5}) {
+		t.Errorf("Expected the buzzer settings to reach the page, got %+v", *msg.Audio)
+	}
+	client.read(t)
+
+	s.SetAudio(config.Audio{})
+	if _, data := client.read(t); !strings.Contains(string(data), `"enabled":false`) {
+		t.Errorf("Expected pages to hear of muted audio, got %q", data)
+	}
+}
+
+func TestPingAndFragmentedMessages(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	client := dial(t, server)
+	client.keymap(t)
+	client.read(t)
+
+	client.send(t, true, OpPing, []byte("hi"))
+	if op, payload := client.read(t); op != OpPong || string(payload) != "hi" {
+		t.Fatalf("Expected pong \"hi\", got op %d %q", op, payload)
+	}
+
+	client.send(t, false, OpText, []byte(`{"type":"ke`))
+	client.send(t, true, OpContinuation, []byte(`y","key":5,"down":true}`))
+	client.read(t)
+
+	s.mu.Lock()
+	pressed := s.cpu.Keys[5]
+	s.mu.Unlock()
+	if !pressed {
+		t.Error("Expected key 5 to be pressed after a fragmented command")
+	}
+}
+
+func TestServerRunsUploadedROM(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 10)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected the page to be served, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	client := dial(t, server)
+	if k := client.keymap(t); k["KeyW"] != 5 {
+		t.Errorf("Expected the default keymap, got %v", k)
+	}
+	if _, frame := client.read(t); frame[0]&statusLoaded != 0 {
+		t.Fatal("Expected no ROM to be loaded yet")
+	}
+
+	s.SetKeymapFunc(func(rom []byte) keymap.Keymap {
+		k, _ := keymap.Builtin("arrows")
+		return k
+	})
+	client.keymap(t)
+
+	// Wait for a key, then draw its glyph at 0, 0.
+	rom := []byte{0xF0, 0x0A, 0xF0, 0x29, 0x61, 0x00, 0xD1, 0x15, 0x12, 0x08}
+	resp, err = http.Post(server.URL+"/rom?name=keypad.ch8", "application/octet-stream", bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if k := client.keymap(t); k["ArrowUp"] != 2 {
+		t.Errorf("Expected the keymap chosen for the ROM, got %v", k)
+	}
+	if _, frame := client.read(t); frame[0]&statusLoaded == 0 {
+		t.Fatal("Expected the ROM to be loaded")
+	}
+
+	client.send(t, true, OpText, []byte(`{"type":"key","key":8,"down":true}`))
+	client.read(t)
+	s.Step()
+
+	// The glyph for 8 starts with 0xF0.
+	if _, frame := client.read(t); frame[1] != 0xF0 {
+		t.Errorf("Expected the first row of the 8 glyph, got 0x%02X", frame[1])
+	}
+
+	client.send(t, true, OpText, []byte(`{"type":"pause","paused":true}`))
+	if _, frame := client.read(t); frame[0]&statusPaused == 0 {
+		t.Error("Expected the machine to be paused")
+	}
+
+	client.send(t, true, OpText, []byte(`{"type":"reset"}`))
+	if _, frame := client.read(t); frame[1] != 0 {
+		t.Error("Expected reset to clear the screen")
+	}
+}
+
+func TestServerRenderer(t *testing.T) {
+	s := NewServer(cpu.NewCpu(4096, 0x200), nil, 3)
+	palette, _ := render.Builtin("amber")
+	r, err := render.New(render.Options{Palette: palette, Decay: 0.5, Steady: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRenderer(r)
+	ipf := 3
+	s.SetResolver(&config.Resolver{Override: config.Layer{InstructionsPerFrame: &ipf}})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	client := dial(t, server)
+	client.keymap(t)
+	op, data := client.read(t)
+	var msg struct{ Display struct{ Palette []string } }
+	if op != OpText || json.Unmarshal(data, &msg) != nil || len(msg.Display.Palette) != 2 || msg.Display.Palette[1] != "#ffb000" {
+		t.Fatalf("Expected a display message with the amber palette, got op %d %q", op, data)
+	}
+	client.read(t)
+
+	// Draw the 0 glyph in one frame and erase it in the next.
+	rom, err := loader.Parse("blink.ch8", []byte{0x60, 0x00, 0xF0, 0x29, 0xD0, 0x05, 0xD0, 0x05, 0x12, 0x08})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+	client.keymap(t)
+	client.read(t)
+
+	s.Step()
+	if _, frame := client.read(t); frame[1] != 0xF0 {
+		t.Fatalf("Expected the first row of the 0 glyph, got 0x%02X", frame[1])
+	}
+
+	s.Step()
+	s.mu.Lock()
+	held := s.frame()[1]
+	s.mu.Unlock()
+	if held != 0xF0 {
+		t.Errorf("Expected the erase-only frame to be held back, got 0x%02X", held)
+	}
+
+	s.Step()
+	if _, frame := client.read(t); frame[1] != 0 {
+		t.Errorf("Expected the erase to show once the screen settled, got 0x%02X", frame[1])
+	}
+}
@@ -0,0 +1,252 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This is the subset of RFC 6455 the frontend needs: the server side of
+// the handshake, masked client frames with fragmentation, and unmasked
+// server frames. Extensions and subprotocols are not negotiated.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const maxMessageSize = 1 << 20
+
+var ErrMessageTooLarge = errors.New("websocket: message too large")
+
+type Conn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	wmu  sync.Mutex
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether r comes from a page served by the host it
+// was sent to. Browsers send Origin with every handshake and cross-site
+// POST, so a request without one is from another program and allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade completes the WebSocket handshake for r and takes over the
+// connection. Handshakes from pages on other origins are refused. On
+// failure it has already written an HTTP error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, "websocket: method not allowed", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method not allowed")
+	case !sameOrigin(r):
+		http.Error(w, "websocket: cross-origin handshake", http.StatusForbidden)
+		return nil, errors.New("websocket: cross-origin handshake")
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "websocket: not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("websocket: not a websocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	case key == "":
+		http.Error(w, "websocket: missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing Sec-WebSocket-Key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: connection cannot be hijacked", http.StatusInternalServerError)
+		return nil, errors.New("websocket: connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, rw: rw}, nil
+}
+
+type frame struct {
+	fin     bool
+	op      byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{fin: header[0]&0x80 != 0, op: header[0] & 0x0F}
+	if header[0]&0x70 != 0 {
+		return frame{}, errors.New("websocket: reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return frame{}, errors.New("websocket: client frame is not masked")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return frame{}, ErrMessageTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return frame{}, err
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.rw, f.payload); err != nil {
+		return frame{}, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+
+	return f, nil
+}
+
+// ReadMessage returns the next text or binary message, reassembling
+// fragments. Pings are answered here; a close frame is echoed and
+// reported as io.EOF.
+func (c *Conn) ReadMessage() (byte, []byte, error) {
+	var op byte
+	var message []byte
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.op {
+		case OpPing:
+			if err := c.WriteMessage(OpPong, f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			c.WriteMessage(OpClose, f.payload)
+			return 0, nil, io.EOF
+		case OpText, OpBinary:
+			if message != nil {
+				return 0, nil, errors.New("websocket: new message inside a fragmented one")
+			}
+			op = f.op
+			message = f.payload
+		case OpContinuation:
+			if message == nil {
+				return 0, nil, errors.New("websocket: continuation without a message")
+			}
+			if len(message)+len(f.payload) > maxMessageSize {
+				return 0, nil, ErrMessageTooLarge
+			}
+			message = append(message, f.payload...)
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", f.op)
+		}
+
+		if f.fin {
+			return op, message, nil
+		}
+	}
+}
+
+// WriteMessage sends data as a single frame. It is safe to call from
+// several goroutines.
+func (c *Conn) WriteMessage(op byte, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	header := []byte{0x80 | op}
+	switch n := len(data); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.rw.Write(header)
+	c.rw.Write(data)
+	return c.rw.Flush()
+}
+
+// SetWriteDeadline makes writes that have not finished by t fail.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}